@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+// Authenticator verifies a bearer token and returns the identity it belongs to.
+type Authenticator interface {
+	Authenticate(token string) (*Identity, error)
+}
+
+// IdentityResolver looks up the current identity of a caller by its ID, for
+// work done on behalf of a caller after its request has completed.
+type IdentityResolver interface {
+	ResolveIdentity(id string) (*Identity, error)
+}
+
+// SecretAuthenticator accepts a single shared secret granting admin access.
+// It is kept for deployments still using the --secret flag.
+type SecretAuthenticator struct {
+	secret string
+}
+
+func (a *SecretAuthenticator) Authenticate(token string) (*Identity, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.secret)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	return secretIdentity(), nil
+}
+
+// ResolveIdentity implements IdentityResolver.
+func (a *SecretAuthenticator) ResolveIdentity(id string) (*Identity, error) {
+	if id != "secret" {
+		return nil, ErrUnknownID
+	}
+	return secretIdentity(), nil
+}
+
+func secretIdentity() *Identity {
+	return &Identity{ID: "secret", Name: "secret", Scopes: []Scope{ScopeAdmin}}
+}
+
+func NewSecretAuthenticator(secret string) *SecretAuthenticator {
+	return &SecretAuthenticator{secret: secret}
+}
+
+// MultiAuthenticator tries each authenticator in order and returns the first
+// identity found.
+type MultiAuthenticator []Authenticator
+
+func (m MultiAuthenticator) Authenticate(token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	err := ErrInvalidToken
+	for _, a := range m {
+		identity, authErr := a.Authenticate(token)
+		if authErr == nil {
+			return identity, nil
+		}
+		// prefer a more specific reason over a generic mismatch
+		if !errors.Is(authErr, ErrInvalidToken) {
+			err = authErr
+		}
+	}
+	return nil, err
+}
+
+// ResolveIdentity implements IdentityResolver using the chained
+// authenticators that can look up identities.
+func (m MultiAuthenticator) ResolveIdentity(id string) (*Identity, error) {
+	for _, a := range m {
+		if resolver, ok := a.(IdentityResolver); ok {
+			if identity, err := resolver.ResolveIdentity(id); err == nil {
+				return identity, nil
+			}
+		}
+	}
+	return nil, ErrUnknownID
+}
+
+// ParseBearerToken extracts the token from an Authorization header value.
+func ParseBearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// CertificateAuthenticator resolves the identity of a client from its
+// verified TLS certificate.
+type CertificateAuthenticator interface {
+	AuthenticateCertificate(cert *x509.Certificate) (*Identity, error)
+}
+
+// CertificateMapper grants scopes to client certificates by name. A rule
+// matches the certificate common name or any of its DNS, email or URI SANs.
+type CertificateMapper struct {
+	rules map[string][]Scope
+}
+
+// ParseCertificateMappings parses rules in the form "<name>=<scope>[,<scope>...]".
+func ParseCertificateMappings(values []string) (*CertificateMapper, error) {
+	rules, err := ParseScopeMappings(values)
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateMapper{rules: rules}, nil
+}
+
+// certificateNames returns the names a rule can match, most specific first.
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+func (m *CertificateMapper) AuthenticateCertificate(cert *x509.Certificate) (*Identity, error) {
+	for _, name := range certificateNames(cert) {
+		if scopes, ok := m.rules[name]; ok {
+			return &Identity{ID: "cert:" + name, Name: "cert:" + name, Scopes: scopes}, nil
+		}
+	}
+	return nil, ErrUnknownCert
+}
+
+// Authenticate implements Authenticator so the mapper can be chained with
+// token authenticators; it never accepts bearer tokens.
+func (m *CertificateMapper) Authenticate(string) (*Identity, error) {
+	return nil, ErrInvalidToken
+}
+
+// ResolveIdentity implements IdentityResolver for identities of mapped
+// certificate names.
+func (m *CertificateMapper) ResolveIdentity(id string) (*Identity, error) {
+	name, ok := strings.CutPrefix(id, "cert:")
+	if !ok {
+		return nil, ErrUnknownID
+	}
+	scopes, ok := m.rules[name]
+	if !ok {
+		return nil, ErrUnknownID
+	}
+	return &Identity{ID: id, Name: id, Scopes: scopes}, nil
+}
+
+// AuthenticateCertificate implements CertificateAuthenticator using the
+// first chained authenticator that supports certificates.
+func (m MultiAuthenticator) AuthenticateCertificate(cert *x509.Certificate) (*Identity, error) {
+	for _, a := range m {
+		if certAuth, ok := a.(CertificateAuthenticator); ok {
+			if identity, err := certAuth.AuthenticateCertificate(cert); err == nil {
+				return identity, nil
+			}
+		}
+	}
+	return nil, ErrUnknownCert
+}
+
+// AuthenticateRequest resolves the caller from a bearer token, falling back
+// to the verified client certificate when no token was sent.
+func AuthenticateRequest(authenticator Authenticator, token string, peerCerts []*x509.Certificate) (*Identity, error) {
+	if token == "" && len(peerCerts) > 0 {
+		if certAuth, ok := authenticator.(CertificateAuthenticator); ok {
+			if identity, err := certAuth.AuthenticateCertificate(peerCerts[0]); err == nil {
+				return identity, nil
+			}
+		}
+	}
+	return authenticator.Authenticate(token)
+}
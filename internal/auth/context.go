@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated identity.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity stored in ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
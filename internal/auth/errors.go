@@ -0,0 +1,15 @@
+package auth
+
+import "errors"
+
+var (
+	ErrMissingToken  = errors.New("missing access token")
+	ErrInvalidToken  = errors.New("invalid access token")
+	ErrTokenExpired  = errors.New("access token expired")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrMissingName   = errors.New("missing token name")
+	ErrNoScopes      = errors.New("at least one scope is required")
+	ErrUnknownCert   = errors.New("client certificate is not mapped to an identity")
+	ErrUnknownID     = errors.New("identity no longer exists")
+)
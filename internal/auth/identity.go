@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"path"
+	"strings"
+)
+
+// Identity describes an authenticated API caller and what it may access.
+type Identity struct {
+	ID     string   // stable and unique id of the caller, owns jobs and uploads
+	Name   string   // token or principal name, used for logging
+	Scopes []Scope  // granted scopes
+	Paths  []string // allowed file paths relative to the root dir, empty means all
+}
+
+// AnonymousIdentity is used when authentication is disabled.
+var AnonymousIdentity = &Identity{
+	ID:     "anonymous",
+	Name:   "anonymous",
+	Scopes: []Scope{ScopeAdmin},
+}
+
+// HasScope reports whether the identity was granted scope. The admin scope
+// implies every other scope.
+func (i *Identity) HasScope(scope Scope) bool {
+	for _, s := range i.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessPath reports whether rel is inside one of the identity's allowed
+// paths. Identities without path restrictions can access every path.
+func (i *Identity) CanAccessPath(rel string) bool {
+	if len(i.Paths) == 0 {
+		return true
+	}
+	rel = cleanRelPath(rel)
+	for _, allowed := range i.Paths {
+		allowed = cleanRelPath(allowed)
+		if allowed == "" || rel == allowed || strings.HasPrefix(rel, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeePath reports whether rel is accessible or is a parent directory of an
+// allowed path, so that restricted callers can still browse down to it.
+func (i *Identity) CanSeePath(rel string) bool {
+	if i.CanAccessPath(rel) {
+		return true
+	}
+	rel = cleanRelPath(rel)
+	for _, allowed := range i.Paths {
+		allowed = cleanRelPath(allowed)
+		if rel == "" || strings.HasPrefix(allowed, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanRelPath normalizes a slash separated path relative to the root dir.
+func cleanRelPath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
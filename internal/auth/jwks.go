@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// jsonWebKey is the subset of RFC 7517 fields needed for signature keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet holds verification keys indexed by key ID. Keys without an ID are
+// tried in turn for tokens that do not carry a kid header.
+type keySet struct {
+	byID      map[string]crypto.PublicKey
+	anonymous []crypto.PublicKey
+}
+
+func (ks *keySet) all() []crypto.PublicKey {
+	keys := make([]crypto.PublicKey, 0, len(ks.byID)+len(ks.anonymous))
+	for _, key := range ks.byID {
+		keys = append(keys, key)
+	}
+	return append(keys, ks.anonymous...)
+}
+
+// parseKeySet parses either a JWKS document or PEM encoded public keys and
+// certificates.
+func parseKeySet(data []byte) (*keySet, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return parseJWKS(data)
+	}
+	return parsePEMKeys(data)
+}
+
+func parseJWKS(data []byte) (*keySet, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	ks := &keySet{byID: make(map[string]crypto.PublicKey)}
+	for i, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %d: %w", i, err)
+		}
+		if jwk.Kid != "" {
+			ks.byID[jwk.Kid] = key
+		} else {
+			ks.anonymous = append(ks.anonymous, key)
+		}
+	}
+	if len(ks.byID) == 0 && len(ks.anonymous) == 0 {
+		return nil, errors.New("JWKS contains no signature keys")
+	}
+	return ks, nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URLInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URLInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := decodeBase64URLInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URLInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBase64URLInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parsePEMKeys(data []byte) (*keySet, error) {
+	ks := &keySet{byID: make(map[string]crypto.PublicKey)}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ks.anonymous = append(ks.anonymous, key)
+		case "RSA PUBLIC KEY":
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ks.anonymous = append(ks.anonymous, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ks.anonymous = append(ks.anonymous, cert.PublicKey)
+		}
+	}
+	if len(ks.anonymous) == 0 {
+		return nil, errors.New("no public keys found in PEM data")
+	}
+	return ks, nil
+}
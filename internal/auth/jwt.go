@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultScopeClaim = "scope"
+
+// jwtSigningMethods are the accepted JWT algorithms. HMAC and "none" are
+// never accepted since the verifier only holds public keys.
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// JWTConfig configures a JWTVerifier.
+type JWTConfig struct {
+	KeysFile    string             // JWKS document or PEM public keys/certificates
+	Issuer      string             // required "iss" claim, if set
+	Audience    string             // required "aud" entry, if set
+	ScopeClaim  string             // claim holding scopes or roles, defaults to "scope"
+	ClaimScopes map[string][]Scope // scopes granted for custom claim values
+	Leeway      time.Duration      // clock skew allowance for exp/nbf/iat
+}
+
+// JWTVerifier authenticates JWTs issued by an external identity provider
+// against a locally configured key set. The key file is reloaded when it
+// changes on disk, so keys can be rotated without a restart.
+type JWTVerifier struct {
+	config  JWTConfig
+	parser  *jwt.Parser
+	mu      sync.RWMutex
+	keys    *keySet
+	modTime time.Time
+}
+
+// NewJWTVerifier loads the key set referenced by config.
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.KeysFile == "" {
+		return nil, errors.New("missing JWT keys file")
+	}
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = defaultScopeClaim
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.Leeway),
+	}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+	v := &JWTVerifier{
+		config: config,
+		parser: jwt.NewParser(opts...),
+	}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload re-reads the key file. On error the previous keys stay in use.
+func (v *JWTVerifier) Reload() error {
+	fi, err := os.Stat(v.config.KeysFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.config.KeysFile)
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return fmt.Errorf("load JWT keys from %s: %w", v.config.KeysFile, err)
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.modTime = fi.ModTime()
+	v.mu.Unlock()
+	return nil
+}
+
+// reloadIfChanged reloads the key set when the file was modified. Errors
+// keep the previously loaded keys.
+func (v *JWTVerifier) reloadIfChanged() {
+	fi, err := os.Stat(v.config.KeysFile)
+	if err != nil {
+		return
+	}
+	v.mu.RLock()
+	changed := !fi.ModTime().Equal(v.modTime)
+	v.mu.RUnlock()
+	if changed {
+		_ = v.Reload()
+	}
+}
+
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (any, error) {
+	v.mu.RLock()
+	keys := v.keys
+	v.mu.RUnlock()
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok := keys.byID[kid]; ok {
+			return key, nil
+		}
+		if len(keys.anonymous) == 0 {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return jwt.VerificationKeySet{Keys: toVerificationKeys(keys.anonymous)}, nil
+	}
+	return jwt.VerificationKeySet{Keys: toVerificationKeys(keys.all())}, nil
+}
+
+func toVerificationKeys[T any](keys []T) []jwt.VerificationKey {
+	out := make([]jwt.VerificationKey, len(keys))
+	for i, key := range keys {
+		out[i] = key
+	}
+	return out
+}
+
+// Authenticate implements Authenticator. Strings that are not JWTs are
+// rejected with ErrInvalidToken so other authenticators can be tried. The
+// "sub" claim is required, it is the ID that owns the caller's jobs and
+// uploads.
+func (v *JWTVerifier) Authenticate(tokenString string) (*Identity, error) {
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+	if strings.Count(tokenString, ".") != 2 {
+		return nil, ErrInvalidToken
+	}
+	v.reloadIfChanged()
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc); err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+	scopes := v.claimScopes(claims[v.config.ScopeClaim])
+	if len(scopes) == 0 {
+		return nil, ErrInvalidToken
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, ErrInvalidToken
+	}
+	name := "jwt:" + sub
+	return &Identity{ID: name, Name: name, Scopes: scopes}, nil
+}
+
+// claimScopes maps a scope claim to mcrunner scopes. The claim may be a
+// space separated string (RFC 8693 "scope") or an array of strings such as
+// "roles". Values are either scope names or keys of ClaimScopes; anything
+// else is ignored.
+func (v *JWTVerifier) claimScopes(claim any) []Scope {
+	var values []string
+	switch c := claim.(type) {
+	case string:
+		values = strings.Fields(c)
+	case []any:
+		for _, item := range c {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	var scopes []Scope
+	seen := make(map[Scope]bool)
+	grant := func(scope Scope) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, value := range values {
+		if mapped, ok := v.config.ClaimScopes[value]; ok {
+			for _, scope := range mapped {
+				grant(scope)
+			}
+		} else if scope, err := ParseScope(value); err == nil {
+			grant(scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://panel.example.com"
+	testAudience = "mcrunner"
+)
+
+type testKey struct {
+	kid    string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+func newTestKeys(t *testing.T) []testKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []testKey{
+		{kid: "rsa-1", method: jwt.SigningMethodRS256, signer: rsaKey},
+		{kid: "ec-1", method: jwt.SigningMethodES256, signer: ecKey},
+		{kid: "ed-1", method: jwt.SigningMethodEdDSA, signer: edKey},
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func toJWK(key testKey) map[string]string {
+	switch pub := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": key.kid, "use": "sig", "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": key.kid, "crv": "P-256", "x": b64(pub.X.FillBytes(make([]byte, 32))), "y": b64(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": key.kid, "crv": "Ed25519", "x": b64(pub)}
+	}
+	panic("unsupported key")
+}
+
+func writeJWKS(t *testing.T, filename string, keys ...testKey) {
+	t.Helper()
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, key := range keys {
+		doc.Keys = append(doc.Keys, toJWK(key))
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signToken(t *testing.T, key testKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.kid != "" {
+		token.Header["kid"] = key.kid
+	}
+	s, err := token.SignedString(key.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"scope": "state:read console:read",
+	}
+}
+
+func newTestVerifier(t *testing.T, keysFile string) *JWTVerifier {
+	t.Helper()
+	v, err := NewJWTVerifier(JWTConfig{
+		KeysFile:    keysFile,
+		Issuer:      testIssuer,
+		Audience:    testAudience,
+		ClaimScopes: map[string][]Scope{"operator": {ScopeLifecycle, ScopeConsoleWrite}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	keysFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, keysFile, keys...)
+	v := newTestVerifier(t, keysFile)
+
+	for _, key := range keys {
+		t.Run(key.method.Alg(), func(t *testing.T) {
+			identity, err := v.Authenticate(signToken(t, key, validClaims()))
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if identity.Name != "jwt:alice" {
+				t.Errorf("name = %q, want jwt:alice", identity.Name)
+			}
+			if !identity.HasScope(ScopeStateRead) || !identity.HasScope(ScopeConsoleRead) || identity.HasScope(ScopeLifecycle) {
+				t.Errorf("unexpected scopes %v", identity.Scopes)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRejects(t *testing.T) {
+	keys := newTestKeys(t)
+	keysFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, keysFile, keys...)
+	v := newTestVerifier(t, keysFile)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(name string, value any) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"not a jwt", "mcr_0123456789ab_secret", ErrInvalidToken},
+		{"wrong issuer", signToken(t, keys[0], with("iss", "https://evil.example.com")), ErrInvalidToken},
+		{"wrong audience", signToken(t, keys[0], with("aud", "other")), ErrInvalidToken},
+		{"missing expiry", signToken(t, keys[0], with("exp", nil)), ErrInvalidToken},
+		{"missing subject", signToken(t, keys[0], with("sub", nil)), ErrInvalidToken},
+		{"empty subject", signToken(t, keys[0], with("sub", "")), ErrInvalidToken},
+		{"expired", signToken(t, keys[0], with("exp", time.Now().Add(-time.Minute).Unix())), ErrTokenExpired},
+		{"bad signature", signToken(t, testKey{kid: "rsa-1", method: jwt.SigningMethodRS256, signer: otherKey}, validClaims()), ErrInvalidToken},
+		{"unknown kid", signToken(t, testKey{kid: "rsa-2", method: jwt.SigningMethodRS256, signer: keys[0].signer}, validClaims()), ErrInvalidToken},
+		{"alg none", noneToken, ErrInvalidToken},
+		{"no scopes", signToken(t, keys[0], with("scope", "unknown")), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Authenticate(tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierClaimMapping(t *testing.T) {
+	keys := newTestKeys(t)
+	keysFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, keysFile, keys...)
+	v := newTestVerifier(t, keysFile)
+
+	claims := validClaims()
+	claims["scope"] = []any{"operator", "files:read", "unknown"}
+	identity, err := v.Authenticate(signToken(t, keys[0], claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Scope{ScopeLifecycle, ScopeConsoleWrite, ScopeFilesRead}
+	if !slices.Equal(identity.Scopes, want) {
+		t.Fatalf("scopes = %v, want %v", identity.Scopes, want)
+	}
+	if identity.ID != "jwt:alice" {
+		t.Fatalf("id = %q, want %q", identity.ID, "jwt:alice")
+	}
+}
+
+func TestJWTVerifierPEM(t *testing.T) {
+	keys := newTestKeys(t)
+	var data []byte
+	for _, key := range keys {
+		der, err := x509.MarshalPKIXPublicKey(key.signer.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	keysFile := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(keysFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVerifier(t, keysFile)
+
+	for _, key := range keys {
+		key.kid = ""
+		if _, err := v.Authenticate(signToken(t, key, validClaims())); err != nil {
+			t.Errorf("%s: %v", key.method.Alg(), err)
+		}
+	}
+}
+
+func TestJWTVerifierReload(t *testing.T) {
+	keys := newTestKeys(t)
+	keysFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, keysFile, keys[0])
+	v := newTestVerifier(t, keysFile)
+
+	rotated := signToken(t, keys[1], validClaims())
+	if _, err := v.Authenticate(rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v before rotation, want ErrInvalidToken", err)
+	}
+
+	writeJWKS(t, keysFile, keys[1])
+	future := time.Now().Add(time.Second)
+	if err := os.Chtimes(keysFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Authenticate(rotated); err != nil {
+		t.Fatalf("rotated key not picked up: %v", err)
+	}
+	if _, err := v.Authenticate(signToken(t, keys[0], validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v for removed key, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope is a permission granted to an API caller.
+type Scope string
+
+const (
+	ScopeStateRead    Scope = "state:read"    // read server state and metrics
+	ScopeConsoleRead  Scope = "console:read"  // stream console output
+	ScopeConsoleWrite Scope = "console:write" // send commands and console input
+	ScopeLifecycle    Scope = "lifecycle"     // start, stop, restart and kill the server
+	ScopeFilesRead    Scope = "files:read"    // list and download files
+	ScopeFilesWrite   Scope = "files:write"   // create, upload, rename and delete files
+	ScopeAdmin        Scope = "admin"         // everything, including token management
+)
+
+// AllScopes lists every known scope.
+var AllScopes = []Scope{
+	ScopeStateRead,
+	ScopeConsoleRead,
+	ScopeConsoleWrite,
+	ScopeLifecycle,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+	ScopeAdmin,
+}
+
+// ParseScope validates a scope name.
+func ParseScope(s string) (Scope, error) {
+	scope := Scope(strings.TrimSpace(s))
+	for _, known := range AllScopes {
+		if scope == known {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidScope, s)
+}
+
+// ParseScopeMappings parses mappings in the form "<name>=<scope>[,<scope>...]"
+// used to grant scopes to certificate names and token claim values.
+func ParseScopeMappings(values []string) (map[string][]Scope, error) {
+	mappings := make(map[string][]Scope, len(values))
+	for _, value := range values {
+		name, scopeList, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected <name>=<scopes>", value)
+		}
+		scopes, err := ParseScopes([]string{scopeList})
+		if err != nil {
+			return nil, err
+		}
+		if len(scopes) == 0 {
+			return nil, fmt.Errorf("mapping %q: %w", name, ErrNoScopes)
+		}
+		mappings[name] = scopes
+	}
+	return mappings, nil
+}
+
+// ParseScopes validates a list of scope names. Each item may itself be a
+// comma or space separated list, so both `--scope a --scope b` and
+// `--scope a,b` are accepted.
+func ParseScopes(values []string) ([]Scope, error) {
+	var scopes []Scope
+	seen := make(map[Scope]bool)
+	for _, value := range values {
+		for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			scope, err := ParseScope(name)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes, nil
+}
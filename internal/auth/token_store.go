@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tokenPrefix = "mcr_"
+
+// Token is a named API token. Only the SHA-256 hash of the token secret is
+// stored; the secret itself is shown once when the token is created.
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Scopes    []Scope    `json:"scopes"`
+	Paths     []string   `json:"paths,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether the token is past its expiry time.
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Identity returns the identity granted by the token.
+func (t *Token) Identity() *Identity {
+	return &Identity{
+		ID:     "token:" + t.ID,
+		Name:   t.Name,
+		Scopes: t.Scopes,
+		Paths:  t.Paths,
+	}
+}
+
+type tokenFile struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+// TokenStore keeps API tokens in a JSON state file. The file is reloaded when
+// it changes on disk, so tokens created with the CLI take effect without a
+// restart.
+type TokenStore struct {
+	filename string
+	mu       sync.RWMutex
+	tokens   map[string]*Token
+	modTime  time.Time
+}
+
+// LoadTokenStore opens the token store at filename. A missing file is treated
+// as an empty store and created on the first write.
+func LoadTokenStore(filename string) (*TokenStore, error) {
+	s := &TokenStore{
+		filename: filename,
+		tokens:   make(map[string]*Token),
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TokenStore) reload() error {
+	fi, err := os.Stat(s.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		s.tokens = make(map[string]*Token)
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		return err
+	}
+	var content tokenFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return err
+	}
+	tokens := make(map[string]*Token, len(content.Tokens))
+	for _, t := range content.Tokens {
+		tokens[t.ID] = t
+	}
+	s.tokens = tokens
+	s.modTime = fi.ModTime()
+	return nil
+}
+
+// reloadIfChanged reloads the store when the file was modified by another
+// process. Errors keep the previously loaded tokens.
+func (s *TokenStore) reloadIfChanged() {
+	fi, err := os.Stat(s.filename)
+	s.mu.RLock()
+	changed := (err == nil && !fi.ModTime().Equal(s.modTime)) || (errors.Is(err, os.ErrNotExist) && !s.modTime.IsZero())
+	s.mu.RUnlock()
+	if !changed {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.reload()
+}
+
+// save writes the store atomically with owner-only permissions.
+func (s *TokenStore) save() error {
+	content := tokenFile{Tokens: s.sortedTokens()}
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0o700); err != nil {
+		return err
+	}
+	tmp := s.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if fi, err := os.Stat(s.filename); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+func (s *TokenStore) sortedTokens() []*Token {
+	out := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Create generates a new token and returns its secret. The secret cannot be
+// recovered later.
+func (s *TokenStore) Create(name string, scopes []Scope, paths []string, expiresAt *time.Time) (string, *Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrMissingName
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrNoScopes
+	}
+	for _, scope := range scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return "", nil, err
+		}
+	}
+	cleanPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p = cleanRelPath(p); p != "" {
+			cleanPaths = append(cleanPaths, p)
+		}
+	}
+
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	key, err := randomString(24)
+	if err != nil {
+		return "", nil, err
+	}
+	secret := tokenPrefix + id + "_" + key
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return "", nil, err
+	}
+	token := &Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		Scopes:    scopes,
+		Paths:     cleanPaths,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	s.tokens[id] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, id)
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+// List returns all tokens ordered by creation time.
+func (s *TokenStore) List() []*Token {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedTokens()
+}
+
+// Get returns the token with the given ID.
+func (s *TokenStore) Get(id string) (*Token, error) {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+// Revoke deletes the token with the given ID.
+func (s *TokenStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if _, ok := s.tokens[id]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	return s.save()
+}
+
+// Authenticate implements Authenticator.
+func (s *TokenStore) Authenticate(secret string) (*Identity, error) {
+	id, ok := parseTokenID(secret)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	s.reloadIfChanged()
+	s.mu.RLock()
+	token, found := s.tokens[id]
+	s.mu.RUnlock()
+	if !found {
+		return nil, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(token.Hash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if token.Expired(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+	return token.Identity(), nil
+}
+
+// ResolveIdentity implements IdentityResolver for tokens that are neither
+// revoked nor expired.
+func (s *TokenStore) ResolveIdentity(id string) (*Identity, error) {
+	tokenID, ok := strings.CutPrefix(id, "token:")
+	if !ok {
+		return nil, ErrUnknownID
+	}
+	token, err := s.Get(tokenID)
+	if err != nil || token.Expired(time.Now()) {
+		return nil, ErrUnknownID
+	}
+	return token.Identity(), nil
+}
+
+// parseTokenID extracts the token ID from a secret of the form mcr_<id>_<key>.
+func parseTokenID(secret string) (string, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return "", false
+	}
+	id, _, ok := strings.Cut(secret[len(tokenPrefix):], "_")
+	return id, ok && id != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
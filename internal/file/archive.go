@@ -0,0 +1,586 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveZip    ArchiveFormat = "zip"
+	ArchiveTar    ArchiveFormat = "tar"
+	ArchiveTarGz  ArchiveFormat = "tar.gz"
+	ArchiveTarZst ArchiveFormat = "tar.zst"
+)
+
+// ParseArchiveFormat validates an archive format name.
+func ParseArchiveFormat(name string) (ArchiveFormat, error) {
+	switch strings.ToLower(name) {
+	case "zip":
+		return ArchiveZip, nil
+	case "tar":
+		return ArchiveTar, nil
+	case "tar.gz", "tgz":
+		return ArchiveTarGz, nil
+	case "tar.zst", "tzst":
+		return ArchiveTarZst, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedArchive, name)
+}
+
+// ContentType returns the MIME type of archives in format f.
+func (f ArchiveFormat) ContentType() string {
+	switch f {
+	case ArchiveZip:
+		return "application/zip"
+	case ArchiveTarGz:
+		return "application/gzip"
+	case ArchiveTarZst:
+		return "application/zstd"
+	default:
+		return "application/x-tar"
+	}
+}
+
+// archiveWriter writes directory entries into an archive.
+type archiveWriter interface {
+	writeEntry(name string, fi fs.FileInfo, link string, r io.Reader) error
+	Close() error
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) writeEntry(name string, fi fs.FileInfo, link string, r io.Reader) error {
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if fi.IsDir() {
+		header.Name += "/"
+		header.Method = zip.Store
+	} else {
+		header.Method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		_, err = io.WriteString(w, link)
+	case r != nil:
+		_, err = io.Copy(w, r)
+	}
+	return err
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser // nil for plain tar
+}
+
+func (a *tarArchiveWriter) writeEntry(name string, fi fs.FileInfo, link string, r io.Reader) error {
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if fi.IsDir() {
+		header.Name += "/"
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if r != nil && header.Typeflag == tar.TypeReg {
+		_, err = io.Copy(a.tw, r)
+	}
+	return err
+}
+
+func (a *tarArchiveWriter) Close() error {
+	err := a.tw.Close()
+	if a.compressor != nil {
+		if cerr := a.compressor.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveZip:
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+	case ArchiveTar:
+		return &tarArchiveWriter{tw: tar.NewWriter(w)}, nil
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(w)
+		return &tarArchiveWriter{tw: tar.NewWriter(gw), compressor: gw}, nil
+	case ArchiveTarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedArchive, format)
+}
+
+// WriteArchive streams the directory at rel to w, including the mounts below
+// it. Entries are prefixed with the directory name, so extracting the archive
+// recreates the directory; archives of the root dir have no prefix. Entries
+// the caller may not read are left out, directories with everything below
+// them.
+func (s *LocalFileService) WriteArchive(w io.Writer, rel string, format ArchiveFormat) error {
+	files, rel := s.locate(rel)
+	name, err := files.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	if err := files.check(name, accessRead); err != nil {
+		return err
+	}
+	fi, err := files.root.Stat(name)
+	if err != nil {
+		return pathError(err)
+	}
+	if !fi.IsDir() {
+		return ErrNotDirectory
+	}
+	start := files.treePath(name)
+	base := path.Dir(start)
+
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	// walking the root FS keeps every open beneath the root, symlinks inside
+	// the directory are archived as links
+	walkErr := s.walkTree(filepath.FromSlash(start), func(owner *LocalFileService, p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		tp := owner.treePath(p)
+		if tp == "." {
+			return nil
+		}
+		if isReserved(p) {
+			return fs.SkipDir
+		}
+		if !owner.readable(p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := owner.root.Lstat(p)
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			// the root of a mount is named after its mount point
+			info = mountInfo{info, path.Base(tp)}
+		}
+		entryName := tp
+		if base != "." {
+			entryName = strings.TrimPrefix(tp, base+"/")
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := owner.root.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return aw.writeEntry(entryName, info, link, nil)
+		case info.IsDir():
+			return aw.writeEntry(entryName, info, "", nil)
+		case info.Mode().IsRegular():
+			f, err := owner.root.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return aw.writeEntry(entryName, info, "", f)
+		}
+		// sockets, devices and pipes are not archived
+		return nil
+	})
+	if err := aw.Close(); walkErr == nil {
+		walkErr = err
+	}
+	return walkErr
+}
+
+// ConflictPolicy decides what happens when an extracted file already exists.
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// ParseConflictPolicy validates a conflict policy name, defaulting to fail.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(name)); policy {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q", name)
+}
+
+// ExtractProgress reports the progress of an extraction.
+type ExtractProgress struct {
+	Entries      int   `json:"entries"`      // entries processed so far
+	BytesWritten int64 `json:"bytesWritten"` // uncompressed bytes written
+	BytesRead    int64 `json:"bytesRead"`    // archive bytes consumed
+	TotalBytes   int64 `json:"totalBytes"`   // archive size
+}
+
+type ExtractOptions struct {
+	OnConflict ConflictPolicy
+	Progress   func(ExtractProgress) // called after each entry and every MiB written
+}
+
+// ExtractResult summarizes a completed extraction.
+type ExtractResult struct {
+	Files        int   `json:"files"`
+	Directories  int   `json:"directories"`
+	Skipped      int   `json:"skipped"` // existing files, links and special files
+	BytesWritten int64 `json:"bytesWritten"`
+}
+
+// Extract unpacks the archive at archiveRel into the directory at destRel.
+func (s *LocalFileService) Extract(archiveRel, destRel string, opts ExtractOptions) (*ExtractResult, error) {
+	f, fi, err := s.Open(archiveRel)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.ExtractReader(f, fi.Size(), destRel, opts)
+}
+
+// ExtractReader unpacks a zip, tar, tar.gz or tar.zst archive of the given
+// size into the directory at destRel. The format is detected from the
+// content. Entries resolving outside of the destination are rejected, links
+// are skipped and files are written through the root, so an archive cannot
+// write anywhere else, not even through symlinks already in the destination.
+func (s *LocalFileService) ExtractReader(r io.ReaderAt, size int64, destRel string, opts ExtractOptions) (*ExtractResult, error) {
+	if files, destRel := s.locate(destRel); files != s {
+		return files.ExtractReader(r, size, destRel, opts)
+	}
+	dest, err := s.resolveFollow(destRel)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(dest, accessWrite); err != nil {
+		return nil, err
+	}
+	if fi, err := s.root.Stat(dest); err == nil && !fi.IsDir() {
+		return nil, ErrNotDirectory
+	}
+	if err := s.root.MkdirAll(dest, 0o755); err != nil {
+		return nil, pathError(err)
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictFail
+	}
+	x := &extractor{files: s, dest: dest, opts: opts}
+	x.progress.TotalBytes = size
+
+	format, err := detectArchiveFormat(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == ArchiveZip {
+		err = x.extractZip(r, size)
+	} else {
+		err = x.extractTar(io.NewSectionReader(r, 0, size), format)
+	}
+	x.result.BytesWritten = x.progress.BytesWritten
+	if err != nil {
+		return &x.result, err
+	}
+	return &x.result, nil
+}
+
+func detectArchiveFormat(r io.ReaderAt) (ArchiveFormat, error) {
+	magic := make([]byte, 262)
+	n, err := r.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return ArchiveTarZst, nil
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return "", ErrUnsupportedArchive
+}
+
+type extractor struct {
+	files        *LocalFileService
+	dest         string
+	opts         ExtractOptions
+	result       ExtractResult
+	progress     ExtractProgress
+	lastReported int64
+}
+
+func (x *extractor) report() {
+	if x.opts.Progress != nil {
+		x.opts.Progress(x.progress)
+	}
+}
+
+// Write counts the bytes written to the current file for progress reports.
+func (x *extractor) Write(p []byte) (int, error) {
+	x.progress.BytesWritten += int64(len(p))
+	if x.progress.BytesWritten-x.lastReported >= 1<<20 {
+		x.lastReported = x.progress.BytesWritten
+		x.report()
+	}
+	return len(p), nil
+}
+
+// target returns the root-relative path of an archive entry, rejecting names
+// that are absolute or escape the destination directory.
+func (x *extractor) target(name string) (string, error) {
+	clean := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	target := filepath.Join(x.dest, clean)
+	if !filepath.IsLocal(clean) || isReserved(target) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeArchivePath, name)
+	}
+	if x.files.isMountPoint(target) {
+		return "", fmt.Errorf("%w: %s", ErrMountPoint, name)
+	}
+	if err := x.files.check(target, accessWrite); err != nil {
+		return "", fmt.Errorf("%w: %s", err, name)
+	}
+	return target, nil
+}
+
+// checkParents applies the symlink policy to the directories leading to target.
+func (x *extractor) checkParents(target string) error {
+	if x.files.FollowSymlinks {
+		return nil
+	}
+	return x.files.checkNoSymlinks(filepath.Dir(target))
+}
+
+func (x *extractor) extractDir(name string) error {
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	root := x.files.root
+	if fi, err := root.Lstat(target); err == nil && !fi.IsDir() {
+		if fi.Mode()&fs.ModeSymlink == 0 || !x.files.FollowSymlinks {
+			return fmt.Errorf("%w: %s", ErrNotDirectory, name)
+		}
+	}
+	if err := root.MkdirAll(target, 0o755); err != nil {
+		return pathError(err)
+	}
+	x.result.Directories++
+	return nil
+}
+
+func (x *extractor) extractFile(name string, mode fs.FileMode, modTime time.Time, r io.Reader) error {
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	root := x.files.root
+	// only the growth over a replaced file is reserved
+	var replaced fs.FileInfo
+	if fi, err := root.Lstat(target); err == nil {
+		switch {
+		case fi.IsDir():
+			return fmt.Errorf("%w: %s", ErrIsDirectory, name)
+		case x.opts.OnConflict == ConflictSkip:
+			x.result.Skipped++
+			return nil
+		case x.opts.OnConflict != ConflictOverwrite:
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, name)
+		}
+		replaced = fi
+	}
+	if err := root.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return pathError(err)
+	}
+	perm := mode.Perm() | 0o600
+	if mode.Perm() == 0 {
+		perm = 0o644
+	}
+	// write next to the target and rename it into place, so that a failed
+	// entry leaves a replaced file untouched and links are replaced rather
+	// than written through
+	tmp := target + ".part"
+	f, err := root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return pathError(err)
+	}
+	qw := &quotaWriter{files: x.files, w: io.MultiWriter(f, x)}
+	if replaced != nil && replaced.Mode().IsRegular() {
+		qw.free = replaced.Size()
+	}
+	_, copyErr := io.Copy(qw, r)
+	closeErr := f.Close()
+	if copyErr != nil {
+		root.Remove(tmp)
+		return copyErr
+	}
+	if closeErr != nil {
+		root.Remove(tmp)
+		return closeErr
+	}
+	if !modTime.IsZero() {
+		_ = root.Chtimes(tmp, modTime, modTime)
+	}
+	if replaced != nil && replaced.Mode().IsRegular() {
+		x.files.keepVersion(target)
+	}
+	if err := root.Rename(tmp, target); err != nil {
+		root.Remove(tmp)
+		return pathError(err)
+	}
+	x.result.Files++
+	return nil
+}
+
+func (x *extractor) extractZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	// the central directory lists every name and size upfront, so unsafe
+	// archives and archives exceeding the quota are rejected before anything
+	// is written
+	var total int64
+	for _, entry := range zr.File {
+		if _, err := x.target(entry.Name); err != nil {
+			return err
+		}
+		if entry.Mode().IsRegular() {
+			total += int64(entry.UncompressedSize64)
+		}
+	}
+	if err := x.files.checkQuota(total); err != nil {
+		return err
+	}
+	for _, entry := range zr.File {
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.extractDir(entry.Name)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			if rc, err = entry.Open(); err == nil {
+				err = x.extractFile(entry.Name, mode, entry.Modified, rc)
+				rc.Close()
+			}
+		default:
+			x.result.Skipped++
+		}
+		if err != nil {
+			return err
+		}
+		x.progress.Entries++
+		x.progress.BytesRead += int64(entry.CompressedSize64)
+		x.report()
+	}
+	return nil
+}
+
+// countingReader counts the archive bytes consumed by the decompressor.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func (x *extractor) extractTar(r io.Reader, format ArchiveFormat) error {
+	r = &countingReader{r: r, n: &x.progress.BytesRead}
+	switch format {
+	case ArchiveTarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case ArchiveTarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.extractDir(header.Name)
+		case tar.TypeReg:
+			err = x.extractFile(header.Name, header.FileInfo().Mode(), header.ModTime, tr)
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			x.result.Skipped++
+		}
+		if err != nil {
+			return err
+		}
+		x.progress.Entries++
+		x.report()
+	}
+}
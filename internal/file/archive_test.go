@@ -0,0 +1,77 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarFile returns a tar holding name with data, cut off after keep bytes of
+// the content when keep is less than its length.
+func tarFile(t *testing.T, name, data string, keep int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if keep < len(data) {
+		tw.Write([]byte(data[:keep]))
+		return buf.Bytes()[:512+keep]
+	}
+	tw.Write([]byte(data))
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractOverwrite(t *testing.T) {
+	files, root := newTestService(t, false)
+	target := filepath.Join(root, "plugins", "conf.yml")
+	extract := func(archive []byte) error {
+		_, err := files.ExtractReader(bytes.NewReader(archive), int64(len(archive)), "plugins", ExtractOptions{OnConflict: ConflictOverwrite})
+		return err
+	}
+
+	// a truncated entry leaves the file it replaces untouched
+	if err := extract(tarFile(t, "conf.yml", "replaced content", 4)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("extract truncated err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	expectContent(t, target, "conf")
+	if _, err := os.Lstat(target + ".part"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("partial file left behind: %v", err)
+	}
+
+	// only the growth over the replaced file is reserved
+	files.Quota = 8
+	if err := extract(tarFile(t, "conf.yml", "conf", 4)); err != nil {
+		t.Fatalf("extract same size err = %v", err)
+	}
+	if err := extract(tarFile(t, "conf.yml", "conf+more", 9)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("extract over quota err = %v, want %v", err, ErrQuotaExceeded)
+	}
+	expectContent(t, target, "conf")
+
+	// links are replaced rather than written through
+	files.Quota = 0
+	symlink(t, "../world/level.dat", filepath.Join(root, "plugins", "level.dat"))
+	if err := extract(tarFile(t, "level.dat", "new", 3)); err != nil {
+		t.Fatalf("extract over link err = %v", err)
+	}
+	expectContent(t, filepath.Join(root, "plugins", "level.dat"), "new")
+	expectContent(t, filepath.Join(root, "world", "level.dat"), "level")
+}
+
+func expectContent(t *testing.T, name, want string) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Fatalf("%s = %q, want %q", name, data, want)
+	}
+}
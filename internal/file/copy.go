@@ -0,0 +1,227 @@
+package file
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Copy copies the file or directory at src to dst, preserving permissions and
+// modification times. Symlinks are copied as links, mounts below src as
+// directories. With overwrite an existing dst is replaced, otherwise
+// ErrAlreadyExists is returned.
+func (s *LocalFileService) Copy(src, dst string, overwrite bool) error {
+	return s.copy(context.Background(), src, dst, overwrite, nil)
+}
+
+// copy implements Copy, reporting the number of bytes written to written and
+// stopping between chunks once ctx is canceled.
+func (s *LocalFileService) copy(ctx context.Context, src, dst string, overwrite bool, written func(n int64)) error {
+	from, src := s.locate(src)
+	to, dst := s.locate(dst)
+	srcName, err := from.resolve(src)
+	if err != nil {
+		return err
+	}
+	dstName, err := to.resolve(dst)
+	if err != nil {
+		return err
+	}
+	if err := from.check(srcName, accessRead); err != nil {
+		return err
+	}
+	if err := to.check(dstName, accessTree); err != nil {
+		return err
+	}
+	if overlaps(from.treePath(srcName), to.treePath(dstName)) {
+		return ErrOverlappingPaths
+	}
+	if _, err := from.root.Lstat(srcName); err != nil {
+		return pathError(err)
+	}
+	if to.Quota > 0 {
+		// fail before copying anything when the tree cannot fit
+		if size, err := from.treeSize(srcName); err == nil {
+			if err := to.checkQuota(size); err != nil {
+				return err
+			}
+		}
+	}
+	if fi, err := to.root.Lstat(dstName); err == nil {
+		if !overwrite {
+			return ErrAlreadyExists
+		}
+		if err := to.checkMounts(dstName); err != nil {
+			return err
+		}
+		if err := to.remove(dstName, fi); err != nil {
+			return err
+		}
+	}
+	if err := to.root.MkdirAll(filepath.Dir(dstName), 0o755); err != nil {
+		return pathError(err)
+	}
+	// entries the caller may not read are left out
+	c := &copier{src: from.root, dst: to.root, ctx: ctx, written: written, reserve: to.reserve, include: func(name string) bool {
+		return from.readable(name) && !from.isMountPoint(name)
+	}}
+	if err := c.copy(srcName, dstName); err != nil {
+		return pathError(err)
+	}
+	for _, m := range from.mounts {
+		below, err := filepath.Rel(srcName, filepath.FromSlash(m.mountPath))
+		if err != nil || !filepath.IsLocal(below) {
+			continue
+		}
+		target := filepath.Join(dstName, below)
+		if _, err := to.root.Lstat(filepath.Dir(target)); err != nil {
+			// the parent was left out
+			continue
+		}
+		view := m.As(s.identity)
+		if !view.readable(".") {
+			continue
+		}
+		c := &copier{src: m.root, dst: to.root, ctx: ctx, written: written, reserve: to.reserve, include: view.readable}
+		if err := c.copy(".", target); err != nil {
+			return pathError(err)
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether one of the slash separated paths contains the
+// other.
+func overlaps(a, b string) bool {
+	return within(a, b) || within(b, a)
+}
+
+// treeSize returns the total size of the regular files at name the caller may
+// read, including the mounts below it.
+func (s *LocalFileService) treeSize(name string) (int64, error) {
+	var total int64
+	err := s.walkTree(name, func(files *LocalFileService, p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !files.readable(p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			info, err := files.root.Lstat(p)
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+type copier struct {
+	src, dst *os.Root
+	ctx      context.Context
+	written  func(n int64)
+	reserve  func(n int64) error    // nil for copies not counted in a quota
+	include  func(name string) bool // nil copies every entry
+}
+
+// Write counts the copied bytes and aborts the copy when the context is done.
+func (c *copier) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.reserve != nil {
+		if err := c.reserve(int64(len(p))); err != nil {
+			return 0, err
+		}
+	}
+	if c.written != nil {
+		c.written(int64(len(p)))
+	}
+	return len(p), nil
+}
+
+func (c *copier) copy(src, dst string) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	fi, err := c.src.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		link, err := c.src.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return c.dst.Symlink(link, dst)
+	case fi.IsDir():
+		return c.copyDir(src, dst, fi)
+	case fi.Mode().IsRegular():
+		return c.copyFile(src, dst, fi)
+	}
+	// sockets, devices and pipes are not copied
+	return nil
+}
+
+func (c *copier) copyDir(src, dst string, fi fs.FileInfo) error {
+	// keep the directory writable until its entries are copied
+	if err := c.dst.Mkdir(dst, fi.Mode().Perm()|0o700); err != nil {
+		return err
+	}
+	dir, err := c.src.Open(src)
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if c.include != nil && !c.include(filepath.Join(src, name)) {
+			continue
+		}
+		if err := c.copy(filepath.Join(src, name), filepath.Join(dst, name)); err != nil {
+			return err
+		}
+	}
+	if err := c.dst.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return c.dst.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+func (c *copier) copyFile(src, dst string, fi fs.FileInfo) error {
+	in, err := c.src.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := c.dst.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	// c goes first, so that nothing is written beyond the quota
+	_, copyErr := io.Copy(io.MultiWriter(c, out), in)
+	closeErr := out.Close()
+	if copyErr != nil {
+		c.dst.Remove(dst)
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if err := c.dst.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return c.dst.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
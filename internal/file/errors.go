@@ -1,6 +1,10 @@
 package file
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
 
 var (
 	ErrPathTraversal  = errors.New("invalid path: traversal outside root is not allowed")
@@ -10,4 +14,52 @@ var (
 	ErrAlreadyExists  = errors.New("already exists")
 	ErrDirNotEmpty    = errors.New("directory not empty")
 	ErrMissingNewName = errors.New("missing new name")
+
+	ErrSymlinkNotAllowed  = errors.New("path leads through a symbolic link that cannot be followed")
+	ErrReservedPath       = errors.New("path is reserved")
+	ErrPreconditionFailed = errors.New("precondition failed: the file has changed")
+)
+
+var (
+	ErrAccessDenied         = errors.New("access to path denied by path rules")
+	ErrReadOnlyPath         = errors.New("path is read-only")
+	ErrReadOnlyWhileRunning = fmt.Errorf("%w while the server is running", ErrReadOnlyPath)
+	ErrReadOnlyMount        = fmt.Errorf("%w, it is in a read-only mount", ErrReadOnlyPath)
+	ErrMountPoint           = errors.New("path is or contains a mount point")
+	ErrPathNotAllowed       = fmt.Errorf("%w: path is outside of the allowed paths", fs.ErrPermission)
+	ErrQuotaExceeded        = errors.New("disk quota exceeded")
+)
+
+var (
+	ErrUploadNotFound    = errors.New("upload not found")
+	ErrOffsetMismatch    = errors.New("upload offset mismatch")
+	ErrUploadTooLarge    = errors.New("upload exceeds the declared size")
+	ErrInvalidUploadSize = errors.New("invalid upload size")
+	ErrChecksumMismatch  = errors.New("checksum mismatch")
+)
+
+var (
+	ErrUnsupportedArchive = errors.New("unsupported archive format")
+	ErrUnsafeArchivePath  = errors.New("archive entry escapes the destination directory")
+)
+
+var (
+	ErrOverlappingPaths = errors.New("source and destination overlap")
+	ErrInvalidBatchOp   = errors.New("invalid batch operation")
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobFinished      = errors.New("job already finished")
+	ErrInvalidSearch    = errors.New("invalid search pattern")
+	ErrWatcherClosed    = errors.New("file watcher closed")
+)
+
+var (
+	ErrTrashItemNotFound = errors.New("trash item not found")
+	ErrVersionNotFound   = errors.New("version not found")
+)
+
+var (
+	ErrStagedChangeNotFound = errors.New("staged change not found")
+	ErrInvalidStagedChange  = errors.New("invalid staged change")
+	ErrNoStagedDiff         = errors.New("staged change has no file content to diff")
+	ErrRollbackFailed       = errors.New("failed to roll back the staged changes")
 )
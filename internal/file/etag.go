@@ -0,0 +1,158 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maxHashedSize is the size of the largest file whose entity tag is a
+	// content hash. Larger files, which are not edited through the panel,
+	// are tagged by modification time and size to avoid reading them.
+	maxHashedSize = 64 << 20
+	// maxETagCache is the number of content hashes kept in memory
+	maxETagCache = 4096
+)
+
+type etagEntry struct {
+	fi   os.FileInfo
+	etag string
+}
+
+// etagCache remembers the content hashes of files by name, valid as long as
+// the name refers to the same file and its size and modification time did
+// not change. Names are relative to the root of the service, the mounts share
+// the cache with the root.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+func (c *etagCache) get(name string, fi os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok || !os.SameFile(e.fi, fi) || e.fi.Size() != fi.Size() || !e.fi.ModTime().Equal(fi.ModTime()) {
+		return "", false
+	}
+	return e.etag, true
+}
+
+func (c *etagCache) put(name string, fi os.FileInfo, etag string) {
+	if time.Since(fi.ModTime()) < time.Second {
+		// the file may be rewritten within the timestamp granularity without
+		// its modification time changing
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxETagCache {
+		c.entries = make(map[string]etagEntry)
+	}
+	c.entries[name] = etagEntry{fi: fi, etag: etag}
+}
+
+// FileETag returns the entity tag of an opened file: the hex SHA-256 digest of
+// its content, or its modification time and size for files larger than
+// maxHashedSize. The file offset is not changed.
+func (s *LocalFileService) FileETag(f *os.File, fi os.FileInfo) (string, error) {
+	if fi.Size() > maxHashedSize {
+		return fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()), nil
+	}
+	if etag, ok := s.etags.get(f.Name(), fi); ok {
+		return etag, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, fi.Size())); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(h.Sum(nil))
+	s.etags.put(f.Name(), fi, etag)
+	return etag, nil
+}
+
+// ETag returns the entity tag of the file at rel, see FileETag.
+func (s *LocalFileService) ETag(rel string) (string, error) {
+	f, fi, err := s.Open(rel)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return s.FileETag(f, fi)
+}
+
+// pathLocks serializes conditional changes of the same path.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (l *pathLocks) lock(name string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*pathLock)
+	}
+	pl := l.locks[name]
+	if pl == nil {
+		pl = &pathLock{}
+		l.locks[name] = pl
+	}
+	pl.refs++
+	l.mu.Unlock()
+
+	pl.Lock()
+	return func() {
+		pl.Unlock()
+		l.mu.Lock()
+		if pl.refs--; pl.refs == 0 {
+			delete(l.locks, name)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// IfMatch calls fn when the entry at rel exists and its entity tag is one of
+// etags, where "*" matches any existing entry including directories.
+// Otherwise ErrPreconditionFailed is returned without calling fn. Conditional
+// changes of the same path are serialized, so two clients that read the same
+// content cannot both replace it.
+func (s *LocalFileService) IfMatch(rel string, etags []string, fn func() error) error {
+	name, err := s.resolve(rel)
+	if err != nil {
+		return err
+	}
+	unlock := s.condLocks.lock(name)
+	defer unlock()
+
+	if _, err := s.Stat(rel); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrPreconditionFailed
+		}
+		return err
+	}
+	if !slices.Contains(etags, "*") {
+		etag, err := s.ETag(rel)
+		if errors.Is(err, ErrIsDirectory) {
+			return ErrPreconditionFailed
+		}
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(etags, etag) {
+			return ErrPreconditionFailed
+		}
+	}
+	return fn()
+}
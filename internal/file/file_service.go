@@ -1,292 +1,597 @@
 package file
 
 import (
+	"errors"
 	"io"
+	"io/fs"
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/pkg/logger"
 )
 
+// stateDir is the directory below the root that keeps the trash and the file
+// version history. It is not reachable through the file API.
+const stateDir = ".mcrunner"
+
+// isReserved reports whether the root-relative name is stateDir or inside it.
+func isReserved(name string) bool {
+	first, _, _ := strings.Cut(filepath.ToSlash(name), "/")
+	return first == stateDir
+}
+
 // LocalFileService provides OS-backed file operations rooted at RootDir.
+// Paths are resolved through an os.Root, which opens every component relative
+// to its parent without following symlinks out of the root, so links created
+// inside the root (by plugins or extracted archives) cannot reach the rest of
+// the host.
 type LocalFileService struct {
 	RootDir string
+	// FollowSymlinks allows paths to pass through symlinks whose targets stay
+	// inside RootDir. Links leading outside of RootDir are never followed.
+	FollowSymlinks bool
+	// Trash keeps deleted entries and Versions the previous content of
+	// overwritten text files, nil disables them.
+	Trash    *Retention
+	Versions *Retention
+	// Policy restricts the paths available to callers, nil allows all paths.
+	Policy *Policy
+	// ReadOnly rejects every change, for mounts of directories that must not
+	// be written through the file API.
+	ReadOnly bool
+	// Quota limits the total size of the files below the root in bytes, not
+	// counting the mounts and the trash. Zero means no limit.
+	Quota int64
+	// UsageTTL is how long directory sizes are cached, see Usage.
+	UsageTTL time.Duration
+	// Identities looks up the callers of staged changes when they are
+	// applied, see ApplyStaged. Nil when authentication is disabled.
+	Identities auth.IdentityResolver
+	root       *os.Root
+
+	mounts    []*LocalFileService
+	mountPath string // path of the mount in the tree, empty for the root
+	etags     *etagCache
+	condLocks *pathLocks
+	usage     *usageCache
+	stageMu   *sync.Mutex    // serializes applying and discarding staged changes
+	identity  *auth.Identity // caller the path rules are evaluated for, see As
 }
 
-// NewLocalFileService constructs a LocalFileServiceImpl with a sanitized absolute root.
-func NewLocalFileService(rootDir string) *LocalFileService {
-	return &LocalFileService{RootDir: rootDir}
+// NewLocalFileService opens rootDir as the root of all file operations.
+func NewLocalFileService(rootDir string, followSymlinks bool) (*LocalFileService, error) {
+	root, err := os.OpenRoot(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalFileService{
+		RootDir:        rootDir,
+		FollowSymlinks: followSymlinks,
+		root:           root,
+		etags:          &etagCache{},
+		condLocks:      &pathLocks{},
+		usage:          &usageCache{},
+		stageMu:        &sync.Mutex{},
+	}, nil
 }
 
-// resolve joins the root and relative path, cleans it, and ensures it stays within RootDir.
+// resolve cleans rel into a path relative to the root, rejecting paths that
+// lexically leave it. The final component is not followed, so the result is
+// suitable for operations on a link itself such as Delete and Rename.
 func (s *LocalFileService) resolve(rel string) (string, error) {
 	// treat leading slash as relative from root, trim it
-	rel = strings.TrimPrefix(rel, "/")
-	joined := filepath.Join(s.RootDir, rel)
-	cleaned := filepath.Clean(joined)
-	abs, err := filepath.Abs(cleaned)
+	name := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(rel, "/")))
+	if !filepath.IsLocal(name) {
+		return "", ErrPathTraversal
+	}
+	if isReserved(name) {
+		return "", ErrReservedPath
+	}
+	if err := s.checkLinks(filepath.Dir(name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// resolveFollow is resolve for operations that dereference the final
+// component, such as reading or writing file content.
+func (s *LocalFileService) resolveFollow(rel string) (string, error) {
+	name, err := s.resolve(rel)
 	if err != nil {
 		return "", err
 	}
-	rootWithSep := s.RootDir
-	if !strings.HasSuffix(rootWithSep, string(os.PathSeparator)) {
-		rootWithSep += string(os.PathSeparator)
+	if err := s.checkLinks(name); err != nil {
+		return "", err
 	}
-	if abs != s.RootDir && !strings.HasPrefix(abs, rootWithSep) {
-		return "", ErrPathTraversal
+	return name, nil
+}
+
+// checkLinks rejects name when it leads through a symlink that may not be
+// followed: any symlink unless FollowSymlinks is set, otherwise one leaving
+// the root, which os.Root refuses to follow.
+func (s *LocalFileService) checkLinks(name string) error {
+	if !s.FollowSymlinks {
+		return s.checkNoSymlinks(name)
 	}
-	return abs, nil
+	if _, escaped := s.walkLinks(name); escaped {
+		return ErrSymlinkNotAllowed
+	}
+	return nil
+}
+
+// checkNoSymlinks rejects name when it or one of its parents is a symlink.
+// Components that do not exist yet are accepted.
+func (s *LocalFileService) checkNoSymlinks(name string) error {
+	for p := name; p != "."; p = filepath.Dir(p) {
+		if fi, err := s.root.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return ErrSymlinkNotAllowed
+		}
+	}
+	return nil
 }
 
-// Stat returns os.FileInfo for the given relative path.
+// pathError translates errors returned by the os.Root methods.
+func pathError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stat returns os.FileInfo for the given relative path. Symlinks that may be
+// followed are reported as their target, others as the link itself.
 func (s *LocalFileService) Stat(rel string) (os.FileInfo, error) {
-	abs, err := s.resolve(rel)
+	fi, err := s.Lstat(rel)
+	if err != nil || fi.Mode()&fs.ModeSymlink == 0 || !s.FollowSymlinks {
+		return fi, err
+	}
+	files, rel := s.locate(rel)
+	name, _ := files.resolve(rel)
+	// dangling links and links leading outside of the root stay links
+	if target, err := files.root.Stat(name); err == nil {
+		return target, nil
+	}
+	return fi, nil
+}
+
+// Lstat is Stat without following a final symlink.
+func (s *LocalFileService) Lstat(rel string) (os.FileInfo, error) {
+	if files, rel := s.locate(rel); files != s {
+		fi, err := files.Lstat(rel)
+		if err == nil && rel == "." {
+			fi, err = statMount(files)
+		}
+		return fi, err
+	}
+	name, err := s.resolve(rel)
 	if err != nil {
 		return nil, err
 	}
-	fi, err := os.Stat(abs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNotFound
-		}
+	if err := s.check(name, accessList); err != nil {
 		return nil, err
 	}
+	fi, err := s.root.Lstat(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
 	return fi, nil
 }
 
-// List lists a directory relative to root.
+// Readlink returns the target of the symlink at rel.
+func (s *LocalFileService) Readlink(rel string) (string, error) {
+	if files, rel := s.locate(rel); files != s {
+		return files.Readlink(rel)
+	}
+	name, err := s.resolve(rel)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkPath(name, accessList); err != nil {
+		return "", err
+	}
+	target, err := s.root.Readlink(name)
+	return target, pathError(err)
+}
+
+// List lists a directory relative to root. Symlinks are listed as links, use
+// Readlink for their targets. Mounts are listed as directories in their
+// parent.
 func (s *LocalFileService) List(rel string) ([]os.FileInfo, error) {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.List(rel)
+	}
+	name, err := s.resolveFollow(rel)
 	if err != nil {
 		return nil, err
 	}
-	fi, err := os.Stat(abs)
+	if err := s.check(name, accessRead); err != nil {
+		return nil, err
+	}
+	dir, err := s.root.Open(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
+	defer dir.Close()
+	fi, err := dir.Stat()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNotFound
-		}
 		return nil, err
 	}
 	if !fi.IsDir() {
 		return nil, ErrNotDirectory
 	}
-	entries, err := os.ReadDir(abs)
+	entries, err := dir.ReadDir(-1)
 	if err != nil {
 		return nil, err
 	}
 	out := make([]os.FileInfo, 0, len(entries))
 	for _, e := range entries {
-		info, err := e.Info()
+		p := filepath.Join(name, e.Name())
+		if isReserved(p) || s.isMountPoint(p) || !s.visible(p) {
+			continue
+		}
+		info, err := s.root.Lstat(filepath.Join(name, e.Name()))
 		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// removed while listing
+				continue
+			}
 			return nil, err
 		}
 		out = append(out, info)
 	}
+	for _, m := range s.mounts {
+		if path.Dir(m.mountPath) != filepath.ToSlash(name) || !m.As(s.identity).visible(".") {
+			continue
+		}
+		info, err := statMount(m)
+		if err != nil {
+			logger.Warnln("Failed to stat mount", "path", m.mountPath, "error", err)
+			continue
+		}
+		out = append(out, info)
+	}
 	return out, nil
 }
 
 // Open returns an opened file for reading; caller must Close.
 func (s *LocalFileService) Open(rel string) (*os.File, os.FileInfo, error) {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.Open(rel)
+	}
+	name, err := s.resolveFollow(rel)
 	if err != nil {
 		return nil, nil, err
 	}
-	fi, err := os.Stat(abs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil, ErrNotFound
-		}
+	if err := s.check(name, accessRead); err != nil {
 		return nil, nil, err
 	}
-	if fi.IsDir() {
-		return nil, nil, ErrIsDirectory
+	f, err := s.root.Open(name)
+	if err != nil {
+		return nil, nil, pathError(err)
 	}
-	f, err := os.Open(abs)
+	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, nil, err
 	}
+	if fi.IsDir() {
+		f.Close()
+		return nil, nil, ErrIsDirectory
+	}
 	return f, fi, nil
 }
 
 // ReadFile reads entire file into memory. For large files, prefer Open and streaming.
 func (s *LocalFileService) ReadFile(rel string) ([]byte, error) {
-	abs, err := s.resolve(rel)
+	f, _, err := s.Open(rel)
 	if err != nil {
 		return nil, err
 	}
-	fi, err := os.Stat(abs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrNotFound
-		}
-		return nil, err
-	}
-	if fi.IsDir() {
-		return nil, ErrIsDirectory
-	}
-	return os.ReadFile(abs)
+	defer f.Close()
+	return io.ReadAll(f)
 }
 
 // WriteFile writes bytes to a file at rel. If create is false and the file doesn't exist, returns ErrNotFound.
 func (s *LocalFileService) WriteFile(rel string, data []byte, create bool) error {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.WriteFile(rel, data, create)
+	}
+	name, err := s.resolveFollow(rel)
 	if err != nil {
 		return err
 	}
-	// ensure parent exists
-	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+	if err := s.check(name, accessWrite); err != nil {
 		return err
 	}
-	if !create {
-		if _, err := os.Stat(abs); err != nil {
-			if os.IsNotExist(err) {
-				return ErrNotFound
-			}
-			return err
-		}
+	// ensure parent exists
+	if err := s.root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return pathError(err)
 	}
-	return os.WriteFile(abs, data, 0o644)
+	var size int64
+	if fi, err := s.root.Stat(name); err == nil {
+		size = fi.Size()
+	} else if !create {
+		return pathError(err)
+	}
+	if err := s.reserve(int64(len(data)) - size); err != nil {
+		return err
+	}
+	s.keepVersion(name)
+	return pathError(s.root.WriteFile(name, data, 0o644))
 }
 
 // SaveStream writes an io.Reader to the destination file. Overwrites when overwrite==true.
+// An existing symlink at rel is replaced rather than written through.
 func (s *LocalFileService) SaveStream(rel string, r io.Reader, overwrite bool) error {
-	abs, err := s.resolve(rel)
+	return s.saveStream(rel, r, overwrite, 0)
+}
+
+// saveStream is SaveStream for content of which the first reserved bytes
+// were already reserved below the root.
+func (s *LocalFileService) saveStream(rel string, r io.Reader, overwrite bool, reserved int64) error {
+	if files, rel := s.locate(rel); files != s {
+		// reservations of the root do not carry over to a mount
+		return files.saveStream(rel, r, overwrite, 0)
+	}
+	name, err := s.resolve(rel)
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+	if err := s.check(name, accessWrite); err != nil {
 		return err
 	}
-	if !overwrite {
-		if _, err := os.Stat(abs); err == nil {
+	if err := s.root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return pathError(err)
+	}
+	// only the growth over a replaced file is reserved
+	size := reserved
+	if fi, err := s.root.Lstat(name); err == nil {
+		if !overwrite {
 			return ErrAlreadyExists
 		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
 	}
-	tmp := abs + ".part"
-	f, err := os.Create(tmp)
+	tmp := name + ".part"
+	f, err := s.root.Create(tmp)
 	if err != nil {
-		return err
+		return pathError(err)
 	}
-	_, copyErr := io.Copy(f, r)
+	_, copyErr := io.Copy(&quotaWriter{files: s, w: f, free: size}, r)
 	closeErr := f.Close()
 	if copyErr != nil {
-		os.Remove(tmp)
+		s.root.Remove(tmp)
 		return copyErr
 	}
 	if closeErr != nil {
-		os.Remove(tmp)
+		s.root.Remove(tmp)
 		return closeErr
 	}
 	// Preserve destination's permissions if it exists
-	if fi, err := os.Stat(abs); err == nil {
-		_ = os.Chmod(tmp, fi.Mode().Perm())
+	if fi, err := s.root.Lstat(name); err == nil && fi.Mode().IsRegular() {
+		_ = s.root.Chmod(tmp, fi.Mode().Perm())
+		s.keepVersion(name)
 	}
-	return os.Rename(tmp, abs)
+	return pathError(s.root.Rename(tmp, name))
 }
 
-// Delete deletes a file or an empty directory.
+// Delete deletes a file, a symlink or an empty directory. With the trash
+// enabled, deleted entries are moved to the trash instead.
 func (s *LocalFileService) Delete(rel string) error {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.Delete(rel)
+	}
+	name, err := s.resolve(rel)
 	if err != nil {
 		return err
 	}
-	fi, err := os.Stat(abs)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return ErrNotFound
-		}
+	if err := s.checkPath(name, accessWrite); err != nil {
+		return err
+	}
+	if err := s.checkMounts(name); err != nil {
 		return err
 	}
+	fi, err := s.root.Lstat(name)
+	if err != nil {
+		return pathError(err)
+	}
 	if fi.IsDir() {
 		// only remove if empty
-		dir, err := os.Open(abs)
+		dir, err := s.root.Open(name)
 		if err != nil {
-			return err
+			return pathError(err)
 		}
 		names, _ := dir.Readdirnames(1)
 		dir.Close()
 		if len(names) > 0 {
 			return ErrDirNotEmpty
 		}
-		return os.Remove(abs)
 	}
-	return os.Remove(abs)
+	return s.remove(name, fi)
 }
 
-// DeleteRecursive deletes a file or directory recursively.
+// DeleteRecursive deletes a file or directory recursively. Symlinks are
+// removed without touching their targets.
 func (s *LocalFileService) DeleteRecursive(rel string) error {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.DeleteRecursive(rel)
+	}
+	name, err := s.resolve(rel)
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stat(abs); err != nil {
-		if os.IsNotExist(err) {
-			return ErrNotFound
-		}
+	if err := s.checkPath(name, accessTree); err != nil {
 		return err
 	}
-	return os.RemoveAll(abs)
+	if err := s.checkMounts(name); err != nil {
+		return err
+	}
+	fi, err := s.root.Lstat(name)
+	if err != nil {
+		return pathError(err)
+	}
+	return s.remove(name, fi)
 }
 
 // MkdirAll creates a directory (and parents) at rel.
 func (s *LocalFileService) MkdirAll(rel string) error {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.MkdirAll(rel)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	if err := s.check(name, accessWrite); err != nil {
+		return err
+	}
+	return pathError(s.root.MkdirAll(name, 0o755))
+}
+
+// Truncate changes the size of the file at rel, cutting it off or extending
+// it with zeros. The previous content is kept as a version.
+func (s *LocalFileService) Truncate(rel string, size int64) error {
+	if files, rel := s.locate(rel); files != s {
+		return files.Truncate(rel, size)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	if err := s.check(name, accessWrite); err != nil {
+		return err
+	}
+	fi, err := s.root.Stat(name)
 	if err != nil {
+		return pathError(err)
+	}
+	if fi.IsDir() {
+		return ErrIsDirectory
+	}
+	if err := s.reserve(size - fi.Size()); err != nil {
 		return err
 	}
-	return os.MkdirAll(abs, 0o755)
+	s.keepVersion(name)
+	f, err := s.root.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return pathError(err)
+	}
+	defer f.Close()
+	return f.Truncate(size)
 }
 
-// RenameDir renames/moves a file or directory to newPath
+// Chtimes sets the access and modification times of the entry at rel.
+func (s *LocalFileService) Chtimes(rel string, mtime time.Time) error {
+	if files, rel := s.locate(rel); files != s {
+		return files.Chtimes(rel, mtime)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	if err := s.check(name, accessWrite); err != nil {
+		return err
+	}
+	return pathError(s.root.Chtimes(name, mtime, mtime))
+}
+
+// RenameDir renames/moves a file or directory to newPath. Moves between
+// mounts copy the entry and delete the source.
 func (s *LocalFileService) Rename(relPath string, newPath string, overwrite bool) error {
 	if strings.TrimSpace(newPath) == "" {
 		return ErrMissingNewName
 	}
+	src, relPath := s.locate(relPath)
+	dst, newPath := s.locate(newPath)
 
 	// Check if current path exists
-	absSrcPath, err := s.resolve(relPath)
+	srcName, err := src.resolve(relPath)
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stat(absSrcPath); err != nil {
-		if os.IsNotExist(err) {
-			return ErrNotFound
-		}
+	if err := src.checkPath(srcName, accessTree); err != nil {
 		return err
 	}
+	if err := src.checkMounts(srcName); err != nil {
+		return err
+	}
+	if _, err := src.root.Lstat(srcName); err != nil {
+		return pathError(err)
+	}
 
-	// Ensure destination remains within root
-	absDstPath, err := s.resolve(newPath)
+	// Ensure destination remains within root and writable
+	dstName, err := dst.resolve(newPath)
 	if err != nil {
 		return err
 	}
+	if err := dst.check(dstName, accessTree); err != nil {
+		return err
+	}
+	sameRoot := src.root == dst.root
+	if !sameRoot && overlaps(src.treePath(srcName), dst.treePath(dstName)) {
+		return ErrOverlappingPaths
+	}
 
-	// if overwrite is false, check existence and return error
-	if !overwrite {
-		if _, err := os.Stat(absDstPath); err == nil {
+	// if overwrite is false, check existence and return error, otherwise
+	// keep the replaced entry in the trash
+	if fi, err := dst.root.Lstat(dstName); err == nil {
+		if !overwrite {
 			return ErrAlreadyExists
 		}
+		if err := dst.checkMounts(dstName); err != nil {
+			return err
+		}
+		if !sameRoot {
+			if err := dst.remove(dstName, fi); err != nil {
+				return err
+			}
+		} else if dst.Trash != nil && srcName != dstName {
+			if err := dst.moveToTrash(dstName, fi); err != nil {
+				return err
+			}
+		}
 	}
-
-	return os.Rename(absSrcPath, absDstPath)
+	if !sameRoot {
+		if err := dst.root.MkdirAll(filepath.Dir(dstName), 0o755); err != nil {
+			return pathError(err)
+		}
+		return src.move(srcName, dst, dstName)
+	}
+	return pathError(src.root.Rename(srcName, dstName))
 }
 
 // DetectMIME tries to infer MIME type by extension or content.
 func (s *LocalFileService) DetectMIMEType(rel string) (string, error) {
-	abs, err := s.resolve(rel)
+	if files, rel := s.locate(rel); files != s {
+		return files.DetectMIMEType(rel)
+	}
+	name, err := s.resolveFollow(rel)
 	if err != nil {
 		return "", err
 	}
-	if ext := filepath.Ext(abs); ext != "" {
+	if err := s.check(name, accessRead); err != nil {
+		return "", err
+	}
+	if ext := filepath.Ext(name); ext != "" {
 		if mt := mime.TypeByExtension(ext); mt != "" {
 			return mt, nil
 		}
 	}
 	// Fallback: read a small sample
-	f, err := os.Open(abs)
+	f, err := s.root.Open(name)
 	if err != nil {
-		return "", err
+		return "", pathError(err)
 	}
 	defer f.Close()
 	buf := make([]byte, 512)
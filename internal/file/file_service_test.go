@@ -0,0 +1,136 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+// newTestService returns a service on a temporary root holding world/level.dat
+// and plugins, next to a secret file outside of the root.
+func newTestService(t *testing.T, followSymlinks bool) (*LocalFileService, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for name, data := range map[string]string{
+		"secret.txt":            "secret",
+		"root/world/level.dat":  "level",
+		"root/plugins/conf.yml": "conf",
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := NewLocalFileService(root, followSymlinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { files.root.Close() })
+	return files, root
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSymlinksLeavingRoot(t *testing.T) {
+	files, root := newTestService(t, true)
+	symlink(t, "../secret.txt", filepath.Join(root, "up.txt"))
+	symlink(t, filepath.Join(filepath.Dir(root), "secret.txt"), filepath.Join(root, "abs.txt"))
+	symlink(t, "..", filepath.Join(root, "parent"))
+	// a link inside the root leading to one that leaves it
+	symlink(t, "parent", filepath.Join(root, "chain"))
+	symlink(t, "../world", filepath.Join(root, "plugins", "world"))
+	symlink(t, "world/level.dat", filepath.Join(root, "level.dat"))
+
+	tests := []struct {
+		name string
+		want error
+	}{
+		{"up.txt", ErrSymlinkNotAllowed},
+		{"abs.txt", ErrSymlinkNotAllowed},
+		{"parent/secret.txt", ErrSymlinkNotAllowed},
+		{"chain/secret.txt", ErrSymlinkNotAllowed},
+		{"plugins/world/level.dat", nil},
+		{"level.dat", nil},
+		{"../secret.txt", ErrPathTraversal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := files.ReadFile(tt.name); !errors.Is(err, tt.want) {
+				t.Fatalf("ReadFile err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// the link itself may still be looked at and removed
+	if fi, err := files.Lstat("up.txt"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Lstat = %v, %v, want the link", fi, err)
+	}
+	if err := files.Delete("up.txt"); err != nil {
+		t.Fatalf("Delete err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "secret.txt")); err != nil {
+		t.Fatalf("link target removed: %v", err)
+	}
+}
+
+func TestSymlinksNotFollowed(t *testing.T) {
+	files, root := newTestService(t, false)
+	symlink(t, "../world", filepath.Join(root, "plugins", "world"))
+	symlink(t, "world/level.dat", filepath.Join(root, "level.dat"))
+
+	for _, name := range []string{"plugins/world/level.dat", "level.dat"} {
+		if _, err := files.ReadFile(name); !errors.Is(err, ErrSymlinkNotAllowed) {
+			t.Fatalf("ReadFile(%s) err = %v, want %v", name, err, ErrSymlinkNotAllowed)
+		}
+	}
+	if _, err := files.ReadFile("world/level.dat"); err != nil {
+		t.Fatalf("ReadFile err = %v", err)
+	}
+}
+
+func TestAllowedPaths(t *testing.T) {
+	root, dir := newTestService(t, true)
+	symlink(t, "../world/level.dat", filepath.Join(dir, "plugins", "level.dat"))
+	files := root.As(&auth.Identity{Name: "panel", Paths: []string{"plugins/conf.yml", "plugins/level.dat"}})
+
+	if _, err := files.ReadFile("plugins/conf.yml"); err != nil {
+		t.Fatalf("ReadFile err = %v", err)
+	}
+	// the link is inside the allowed paths, what it leads to is not
+	if _, err := files.ReadFile("plugins/level.dat"); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("ReadFile(link) err = %v, want %v", err, ErrPathNotAllowed)
+	}
+	if err := files.WriteFile("plugins/level.dat", []byte("x"), true); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("WriteFile(link) err = %v, want %v", err, ErrPathNotAllowed)
+	}
+	if _, err := files.ReadFile("world/level.dat"); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("ReadFile err = %v, want %v", err, ErrPathNotAllowed)
+	}
+
+	// parents of allowed paths are listed down to them, not changed
+	items, err := files.List(".")
+	if err != nil {
+		t.Fatalf("List err = %v", err)
+	}
+	if len(items) != 1 || items[0].Name() != "plugins" {
+		t.Fatalf("List = %v, want only plugins", items)
+	}
+	if err := files.MkdirAll("plugins/new"); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("MkdirAll err = %v, want %v", err, ErrPathNotAllowed)
+	}
+	if err := files.Rename("plugins/conf.yml", "conf.yml", false); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("Rename err = %v, want %v", err, ErrPathNotAllowed)
+	}
+}
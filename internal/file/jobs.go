@@ -0,0 +1,316 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+type BatchOpType string
+
+const (
+	BatchCopy   BatchOpType = "copy"
+	BatchMove   BatchOpType = "move"
+	BatchDelete BatchOpType = "delete"
+)
+
+// BatchOp is a single operation of a batch.
+type BatchOp struct {
+	Op        BatchOpType `json:"op"`
+	Path      string      `json:"path"`
+	NewPath   string      `json:"newPath,omitempty"` // destination of copy and move
+	Overwrite bool        `json:"overwrite,omitempty"`
+	Recursive bool        `json:"recursive,omitempty"` // delete non-empty directories
+}
+
+// Validate checks that the operation is complete.
+func (op BatchOp) Validate() error {
+	switch op.Op {
+	case BatchCopy, BatchMove:
+		if strings.TrimSpace(op.NewPath) == "" {
+			return fmt.Errorf("%w: %s requires newPath", ErrInvalidBatchOp, op.Op)
+		}
+	case BatchDelete:
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidBatchOp, op.Op)
+	}
+	if strings.TrimSpace(op.Path) == "" {
+		return fmt.Errorf("%w: %s requires path", ErrInvalidBatchOp, op.Op)
+	}
+	return nil
+}
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// BatchProgress reports the progress of a batch job.
+type BatchProgress struct {
+	Operations  int   `json:"operations"`
+	Completed   int   `json:"completed"` // operations done, including failed ones
+	Failed      int   `json:"failed"`
+	BytesTotal  int64 `json:"bytesTotal"` // bytes to copy
+	BytesCopied int64 `json:"bytesCopied"`
+}
+
+// Job describes a batch of file operations running in the background.
+type Job struct {
+	ID         string        `json:"id"`
+	Status     JobStatus     `json:"status"`
+	Progress   BatchProgress `json:"progress"`
+	Operations []BatchOp     `json:"-"`
+	Errors     []error       `json:"-"` // result of each operation, nil on success
+	Owner      string        `json:"-"` // id of the identity that started the job
+	CreatedAt  time.Time     `json:"createdAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+type batchJob struct {
+	Job
+	mu     sync.Mutex
+	files  *LocalFileService // evaluates the path rules for the owner
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// snapshot returns a copy of the job that is safe to use after unlocking.
+func (j *batchJob) snapshot() Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.Job
+	job.Errors = append([]error(nil), j.Errors...)
+	return job
+}
+
+// JobManager runs batches of copy, move and delete operations in the
+// background so that long copies are not bound to a request. Finished jobs are
+// kept for the configured retention so that clients can fetch their results.
+type JobManager struct {
+	files     *LocalFileService
+	retention time.Duration
+	mu        sync.Mutex
+	jobs      map[string]*batchJob
+}
+
+func NewJobManager(files *LocalFileService, retention time.Duration) *JobManager {
+	return &JobManager{
+		files:     files,
+		retention: retention,
+		jobs:      make(map[string]*batchJob),
+	}
+}
+
+// StartBatch validates ops and runs them in order in a new job of identity. A
+// failed operation does not stop the following ones.
+func (m *JobManager) StartBatch(ops []BatchOp, identity *auth.Identity) (Job, error) {
+	if len(ops) == 0 {
+		return Job{}, fmt.Errorf("%w: no operations", ErrInvalidBatchOp)
+	}
+	for _, op := range ops {
+		if err := op.Validate(); err != nil {
+			return Job{}, err
+		}
+	}
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	var owner string
+	if identity != nil {
+		owner = identity.ID
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &batchJob{
+		Job: Job{
+			ID:         id,
+			Status:     JobRunning,
+			Progress:   BatchProgress{Operations: len(ops)},
+			Operations: ops,
+			Errors:     make([]error, len(ops)),
+			Owner:      owner,
+			CreatedAt:  time.Now().UTC(),
+		},
+		files:  m.files.As(identity),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.jobs[id] = j
+	m.mu.Unlock()
+
+	go m.run(ctx, j)
+	return j.snapshot(), nil
+}
+
+func (m *JobManager) run(ctx context.Context, j *batchJob) {
+	defer close(j.done)
+	defer j.cancel()
+
+	// sizes are only known upfront for copies, moves are renames
+	for _, op := range j.Operations {
+		if op.Op != BatchCopy {
+			continue
+		}
+		files, rel := j.files.locate(op.Path)
+		if name, err := files.resolve(rel); err == nil {
+			if size, err := files.treeSize(name); err == nil {
+				j.mu.Lock()
+				j.Progress.BytesTotal += size
+				j.mu.Unlock()
+			}
+		}
+	}
+
+	written := func(n int64) {
+		j.mu.Lock()
+		j.Progress.BytesCopied += n
+		j.mu.Unlock()
+	}
+	for i, op := range j.Operations {
+		err := ctx.Err()
+		if err == nil {
+			err = apply(ctx, j.files, op, written)
+		}
+		j.mu.Lock()
+		j.Errors[i] = err
+		j.Progress.Completed++
+		if err != nil {
+			j.Progress.Failed++
+		}
+		j.mu.Unlock()
+	}
+
+	now := time.Now().UTC()
+	j.mu.Lock()
+	j.Status = JobCompleted
+	if ctx.Err() != nil {
+		j.Status = JobCanceled
+	}
+	j.FinishedAt = &now
+	j.mu.Unlock()
+}
+
+func apply(ctx context.Context, files *LocalFileService, op BatchOp, written func(n int64)) error {
+	switch op.Op {
+	case BatchCopy:
+		return files.copy(ctx, op.Path, op.NewPath, op.Overwrite, written)
+	case BatchMove:
+		return files.Rename(op.Path, op.NewPath, op.Overwrite)
+	case BatchDelete:
+		if op.Recursive {
+			return files.DeleteRecursive(op.Path)
+		}
+		return files.Delete(op.Path)
+	}
+	return ErrInvalidBatchOp
+}
+
+func (m *JobManager) get(id string) (*batchJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// Get returns the current state of a job.
+func (m *JobManager) Get(id string) (Job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return j.snapshot(), nil
+}
+
+// Wait waits up to timeout for a job to finish and returns its state, which
+// is still running when the timeout expires first.
+func (m *JobManager) Wait(id string, timeout time.Duration) (Job, error) {
+	j, err := m.get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-j.done:
+	case <-timer.C:
+	}
+	return j.snapshot(), nil
+}
+
+// List returns the jobs started by the identity with the owner id, or all
+// jobs when all is set, oldest first.
+func (m *JobManager) List(owner string, all bool) []Job {
+	m.mu.Lock()
+	var jobs []*batchJob
+	for _, j := range m.jobs {
+		if all || j.Owner == owner {
+			jobs = append(jobs, j)
+		}
+	}
+	m.mu.Unlock()
+
+	out := make([]Job, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, j.snapshot())
+	}
+	slices.SortFunc(out, func(a, b Job) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return out
+}
+
+// Cancel stops a running job. The partially copied file is removed and the
+// operations that did not start fail with context.Canceled.
+func (m *JobManager) Cancel(id string) error {
+	j, err := m.get(id)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-j.done:
+		return ErrJobFinished
+	default:
+	}
+	j.cancel()
+	return nil
+}
+
+// expire removes jobs that finished more than the retention ago.
+func (m *JobManager) expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, j := range m.jobs {
+		j.mu.Lock()
+		finishedAt := j.FinishedAt
+		j.mu.Unlock()
+		if finishedAt != nil && now.Sub(*finishedAt) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// ExpireLoop periodically removes finished jobs until done is closed.
+func (m *JobManager) ExpireLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(min(m.retention, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.expire(now)
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Mount attaches a directory outside of the root to the tree, such as the
+// backup directory or a plugin volume shared between servers.
+type Mount struct {
+	Path     string `json:"path"` // slash separated, relative to the root
+	Dir      string `json:"dir"`  // host directory
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	// Rules are path rules relative to the mount, evaluated before the rules
+	// of the root.
+	Rules []PathRule `json:"rules,omitempty"`
+}
+
+// LoadMounts reads a JSON array of mounts from a file.
+func LoadMounts(filename string) ([]Mount, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var mounts []Mount
+	if err := json.Unmarshal(data, &mounts); err != nil {
+		return nil, fmt.Errorf("invalid mounts %s: %v", filename, err)
+	}
+	return mounts, nil
+}
+
+// AddMount attaches m to the tree. Paths below m.Path are served from m.Dir,
+// which shadows anything at m.Path in the root. The mount inherits the
+// current trash, version and path rule settings, so they must be set first.
+// Mounts cannot be nested.
+func (s *LocalFileService) AddMount(m Mount) error {
+	name := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(m.Path, "/")))
+	if !filepath.IsLocal(name) || name == "." || isReserved(name) {
+		return fmt.Errorf("invalid mount path %q", m.Path)
+	}
+	prefix := filepath.ToSlash(name)
+	for _, other := range s.mounts {
+		if within(prefix, other.mountPath) || within(other.mountPath, prefix) {
+			return fmt.Errorf("mount %s overlaps mount %s", prefix, other.mountPath)
+		}
+	}
+	dir, err := filepath.Abs(m.Dir)
+	if err != nil {
+		return err
+	}
+	mounted, err := NewLocalFileService(dir, s.FollowSymlinks)
+	if err != nil {
+		return fmt.Errorf("mount %s: %w", prefix, err)
+	}
+	policy := &Policy{Rules: m.Rules, parent: s.Policy, base: splitPath(name)}
+	if err := policy.compile(); err != nil {
+		return fmt.Errorf("mount %s: %v", prefix, err)
+	}
+	mounted.Policy = policy
+	mounted.ReadOnly = m.ReadOnly
+	mounted.mountPath = prefix
+	if !m.ReadOnly {
+		mounted.Trash = s.Trash
+		mounted.Versions = s.Versions
+	}
+	// the mount point is listed in its parent directory
+	if err := s.root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return pathError(err)
+	}
+	s.mounts = append(s.mounts, mounted)
+	return nil
+}
+
+// locate returns the service holding rel, as seen by the caller, and the
+// path of rel relative to its root. Paths outside of the mounts are held by s
+// itself and returned unchanged.
+func (s *LocalFileService) locate(rel string) (*LocalFileService, string) {
+	if len(s.mounts) == 0 {
+		return s, rel
+	}
+	name := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(rel, "/")))
+	if !filepath.IsLocal(name) {
+		// rejected by resolve
+		return s, rel
+	}
+	p := filepath.ToSlash(name)
+	for _, m := range s.mounts {
+		if within(p, m.mountPath) {
+			sub := strings.TrimPrefix(strings.TrimPrefix(p, m.mountPath), "/")
+			if sub == "" {
+				sub = "."
+			}
+			return m.As(s.identity), sub
+		}
+	}
+	return s, rel
+}
+
+// services returns s and its mounts as seen by the caller.
+func (s *LocalFileService) services() []*LocalFileService {
+	out := []*LocalFileService{s}
+	for _, m := range s.mounts {
+		out = append(out, m.As(s.identity))
+	}
+	return out
+}
+
+// treePath returns the slash separated path in the tree of the name relative
+// to the root of s.
+func (s *LocalFileService) treePath(name string) string {
+	return path.Join(s.mountPath, filepath.ToSlash(name))
+}
+
+// isMountPoint reports whether the root-relative name is shadowed by a mount.
+func (s *LocalFileService) isMountPoint(name string) bool {
+	p := filepath.ToSlash(name)
+	for _, m := range s.mounts {
+		if within(p, m.mountPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMounts rejects removing or replacing the entry at the root-relative
+// name when it is a mount point or contains one.
+func (s *LocalFileService) checkMounts(name string) error {
+	if s.mountPath != "" && name == "." {
+		return ErrMountPoint
+	}
+	p := filepath.ToSlash(name)
+	for _, m := range s.mounts {
+		if within(m.mountPath, p) {
+			return ErrMountPoint
+		}
+	}
+	return nil
+}
+
+// mountInfo names the root of a mount after its mount point.
+type mountInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi mountInfo) Name() string { return fi.name }
+
+// statMount returns the info of the mount root of m listed in its parent.
+func statMount(m *LocalFileService) (os.FileInfo, error) {
+	fi, err := m.root.Stat(".")
+	if err != nil {
+		return nil, err
+	}
+	return mountInfo{fi, path.Base(m.mountPath)}, nil
+}
+
+// walkTree walks the tree at the root-relative name like fs.WalkDir, going on
+// into the mounts below it unless their parent directory was skipped. fn is
+// called with the service holding each entry and the entry's name relative to
+// that service's root.
+func (s *LocalFileService) walkTree(name string, fn func(files *LocalFileService, name string, d fs.DirEntry, err error) error) error {
+	if files, sub := s.locate(name); files != s {
+		return files.walkTree(sub, fn)
+	}
+	start := filepath.ToSlash(name)
+	var skipped []string
+	stopped := false
+	visit := func(files *LocalFileService) fs.WalkDirFunc {
+		return func(p string, d fs.DirEntry, err error) error {
+			if files == s && p != start && s.isMountPoint(p) {
+				// shadowed, the mount is walked below
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			err = fn(files, filepath.FromSlash(p), d, err)
+			switch {
+			case err == fs.SkipDir && d != nil && d.IsDir():
+				skipped = append(skipped, files.treePath(p))
+			case err == fs.SkipAll:
+				stopped = true
+			}
+			return err
+		}
+	}
+	if err := fs.WalkDir(s.root.FS(), start, visit(s)); err != nil || stopped {
+		return err
+	}
+	for _, m := range s.mounts {
+		if !within(m.mountPath, s.treePath(start)) {
+			continue
+		}
+		if slices.ContainsFunc(skipped, func(dir string) bool { return within(m.mountPath, dir) }) {
+			continue
+		}
+		if err := fs.WalkDir(m.root.FS(), ".", visit(m.As(s.identity))); err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostPath returns the host path of the slash separated tree path p.
+func (s *LocalFileService) hostPath(p string) string {
+	files, rel := s.locate(p)
+	return filepath.Join(files.RootDir, filepath.FromSlash(rel))
+}
+
+// fromHost returns the service holding the host path abs and the name of abs
+// relative to its root. Paths outside of the tree and paths shadowed by a
+// mount are not held by any service.
+func (s *LocalFileService) fromHost(abs string) (*LocalFileService, string, bool) {
+	for _, files := range append(slices.Clip(s.mounts), s) {
+		rel, err := filepath.Rel(files.RootDir, abs)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if files == s && s.isMountPoint(rel) {
+			return nil, "", false
+		}
+		return files, rel, true
+	}
+	return nil, "", false
+}
@@ -0,0 +1,382 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+type RuleAction string
+
+const (
+	RuleAllow    RuleAction = "allow"
+	RuleDeny     RuleAction = "deny"     // listed, but neither readable nor writable
+	RuleReadOnly RuleAction = "readonly" // readable, not writable
+	RuleHidden   RuleAction = "hidden"   // not listed and reported as not found
+)
+
+// PathRule applies an action to the paths matching a pattern. Patterns are
+// slash separated globs relative to the root, where "**" matches any number
+// of directories. A pattern matching a directory also applies to everything
+// below it.
+type PathRule struct {
+	Pattern string     `json:"pattern"`
+	Action  RuleAction `json:"action"`
+	// Except lists scopes whose holders are not subject to the rule. The admin
+	// scope implies every scope.
+	Except []auth.Scope `json:"except,omitempty"`
+	// WhileRunning limits the rule to when the Minecraft server is running.
+	WhileRunning bool `json:"whileRunning,omitempty"`
+
+	segments []string
+}
+
+// Policy restricts the paths available through the file service. Rules are
+// evaluated in order and the first rule matching a path decides, paths not
+// matched by any rule are allowed.
+type Policy struct {
+	Rules []PathRule `json:"rules"`
+	// Running reports whether the server is running, for WhileRunning rules.
+	Running func() bool `json:"-"`
+
+	parent *Policy  // policy of the root, for the policy of a mount
+	base   []string // path of the mount in the root
+}
+
+// LoadPolicy reads path rules from a JSON file.
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid path rules %s: %v", filename, err)
+	}
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid path rules %s: %v", filename, err)
+	}
+	return &policy, nil
+}
+
+func (p *Policy) compile() error {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		switch rule.Action {
+		case RuleAllow, RuleDeny, RuleReadOnly, RuleHidden:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i+1, rule.Action)
+		}
+		pattern := strings.Trim(path.Clean("/"+rule.Pattern), "/")
+		if pattern == "" {
+			return fmt.Errorf("rule %d: missing pattern", i+1)
+		}
+		rule.segments = strings.Split(pattern, "/")
+		for _, seg := range rule.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Errorf("rule %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchPrefix reports whether the pattern matches p or one of its parents.
+func matchPrefix(pattern, p []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(p); i++ {
+				if matchPrefix(pattern[1:], p[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(p) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], p[0]); !ok {
+			return false
+		}
+		pattern, p = pattern[1:], p[1:]
+	}
+	return true
+}
+
+// mayMatchBelow reports whether the pattern may match p or a path below it.
+func mayMatchBelow(pattern, p []string) bool {
+	for ; len(p) > 0; pattern, p = pattern[1:], p[1:] {
+		if len(pattern) == 0 || pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], p[0]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(name string) []string {
+	if name == "." || name == "" {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(name), "/")
+}
+
+func (p *Policy) running() bool {
+	for ; p != nil; p = p.parent {
+		if p.Running != nil {
+			return p.Running()
+		}
+	}
+	return false
+}
+
+// applies reports whether the rule is in effect for identity.
+func (p *Policy) applies(rule *PathRule, identity *auth.Identity) bool {
+	if rule.WhileRunning && !p.running() {
+		return false
+	}
+	if identity != nil {
+		for _, scope := range rule.Except {
+			if identity.HasScope(scope) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// action returns the action of the first rule in effect matching the path
+// segments. The rules of a mount are followed by those of the root.
+func (p *Policy) action(segments []string, identity *auth.Identity) (RuleAction, *PathRule) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if p.applies(rule, identity) && matchPrefix(rule.segments, segments) {
+			return rule.Action, rule
+		}
+	}
+	if p.parent != nil {
+		return p.parent.action(append(slices.Clip(p.base), segments...), identity)
+	}
+	return RuleAllow, nil
+}
+
+// restrictedBelow returns a rule in effect other than allow that may match
+// the path segments or a path below them.
+func (p *Policy) restrictedBelow(segments []string, identity *auth.Identity) *PathRule {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Action != RuleAllow && p.applies(rule, identity) && mayMatchBelow(rule.segments, segments) {
+			return rule
+		}
+	}
+	if p.parent != nil {
+		return p.parent.restrictedBelow(append(slices.Clip(p.base), segments...), identity)
+	}
+	return nil
+}
+
+// maxSymlinkHops bounds the symlinks resolved for a single path
+const maxSymlinkHops = 40
+
+type access int
+
+const (
+	accessList  access = iota // see the entry and its metadata
+	accessRead                // read the content
+	accessWrite               // change or remove the entry
+	accessTree                // change or remove the entry and everything below it
+)
+
+// check evaluates the allowed paths of the caller and the path rules for an
+// access to the root-relative name. Hidden paths are reported as not found.
+// When symlinks are followed, the path the links lead to must be allowed too.
+func (s *LocalFileService) check(name string, a access) error {
+	if s.Policy == nil && !s.ReadOnly && (s.identity == nil || len(s.identity.Paths) == 0) {
+		return nil
+	}
+	if err := s.checkPath(name, a); err != nil {
+		return err
+	}
+	if s.FollowSymlinks {
+		if real := s.realPath(name); real != filepath.ToSlash(name) {
+			return s.checkPath(real, a)
+		}
+	}
+	return nil
+}
+
+// realPath resolves the symlinks in the root-relative name as far as they
+// stay inside the root, returning a slash separated path.
+func (s *LocalFileService) realPath(name string) string {
+	real, _ := s.walkLinks(name)
+	return real
+}
+
+// walkLinks is realPath, also reporting whether a symlink on name leads
+// outside of the root.
+func (s *LocalFileService) walkLinks(name string) (string, bool) {
+	escaped := false
+	pending := splitPath(name)
+	var resolved []string
+	for hops := 0; len(pending) > 0; {
+		cur := path.Join(append(resolved, pending[0])...)
+		fi, err := s.root.Lstat(filepath.FromSlash(cur))
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 || hops >= maxSymlinkHops {
+			resolved = append(resolved, pending[0])
+			pending = pending[1:]
+			continue
+		}
+		hops++
+		target, err := s.root.Readlink(filepath.FromSlash(cur))
+		joined := path.Join(path.Join(resolved...), filepath.ToSlash(target))
+		if err != nil || path.IsAbs(target) || !filepath.IsLocal(joined) {
+			// links leaving the root are never followed
+			escaped = escaped || err == nil
+			resolved = append(resolved, pending[0])
+			pending = pending[1:]
+			continue
+		}
+		pending = append(splitPath(joined), pending[1:]...)
+		resolved = nil
+	}
+	if len(resolved) == 0 {
+		return ".", escaped
+	}
+	return path.Join(resolved...), escaped
+}
+
+// checkPath is check without resolving symlinks, for operations on the link
+// itself.
+func (s *LocalFileService) checkPath(name string, a access) error {
+	if s.ReadOnly && a >= accessWrite {
+		return ErrReadOnlyMount
+	}
+	if err := s.checkAllowedPaths(name, a); err != nil {
+		return err
+	}
+	if s.Policy == nil {
+		return nil
+	}
+	action, rule := s.Policy.action(splitPath(name), s.identity)
+	switch {
+	case action == RuleHidden:
+		return ErrNotFound
+	case action == RuleDeny && a != accessList:
+		return ErrAccessDenied
+	case action == RuleReadOnly && a >= accessWrite:
+		if rule.WhileRunning {
+			return ErrReadOnlyWhileRunning
+		}
+		return ErrReadOnlyPath
+	}
+	if a == accessTree && s.isDir(name) {
+		// removing or moving a directory must not take restricted entries
+		// below it along
+		if rule := s.Policy.restrictedBelow(splitPath(name), s.identity); rule != nil {
+			return fmt.Errorf("%w: %s is restricted", ErrAccessDenied, rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// checkAllowedPaths restricts callers with allowed paths to them. The parent
+// directories of an allowed path can be listed, so that the caller can browse
+// down to it, but not changed.
+func (s *LocalFileService) checkAllowedPaths(name string, a access) error {
+	if s.identity == nil {
+		return nil
+	}
+	p := s.treePath(name)
+	if s.identity.CanAccessPath(p) {
+		return nil
+	}
+	if !s.identity.CanSeePath(p) || a >= accessWrite {
+		return ErrPathNotAllowed
+	}
+	if a == accessRead {
+		// parents are only read to list them
+		if fi, err := s.root.Stat(name); err != nil || !fi.IsDir() {
+			return ErrPathNotAllowed
+		}
+	}
+	return nil
+}
+
+// allowed reports whether the root-relative name is inside the allowed paths
+// of the caller, not only a parent directory of one, and so is the path its
+// symlinks lead to. It is for entries that no longer or not yet exist, such
+// as trash items and staged changes.
+func (s *LocalFileService) allowed(name string) bool {
+	if s.identity == nil || len(s.identity.Paths) == 0 {
+		return true
+	}
+	if s.checkAllowedPaths(name, accessWrite) != nil {
+		return false
+	}
+	return !s.FollowSymlinks || s.checkAllowedPaths(filepath.FromSlash(s.realPath(name)), accessWrite) == nil
+}
+
+// CheckRead returns the error reading the entry at rel fails with under the
+// path rules, or nil when it may be read.
+func (s *LocalFileService) CheckRead(rel string) error {
+	if files, rel := s.locate(rel); files != s {
+		return files.CheckRead(rel)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	return s.check(name, accessRead)
+}
+
+// CheckWrite returns the error writing the file at rel fails with under the
+// path rules, or nil when it may be written. It does not check whether the
+// file can be created.
+func (s *LocalFileService) CheckWrite(rel string) error {
+	if files, rel := s.locate(rel); files != s {
+		return files.CheckWrite(rel)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return err
+	}
+	if s.isDir(name) {
+		return ErrIsDirectory
+	}
+	return s.check(name, accessWrite)
+}
+
+// isDir reports whether the root-relative name is a directory, not following
+// a final symlink.
+func (s *LocalFileService) isDir(name string) bool {
+	fi, err := s.root.Lstat(name)
+	return err == nil && fi.IsDir()
+}
+
+// readable reports whether the root-relative name may be read, for walks that
+// skip what the caller may not see.
+func (s *LocalFileService) readable(name string) bool {
+	return s.check(name, accessRead) == nil
+}
+
+// visible reports whether the root-relative name is listed.
+func (s *LocalFileService) visible(name string) bool {
+	return s.check(name, accessList) == nil
+}
+
+// As returns a view of the service that evaluates the path rules for
+// identity. The view shares the root and all state with s.
+func (s *LocalFileService) As(identity *auth.Identity) *LocalFileService {
+	view := *s
+	view.identity = identity
+	return &view
+}
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+func newTestPolicy(t *testing.T, rules ...PathRule) *Policy {
+	t.Helper()
+	policy := &Policy{Rules: rules}
+	if err := policy.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func writeTestFiles(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPolicyPrecedence(t *testing.T) {
+	running := false
+	policy := newTestPolicy(t,
+		PathRule{Pattern: "plugins/*/config.yml", Action: RuleAllow},
+		PathRule{Pattern: "plugins/**/*.yml", Action: RuleReadOnly},
+		PathRule{Pattern: "plugins/secret", Action: RuleHidden},
+		PathRule{Pattern: "**/*.log", Action: RuleDeny},
+		PathRule{Pattern: "server.properties", Action: RuleReadOnly, Except: []auth.Scope{auth.ScopeConsoleWrite}},
+		PathRule{Pattern: "world", Action: RuleReadOnly, WhileRunning: true},
+	)
+	policy.Running = func() bool { return running }
+	console := &auth.Identity{Name: "console", Scopes: []auth.Scope{auth.ScopeConsoleWrite}}
+	admin := &auth.Identity{Name: "admin", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	reader := &auth.Identity{Name: "reader", Scopes: []auth.Scope{auth.ScopeFilesRead}}
+
+	tests := []struct {
+		name     string
+		path     string
+		identity *auth.Identity
+		running  bool
+		want     RuleAction
+	}{
+		{"first match wins", "plugins/Essentials/config.yml", nil, false, RuleAllow},
+		{"later rule", "plugins/Essentials/messages.yml", nil, false, RuleReadOnly},
+		{"double star spans directories", "plugins/a/b/c.yml", nil, false, RuleReadOnly},
+		{"double star matches no directory", "plugins/conf.yml", nil, false, RuleReadOnly},
+		{"unmatched", "plugins/Essentials.jar", nil, false, RuleAllow},
+		{"directory rule applies below", "plugins/secret/key.pem", nil, false, RuleHidden},
+		{"segments match whole names", "plugins/secretive/key.pem", nil, false, RuleAllow},
+		{"leading double star at top", "latest.log", nil, false, RuleDeny},
+		{"leading double star below", "logs/2026/latest.log", nil, false, RuleDeny},
+		{"earlier rule over later glob", "plugins/secret/debug.log", nil, false, RuleHidden},
+		{"except without identity", "server.properties", nil, false, RuleReadOnly},
+		{"except other scope", "server.properties", reader, false, RuleReadOnly},
+		{"except scope", "server.properties", console, false, RuleAllow},
+		{"except implied by admin", "server.properties", admin, false, RuleAllow},
+		{"while running, stopped", "world/region/r.0.0.mca", nil, false, RuleAllow},
+		{"while running, running", "world/region/r.0.0.mca", nil, true, RuleReadOnly},
+		{"while running, other path", "world_nether/level.dat", nil, true, RuleAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running = tt.running
+			if got, _ := policy.action(splitPath(tt.path), tt.identity); got != tt.want {
+				t.Fatalf("action(%s) = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyChecks(t *testing.T) {
+	files, root := newTestService(t, true)
+	writeTestFiles(t, root, "plugins/secret/key.pem", "config/server.yml", "logs/latest.log")
+	symlink(t, "plugins/secret/key.pem", filepath.Join(root, "key.pem"))
+	symlink(t, "logs/latest.log", filepath.Join(root, "latest.log"))
+	symlink(t, "config", filepath.Join(root, "cfg"))
+	files.Policy = newTestPolicy(t,
+		PathRule{Pattern: "plugins/secret", Action: RuleHidden},
+		PathRule{Pattern: "config", Action: RuleReadOnly},
+		PathRule{Pattern: "logs", Action: RuleDeny},
+	)
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"read hidden", func() error { _, err := files.ReadFile("plugins/secret/key.pem"); return err }, ErrNotFound},
+		{"stat hidden", func() error { _, err := files.Stat("plugins/secret"); return err }, ErrNotFound},
+		{"stat denied", func() error { _, err := files.Stat("logs/latest.log"); return err }, nil},
+		{"read denied", func() error { _, err := files.ReadFile("logs/latest.log"); return err }, ErrAccessDenied},
+		{"list denied", func() error { _, err := files.List("logs"); return err }, ErrAccessDenied},
+		{"read readonly", func() error { _, err := files.ReadFile("config/server.yml"); return err }, nil},
+		{"write readonly", func() error { return files.WriteFile("config/server.yml", nil, true) }, ErrReadOnlyPath},
+		{"create in readonly", func() error { return files.WriteFile("config/new.yml", nil, true) }, ErrReadOnlyPath},
+
+		{"rename into readonly", func() error { return files.Rename("plugins/conf.yml", "config/conf.yml", false) }, ErrReadOnlyPath},
+		{"rename into hidden", func() error { return files.Rename("plugins/conf.yml", "plugins/secret/conf.yml", false) }, ErrNotFound},
+		{"rename into denied", func() error { return files.Rename("plugins/conf.yml", "logs/conf.yml", false) }, ErrAccessDenied},
+		{"rename over link to readonly", func() error { return files.Rename("plugins/conf.yml", "cfg/conf.yml", false) }, ErrReadOnlyPath},
+		{"rename denied source", func() error { return files.Rename("logs/latest.log", "latest2.log", false) }, ErrAccessDenied},
+		{"rename restricted below", func() error { return files.Rename("plugins", "mods", false) }, ErrAccessDenied},
+		{"delete restricted below", func() error { return files.DeleteRecursive("plugins") }, ErrAccessDenied},
+
+		{"read link to hidden", func() error { _, err := files.ReadFile("key.pem"); return err }, ErrNotFound},
+		{"read link to denied", func() error { _, err := files.ReadFile("latest.log"); return err }, ErrAccessDenied},
+		{"lstat link to denied", func() error { _, err := files.Lstat("latest.log"); return err }, nil},
+		{"readlink to denied", func() error { _, err := files.Readlink("latest.log"); return err }, nil},
+		{"write through link to readonly", func() error { return files.WriteFile("cfg/server.yml", nil, true) }, ErrReadOnlyPath},
+		{"read through link to readonly", func() error { _, err := files.ReadFile("cfg/server.yml"); return err }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// hidden entries and links to them are left out of listings, denied ones
+	// are listed
+	for dir, want := range map[string][]string{
+		".":       {"cfg", "config", "latest.log", "logs", "plugins", "world"},
+		"plugins": {"conf.yml"},
+	} {
+		items, err := files.List(dir)
+		if err != nil {
+			t.Fatalf("List(%s) err = %v", dir, err)
+		}
+		var names []string
+		for _, fi := range items {
+			names = append(names, fi.Name())
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, want) {
+			t.Fatalf("List(%s) = %v, want %v", dir, names, want)
+		}
+	}
+}
+
+func TestPolicyWhileRunning(t *testing.T) {
+	files, _ := newTestService(t, false)
+	running := false
+	files.Policy = newTestPolicy(t, PathRule{Pattern: "world", Action: RuleReadOnly, WhileRunning: true})
+	files.Policy.Running = func() bool { return running }
+
+	tests := []struct {
+		name    string
+		running bool
+		op      func() error
+		want    error
+	}{
+		{"write running", true, func() error { return files.WriteFile("world/level.dat", []byte("x"), true) }, ErrReadOnlyWhileRunning},
+		{"read running", true, func() error { _, err := files.ReadFile("world/level.dat"); return err }, nil},
+		{"rename into running", true, func() error { return files.Rename("plugins/conf.yml", "world/conf.yml", false) }, ErrReadOnlyWhileRunning},
+		{"delete running", true, func() error { return files.DeleteRecursive("world") }, ErrReadOnlyWhileRunning},
+		{"write stopped", false, func() error { return files.WriteFile("world/level.dat", []byte("x"), true) }, nil},
+		{"rename into stopped", false, func() error { return files.Rename("plugins/conf.yml", "world/conf.yml", false) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running = tt.running
+			if err := tt.op(); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// quotaRescanInterval is the minimum time between the scans of the root made
+// because the quota seemed exhausted.
+const quotaRescanInterval = 10 * time.Second
+
+// account checks that n more bytes written below the root fit in the quota,
+// and reserves them with commit. Deleted and replaced files are only noticed
+// by scans, so the root is scanned again before failing, as long as the last
+// scan is older than quotaRescanInterval.
+func (s *LocalFileService) account(n int64, commit bool) error {
+	if n <= 0 {
+		return nil
+	}
+	c := s.usage
+	if s.Quota <= 0 {
+		if commit {
+			c.written.Add(n)
+		}
+		return nil
+	}
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	if c.scannedAt.Load() == 0 {
+		s.dirUsage(".", false)
+	}
+	used, _ := s.TreeUsage()
+	if used+n > s.Quota && time.Since(time.Unix(0, c.scannedAt.Load())) > quotaRescanInterval {
+		s.dirUsage(".", true)
+		used, _ = s.TreeUsage()
+	}
+	if used+n > s.Quota {
+		return fmt.Errorf("%w: %d bytes needed but only %d of the %d byte quota are free",
+			ErrQuotaExceeded, n, max(s.Quota-used, 0), s.Quota)
+	}
+	if commit {
+		c.written.Add(n)
+	}
+	return nil
+}
+
+// checkQuota fails with ErrQuotaExceeded when n more bytes do not fit in the
+// quota, for writes whose size is known upfront.
+func (s *LocalFileService) checkQuota(n int64) error {
+	return s.account(n, false)
+}
+
+// reserve accounts n bytes about to be written below the root against the
+// quota, failing with ErrQuotaExceeded when they do not fit.
+func (s *LocalFileService) reserve(n int64) error {
+	return s.account(n, true)
+}
+
+// quotaWriter reserves the bytes written through it before passing them on.
+// The first free bytes are not reserved, they take the place of the content
+// of the file being replaced, like WriteFile only reserves the growth.
+type quotaWriter struct {
+	files *LocalFileService
+	w     io.Writer
+	free  int64
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	n := int64(len(p))
+	covered := min(n, q.free)
+	if err := q.files.reserve(n - covered); err != nil {
+		return 0, err
+	}
+	q.free -= covered
+	return q.w.Write(p)
+}
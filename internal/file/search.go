@@ -0,0 +1,301 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// binarySniffLen is how much of a file is checked for NUL bytes
+	binarySniffLen = 8000
+	// maxSearchLineLen is the longest line reported in a content match
+	maxSearchLineLen = 1 << 10
+)
+
+// SearchOptions describes a name and content search. Name patterns containing
+// a slash are matched against the path relative to the searched directory,
+// others against the base name.
+type SearchOptions struct {
+	Name        string // glob, or regexp with Regex; empty matches every entry
+	Content     string // text, or regexp with Regex; empty searches names only
+	Regex       bool
+	IgnoreCase  bool
+	Context     int   // lines of context around content matches
+	MaxFileSize int64 // larger files are not searched for content
+	MaxMatches  int   // the search stops after this many matches, 0 for no limit
+}
+
+// SearchMatch is an entry whose name matched, or a matching line with its
+// context when searching content.
+type SearchMatch struct {
+	Path   string
+	Info   os.FileInfo
+	Line   int // 1-based, 0 for name matches
+	Text   string
+	Before []string
+	After  []string
+}
+
+// SearchSummary is returned once a search completes.
+type SearchSummary struct {
+	Files     int  `json:"files"`     // files searched for content
+	Matches   int  `json:"matches"`   // matches reported
+	Skipped   int  `json:"skipped"`   // files too large, binary or unreadable
+	Truncated bool `json:"truncated"` // stopped at MaxMatches
+}
+
+type searcher struct {
+	opts    SearchOptions
+	name    func(string) bool
+	content *regexp.Regexp
+}
+
+func (o SearchOptions) compile() (*searcher, error) {
+	sr := &searcher{opts: o}
+	switch {
+	case o.Name == "":
+		sr.name = func(string) bool { return true }
+	case o.Regex:
+		expr := o.Name
+		if o.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		sr.name = re.MatchString
+	default:
+		pattern := o.Name
+		if o.IgnoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		sr.name = func(name string) bool {
+			if o.IgnoreCase {
+				name = strings.ToLower(name)
+			}
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}
+	}
+	if o.Content != "" {
+		expr := o.Content
+		if !o.Regex {
+			expr = regexp.QuoteMeta(expr)
+		}
+		if o.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+		sr.content = re
+	}
+	return sr, nil
+}
+
+// Validate checks the search patterns.
+func (o SearchOptions) Validate() error {
+	_, err := o.compile()
+	return err
+}
+
+// errSearchLimit stops the walk once MaxMatches is reached
+var errSearchLimit = errors.New("search limit reached")
+
+// Search walks the directory at rel, including the mounts below it, and calls
+// emit for every match, in walk order. Symlinks are never followed. Entries
+// the caller may not read are neither reported nor searched. The search stops
+// at the first error returned by emit, or when ctx is done.
+func (s *LocalFileService) Search(ctx context.Context, rel string, opts SearchOptions, emit func(SearchMatch) error) (*SearchSummary, error) {
+	sr, err := opts.compile()
+	if err != nil {
+		return nil, err
+	}
+	files, rel := s.locate(rel)
+	name, err := files.resolveFollow(rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := files.check(name, accessRead); err != nil {
+		return nil, err
+	}
+	fi, err := files.root.Stat(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
+	if !fi.IsDir() {
+		return nil, ErrNotDirectory
+	}
+
+	start := files.treePath(name)
+	summary := &SearchSummary{}
+	report := func(m SearchMatch) error {
+		if opts.MaxMatches > 0 && summary.Matches >= opts.MaxMatches {
+			summary.Truncated = true
+			return errSearchLimit
+		}
+		summary.Matches++
+		return emit(m)
+	}
+	err = s.walkTree(filepath.FromSlash(start), func(owner *LocalFileService, p string, d fs.DirEntry, err error) error {
+		tp := owner.treePath(p)
+		if err != nil {
+			// unreadable directories are skipped rather than failing the search
+			if d != nil && d.IsDir() && tp != start {
+				summary.Skipped++
+				return fs.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if tp == start {
+			return nil
+		}
+		if isReserved(p) {
+			return fs.SkipDir
+		}
+		if !owner.readable(p) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		matchName := path.Base(tp)
+		if strings.Contains(opts.Name, "/") {
+			matchName = strings.TrimPrefix(tp, start+"/")
+		}
+		if !sr.name(matchName) {
+			return nil
+		}
+		if sr.content == nil {
+			info, err := owner.root.Lstat(p)
+			if err != nil {
+				return nil
+			}
+			if p == "." {
+				info = mountInfo{info, path.Base(tp)}
+			}
+			return report(SearchMatch{Path: tp, Info: info})
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return sr.searchFile(ctx, owner.root, p, tp, summary, report)
+	})
+	if errors.Is(err, errSearchLimit) {
+		err = nil
+	}
+	return summary, err
+}
+
+// searchFile greps the file at the root-relative name, reported as the tree
+// path p, transparently decompressing .gz files.
+func (sr *searcher) searchFile(ctx context.Context, root *os.Root, name, p string, summary *SearchSummary, report func(SearchMatch) error) error {
+	f, err := root.Open(name)
+	if err != nil {
+		summary.Skipped++
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || (sr.opts.MaxFileSize > 0 && info.Size() > sr.opts.MaxFileSize) {
+		summary.Skipped++
+		return nil
+	}
+
+	var r io.Reader = f
+	if strings.HasSuffix(p, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			summary.Skipped++
+			return nil
+		}
+		defer gr.Close()
+		r = gr
+		if sr.opts.MaxFileSize > 0 {
+			// guard against compression bombs
+			r = io.LimitReader(gr, sr.opts.MaxFileSize)
+		}
+	}
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(binarySniffLen); bytes.IndexByte(head, 0) >= 0 {
+		summary.Skipped++
+		return nil
+	}
+	summary.Files++
+
+	var (
+		before  []string
+		pending []*SearchMatch // matches still collecting lines after them
+		lineNo  int
+	)
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lineNo++
+		line := truncateLine(scanner.Text())
+
+		remaining := pending[:0]
+		for _, m := range pending {
+			m.After = append(m.After, line)
+			if len(m.After) < sr.opts.Context {
+				remaining = append(remaining, m)
+			} else if err := report(*m); err != nil {
+				return err
+			}
+		}
+		pending = remaining
+
+		if sr.content.MatchString(scanner.Text()) {
+			m := &SearchMatch{Path: p, Info: info, Line: lineNo, Text: line, Before: append([]string(nil), before...)}
+			if sr.opts.Context == 0 {
+				if err := report(*m); err != nil {
+					return err
+				}
+			} else {
+				pending = append(pending, m)
+			}
+		}
+		if sr.opts.Context > 0 {
+			before = append(before, line)
+			if len(before) > sr.opts.Context {
+				before = before[1:]
+			}
+		}
+	}
+	for _, m := range pending {
+		if err := report(*m); err != nil {
+			return err
+		}
+	}
+	// lines longer than the scanner buffer end the search of this file
+	return nil
+}
+
+func truncateLine(line string) string {
+	if len(line) > maxSearchLineLen {
+		return strings.ToValidUTF8(line[:maxSearchLineLen], "")
+	}
+	return line
+}
@@ -0,0 +1,614 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+// stagingDir holds one directory per staged change, containing its metadata
+// as stagedInfo and the new content of writes as stagedData.
+var stagingDir = filepath.Join(stateDir, "staged")
+
+// stagingBackupDir keeps the entries changed by a running apply, numbered in
+// the order of stagingManifest, until the apply completed or was rolled back.
+var stagingBackupDir = filepath.Join(stateDir, "staged-backup")
+
+const (
+	stagedInfo      = "info.json"
+	stagedData      = "data"
+	stagingManifest = "manifest.json"
+)
+
+type StagedOp string
+
+const (
+	StagedWrite  StagedOp = "write"
+	StagedMkdir  StagedOp = "mkdir"
+	StagedCopy   StagedOp = "copy"
+	StagedMove   StagedOp = "move"
+	StagedDelete StagedOp = "delete"
+)
+
+// StagedChange is a file operation queued to be applied while the server is
+// stopped.
+type StagedChange struct {
+	ID        string    `json:"id"`
+	Op        StagedOp  `json:"op"`
+	Path      string    `json:"path"`
+	NewPath   string    `json:"newPath,omitempty"` // destination of copy and move
+	Overwrite bool      `json:"overwrite,omitempty"`
+	Recursive bool      `json:"recursive,omitempty"` // delete non-empty directories
+	Size      int64     `json:"size,omitempty"`      // size of the content of a write
+	IfMatch   []string  `json:"ifMatch,omitempty"`   // entity tags of the entry at path, checked when staged and applied
+	StagedBy  string    `json:"stagedBy,omitempty"`
+	StagedAt  time.Time `json:"stagedAt"`
+}
+
+// stagedRecord is the stored form of a staged change, which keeps the ID of
+// the caller to apply it with the path rules the caller has at that time.
+type stagedRecord struct {
+	StagedChange
+	IdentityID string `json:"identityId,omitempty"`
+}
+
+// stagedBackup is an entry saved before applying the staged changes.
+type stagedBackup struct {
+	Path   string `json:"path"`   // tree path of the entry
+	Exists bool   `json:"exists"` // false when the entry is to be removed on rollback
+}
+
+// checkStaged evaluates the path rules for a change to rel, apart from those
+// that only apply while the server is running, since staged changes are
+// applied when it is stopped.
+func (s *LocalFileService) checkStaged(rel string, a access) error {
+	files, rel := s.locate(rel)
+	name, err := files.resolve(rel)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		if files != s {
+			return ErrMountPoint
+		}
+		return ErrReservedPath
+	}
+	if err := files.check(name, a); err != nil && !errors.Is(err, ErrReadOnlyWhileRunning) {
+		return err
+	}
+	return nil
+}
+
+// Stage queues a mkdir, copy, move or delete to be applied by ApplyStaged
+// instead of performing it now. The paths are checked against the path rules
+// of the caller, whether the entries exist is only checked when the change is
+// applied, unless the change has an IfMatch precondition.
+func (s *LocalFileService) Stage(change StagedChange) (StagedChange, error) {
+	switch change.Op {
+	case StagedMkdir, StagedDelete:
+	case StagedCopy, StagedMove:
+		if strings.TrimSpace(change.NewPath) == "" {
+			return change, fmt.Errorf("%w: %s requires newPath", ErrInvalidStagedChange, change.Op)
+		}
+	default:
+		return change, fmt.Errorf("%w: unknown op %q", ErrInvalidStagedChange, change.Op)
+	}
+	if strings.TrimSpace(change.Path) == "" {
+		return change, fmt.Errorf("%w: %s requires path", ErrInvalidStagedChange, change.Op)
+	}
+	source := accessTree
+	if change.Op == StagedCopy {
+		source = accessRead
+	}
+	if err := s.checkStaged(change.Path, source); err != nil {
+		return change, err
+	}
+	if change.NewPath != "" {
+		if err := s.checkStaged(change.NewPath, accessTree); err != nil {
+			return change, err
+		}
+	}
+	change.Size = 0
+	return s.stageIfMatch(change, nil)
+}
+
+// StageWrite queues writing the content of r to the file at rel. Without
+// overwrite, the file must not exist now nor when the change is applied. With
+// ifMatch, the file must have one of the entity tags now and when the change
+// is applied.
+func (s *LocalFileService) StageWrite(rel string, r io.Reader, overwrite bool, ifMatch []string) (StagedChange, error) {
+	change := StagedChange{Op: StagedWrite, Path: rel, Overwrite: overwrite, IfMatch: ifMatch}
+	if err := s.checkStaged(rel, accessWrite); err != nil {
+		return change, err
+	}
+	if fi, err := s.Stat(rel); err == nil {
+		if fi.IsDir() {
+			return change, ErrIsDirectory
+		}
+		if !overwrite {
+			return change, ErrAlreadyExists
+		}
+	}
+	return s.stageIfMatch(change, r)
+}
+
+// stageIfMatch stores change once its IfMatch precondition, if any, holds.
+func (s *LocalFileService) stageIfMatch(change StagedChange, r io.Reader) (StagedChange, error) {
+	if len(change.IfMatch) == 0 {
+		return s.saveStaged(change, r)
+	}
+	saved := change
+	err := s.IfMatch(change.Path, change.IfMatch, func() (err error) {
+		saved, err = s.saveStaged(change, r)
+		return err
+	})
+	return saved, err
+}
+
+// saveStaged stores a staged change and, for writes, the content of r.
+func (s *LocalFileService) saveStaged(change StagedChange, r io.Reader) (StagedChange, error) {
+	id, err := newID()
+	if err != nil {
+		return change, err
+	}
+	change.ID = id
+	change.Path = path.Clean("/" + filepath.ToSlash(change.Path))[1:]
+	if change.NewPath != "" {
+		change.NewPath = path.Clean("/" + filepath.ToSlash(change.NewPath))[1:]
+	}
+	change.StagedAt = time.Now().UTC()
+	record := stagedRecord{StagedChange: change}
+	if s.identity != nil {
+		change.StagedBy = s.identity.Name
+		record.IdentityID = s.identity.ID
+	}
+
+	dir := filepath.Join(stagingDir, id)
+	if err := s.root.MkdirAll(dir, 0o700); err != nil {
+		return change, err
+	}
+	if r != nil {
+		f, err := s.root.OpenFile(filepath.Join(dir, stagedData), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			s.root.RemoveAll(dir)
+			return change, err
+		}
+		// staged content counts against the quota until it is applied
+		n, copyErr := io.Copy(&quotaWriter{files: s, w: f}, r)
+		closeErr := f.Close()
+		if err := errors.Join(copyErr, closeErr); err != nil {
+			s.root.RemoveAll(dir)
+			return change, err
+		}
+		change.Size = n
+	}
+	record.StagedChange = change
+	data, err := json.Marshal(record)
+	if err != nil {
+		s.root.RemoveAll(dir)
+		return change, err
+	}
+	if err := s.root.WriteFile(filepath.Join(dir, stagedInfo), data, 0o600); err != nil {
+		s.root.RemoveAll(dir)
+		return change, err
+	}
+	return change, nil
+}
+
+func (s *LocalFileService) readStaged(id string) (stagedRecord, error) {
+	var record stagedRecord
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return record, ErrStagedChangeNotFound
+	}
+	data, err := s.root.ReadFile(filepath.Join(stagingDir, id, stagedInfo))
+	if err != nil {
+		return record, ErrStagedChangeNotFound
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	record.ID = id
+	return record, nil
+}
+
+// listStaged returns the stored changes in the order they were staged.
+func (s *LocalFileService) listStaged() ([]stagedRecord, error) {
+	dir, err := s.root.Open(stagingDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]stagedRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := s.readStaged(id)
+		if err != nil {
+			// a change still being stored
+			continue
+		}
+		records = append(records, record)
+	}
+	slices.SortFunc(records, func(a, b stagedRecord) int {
+		if c := a.StagedAt.Compare(b.StagedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return records, nil
+}
+
+// stagedUsage returns the size of the content of the staged writes.
+func (s *LocalFileService) stagedUsage() int64 {
+	records, _ := s.listStaged()
+	var size int64
+	for _, record := range records {
+		size += record.Size
+	}
+	return size
+}
+
+// ListStaged returns the staged changes in the order they will be applied.
+func (s *LocalFileService) ListStaged() ([]StagedChange, error) {
+	records, err := s.listStaged()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]StagedChange, 0, len(records))
+	for _, record := range records {
+		if s.stagedVisible(record.StagedChange) {
+			changes = append(changes, record.StagedChange)
+		}
+	}
+	return changes, nil
+}
+
+// stagedVisible reports whether the paths of a staged change are inside the
+// allowed paths of the caller.
+func (s *LocalFileService) stagedVisible(change StagedChange) bool {
+	if s.identity == nil || len(s.identity.Paths) == 0 {
+		return true
+	}
+	for _, rel := range []string{change.Path, change.NewPath} {
+		if rel == "" {
+			continue
+		}
+		files, rel := s.locate(rel)
+		name, err := files.resolve(rel)
+		if err != nil || !files.allowed(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// readVisibleStaged is readStaged for the changes the caller may see, others
+// are reported as not found.
+func (s *LocalFileService) readVisibleStaged(id string) (stagedRecord, error) {
+	record, err := s.readStaged(id)
+	if err == nil && !s.stagedVisible(record.StagedChange) {
+		return stagedRecord{}, ErrStagedChangeNotFound
+	}
+	return record, err
+}
+
+// GetStaged returns the staged change id.
+func (s *LocalFileService) GetStaged(id string) (StagedChange, error) {
+	record, err := s.readVisibleStaged(id)
+	return record.StagedChange, err
+}
+
+// DiscardStaged removes the staged change id without applying it.
+func (s *LocalFileService) DiscardStaged(id string) error {
+	if _, err := s.readVisibleStaged(id); err != nil {
+		return err
+	}
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	return s.root.RemoveAll(filepath.Join(stagingDir, id))
+}
+
+// DiffStaged returns a unified diff from the current content of the file a
+// staged write or delete changes to its staged content. Binary and large
+// files are only reported as different.
+func (s *LocalFileService) DiffStaged(id string) (string, error) {
+	record, err := s.readVisibleStaged(id)
+	if err != nil {
+		return "", err
+	}
+	if record.Op != StagedWrite && record.Op != StagedDelete {
+		return "", ErrNoStagedDiff
+	}
+	from, err := s.readDiffable(record.Path)
+	if err != nil {
+		return "", err
+	}
+	var to []byte
+	if record.Op == StagedWrite {
+		f, err := s.root.Open(filepath.Join(stagingDir, id, stagedData))
+		if err != nil {
+			return "", pathError(err)
+		}
+		defer f.Close()
+		if to, err = io.ReadAll(io.LimitReader(f, maxVersionedSize+1)); err != nil {
+			return "", err
+		}
+	}
+	nameA, nameB := "a/"+record.Path, "b/"+record.Path
+	if from == nil {
+		nameA = "/dev/null"
+	}
+	if record.Op == StagedDelete {
+		nameB = "/dev/null"
+	}
+	if !isDiffable(from) || !isDiffable(to) {
+		if bytes.Equal(from, to) {
+			return "", nil
+		}
+		return fmt.Sprintf("Binary files %s and %s differ\n", nameA, nameB), nil
+	}
+	return unifiedDiff(nameA, nameB, string(from), string(to)), nil
+}
+
+// readDiffable reads up to maxVersionedSize+1 bytes of the file at rel, nil
+// when it does not exist.
+func (s *LocalFileService) readDiffable(rel string) ([]byte, error) {
+	f, fi, err := s.Open(rel)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if fi.IsDir() {
+		return nil, ErrNoStagedDiff
+	}
+	return io.ReadAll(io.LimitReader(f, maxVersionedSize+1))
+}
+
+func isDiffable(content []byte) bool {
+	return len(content) <= maxVersionedSize && bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) < 0
+}
+
+// ApplyStaged applies the staged changes in the order they were staged and
+// removes them. Each change is applied with the scopes and path rules its
+// caller has now, looked up by ID through Identities; changes of callers that
+// no longer resolve, such as revoked or expired tokens, are discarded without
+// being applied. Callers whose rights are carried by their credential alone,
+// as with JWT bearers, cannot be looked up and their changes are discarded too.
+// It is meant to run while the server is stopped. The entries the changes
+// touch are backed up first; when a change fails, everything applied so far
+// is rolled back and the changes stay staged. An error wrapping
+// ErrRollbackFailed means the tree could not be restored, the backups are kept
+// in the state dir then.
+func (s *LocalFileService) ApplyStaged() (int, error) {
+	s.stageMu.Lock()
+	defer s.stageMu.Unlock()
+	if err := s.recoverStaged(); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrRollbackFailed, err)
+	}
+	staged, err := s.listStaged()
+	if err != nil {
+		return 0, err
+	}
+	var records []stagedRecord
+	identities := make(map[string]*auth.Identity)
+	for _, record := range staged {
+		if _, ok := identities[record.IdentityID]; !ok {
+			identity, err := s.stagedIdentity(record.IdentityID)
+			if err != nil {
+				logger.Warnln("Discarding staged change of a caller that no longer exists", "op", record.Op, "path", record.Path, "stagedBy", record.StagedBy)
+				s.root.RemoveAll(filepath.Join(stagingDir, record.ID))
+				continue
+			}
+			identities[record.IdentityID] = identity
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	backups, err := s.backupStaged(records)
+	if err != nil {
+		s.root.RemoveAll(stagingBackupDir)
+		return 0, fmt.Errorf("failed to back up the entries changed by the staged changes: %w", err)
+	}
+	for i, record := range records {
+		if err := s.applyStaged(record, identities[record.IdentityID]); err != nil {
+			err = fmt.Errorf("staged change %d of %d (%s %s): %w", i+1, len(records), record.Op, record.Path, err)
+			if rbErr := s.rollbackStaged(backups); rbErr != nil {
+				return 0, fmt.Errorf("%w: %v, after %v", ErrRollbackFailed, rbErr, err)
+			}
+			return 0, err
+		}
+	}
+	for _, record := range records {
+		s.root.RemoveAll(filepath.Join(stagingDir, record.ID))
+	}
+	s.root.RemoveAll(stagingBackupDir)
+	return len(records), nil
+}
+
+// stagedIdentity resolves the caller of a staged change. Without Identities
+// only the anonymous caller of a tree without authentication resolves.
+func (s *LocalFileService) stagedIdentity(id string) (*auth.Identity, error) {
+	if s.Identities != nil {
+		return s.Identities.ResolveIdentity(id)
+	}
+	if id == auth.AnonymousIdentity.ID {
+		return auth.AnonymousIdentity, nil
+	}
+	return nil, auth.ErrUnknownID
+}
+
+func (s *LocalFileService) applyStaged(record stagedRecord, identity *auth.Identity) error {
+	files := s.As(identity)
+	if len(record.IfMatch) > 0 {
+		// the entry must not have changed since the change was staged
+		return files.IfMatch(record.Path, record.IfMatch, func() error {
+			return files.applyStagedOp(record)
+		})
+	}
+	return files.applyStagedOp(record)
+}
+
+// applyStagedOp performs a staged change on s, the view of the caller that
+// staged it.
+func (s *LocalFileService) applyStagedOp(record stagedRecord) error {
+	switch record.Op {
+	case StagedWrite:
+		f, err := s.root.Open(filepath.Join(stagingDir, record.ID, stagedData))
+		if err != nil {
+			return pathError(err)
+		}
+		defer f.Close()
+		// the content was reserved when it was staged and only moves into
+		// the tree, which stagedUsage stops counting once it is removed
+		return s.saveStream(record.Path, f, record.Overwrite, record.Size)
+	case StagedMkdir:
+		return s.MkdirAll(record.Path)
+	case StagedCopy:
+		return s.Copy(record.Path, record.NewPath, record.Overwrite)
+	case StagedMove:
+		return s.Rename(record.Path, record.NewPath, record.Overwrite)
+	case StagedDelete:
+		if record.Recursive {
+			return s.DeleteRecursive(record.Path)
+		}
+		return s.Delete(record.Path)
+	}
+	return ErrInvalidStagedChange
+}
+
+// backupStaged copies the entries the staged changes touch into
+// stagingBackupDir. Entries below another backed up entry of the same root
+// are covered by it.
+func (s *LocalFileService) backupStaged(records []stagedRecord) ([]stagedBackup, error) {
+	var paths []string
+	for _, record := range records {
+		switch record.Op {
+		case StagedCopy:
+			paths = append(paths, record.NewPath)
+		case StagedMove:
+			paths = append(paths, record.Path, record.NewPath)
+		default:
+			paths = append(paths, record.Path)
+		}
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	var backups []stagedBackup
+	for _, p := range paths {
+		files, _ := s.locate(p)
+		covered := slices.ContainsFunc(backups, func(b stagedBackup) bool {
+			owner, _ := s.locate(b.Path)
+			return owner == files && within(p, b.Path)
+		})
+		if !covered {
+			backups = append(backups, stagedBackup{Path: p})
+		}
+	}
+	if err := s.root.MkdirAll(stagingBackupDir, 0o700); err != nil {
+		return nil, err
+	}
+	for i := range backups {
+		b := &backups[i]
+		files, rel := s.locate(b.Path)
+		name, err := files.resolve(rel)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := files.root.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, pathError(err)
+		}
+		b.Exists = true
+		c := &copier{src: files.root, dst: s.root, ctx: context.Background()}
+		if err := c.copy(name, filepath.Join(stagingBackupDir, strconv.Itoa(i))); err != nil {
+			return nil, pathError(err)
+		}
+	}
+	// the manifest marks the backups complete, an apply interrupted before
+	// has nothing to roll back
+	data, err := json.Marshal(backups)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.root.WriteFile(filepath.Join(stagingBackupDir, stagingManifest), data, 0o600); err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+// rollbackStaged restores the backed up entries, removing those that did not
+// exist, and then the backups.
+func (s *LocalFileService) rollbackStaged(backups []stagedBackup) error {
+	var errs []error
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		files, rel := s.locate(b.Path)
+		name, err := files.resolve(rel)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Path, err))
+			continue
+		}
+		if err := files.root.RemoveAll(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Path, err))
+			continue
+		}
+		if !b.Exists {
+			continue
+		}
+		if err := files.root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Path, err))
+			continue
+		}
+		if err := s.move(filepath.Join(stagingBackupDir, strconv.Itoa(i)), files, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Path, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return s.root.RemoveAll(stagingBackupDir)
+}
+
+// recoverStaged rolls back an apply that was interrupted, for instance by a
+// crash, so the staged changes are applied again from the original tree.
+func (s *LocalFileService) recoverStaged() error {
+	data, err := s.root.ReadFile(filepath.Join(stagingBackupDir, stagingManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.root.RemoveAll(stagingBackupDir)
+	}
+	if err != nil {
+		return err
+	}
+	var backups []stagedBackup
+	if err := json.Unmarshal(data, &backups); err != nil {
+		return err
+	}
+	logger.Warnln("Rolling back an interrupted apply of staged changes", "entries", len(backups))
+	return s.rollbackStaged(backups)
+}
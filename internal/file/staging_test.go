@@ -0,0 +1,83 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+// testIdentities resolves the identities it holds by ID.
+type testIdentities map[string]*auth.Identity
+
+func (m testIdentities) ResolveIdentity(id string) (*auth.Identity, error) {
+	if identity, ok := m[id]; ok {
+		return identity, nil
+	}
+	return nil, auth.ErrUnknownID
+}
+
+func TestApplyStagedIdentity(t *testing.T) {
+	files, root := newTestService(t, false)
+	alice := &auth.Identity{ID: "token:alice", Name: "alice", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	bob := &auth.Identity{ID: "token:bob", Name: "bob", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	identities := testIdentities{alice.ID: alice, bob.ID: bob}
+	files.Identities = identities
+
+	if _, err := files.As(alice).StageWrite("world/alice.txt", strings.NewReader("alice"), false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.As(bob).StageWrite("plugins/bob.txt", strings.NewReader("bob"), false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// bob is revoked, alice is restricted to plugins after staging
+	delete(identities, bob.ID)
+	identities[alice.ID] = &auth.Identity{ID: alice.ID, Name: alice.Name, Scopes: alice.Scopes, Paths: []string{"plugins"}}
+	if _, err := files.ApplyStaged(); !errors.Is(err, ErrPathNotAllowed) {
+		t.Fatalf("ApplyStaged() err = %v, want %v", err, ErrPathNotAllowed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "plugins", "bob.txt")); !os.IsNotExist(err) {
+		t.Fatalf("change of a revoked caller was applied, stat err = %v", err)
+	}
+
+	// the restricted change stays staged, the revoked one is gone
+	changes, err := files.ListStaged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].StagedBy != "alice" {
+		t.Fatalf("ListStaged() = %+v, want the change of alice", changes)
+	}
+
+	identities[alice.ID] = alice
+	if applied, err := files.ApplyStaged(); err != nil || applied != 1 {
+		t.Fatalf("ApplyStaged() = %d, %v, want 1, nil", applied, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "world", "alice.txt")); err != nil || string(data) != "alice" {
+		t.Fatalf("alice.txt = %q, %v", data, err)
+	}
+}
+
+func TestApplyStagedQuota(t *testing.T) {
+	files, _ := newTestService(t, false)
+	used := files.dirUsage(".", true).size
+	// room for the staged content once, not twice
+	files.Quota = used + 5
+	if _, err := files.As(auth.AnonymousIdentity).StageWrite("world/new.txt", strings.NewReader("12345"), false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := files.ApplyStaged(); err != nil || applied != 1 {
+		t.Fatalf("ApplyStaged() = %d, %v, want 1, nil", applied, err)
+	}
+	if got, _ := files.TreeUsage(); got != used+5 {
+		t.Fatalf("TreeUsage() = %d after apply, want %d", got, used+5)
+	}
+	files.dirUsage(".", true)
+	if got, _ := files.TreeUsage(); got != used+5 {
+		t.Fatalf("TreeUsage() = %d after rescan, want %d", got, used+5)
+	}
+}
@@ -0,0 +1,289 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// trashDir holds one directory per deleted entry, containing the entry itself
+// as trashData and its metadata as trashInfo.
+var trashDir = filepath.Join(stateDir, "trash")
+
+const (
+	trashData = "data"
+	trashInfo = "info.json"
+)
+
+// Retention limits how much of the trash or the version history is kept.
+type Retention struct {
+	MaxAge   time.Duration // items older than this are purged, 0 for no limit
+	MaxSize  int64         // total bytes kept, the oldest items are purged first; 0 for no limit
+	MaxCount int           // versions kept per file, 0 for no limit; unused by the trash
+}
+
+// TrashItem is a deleted file or directory that can be restored.
+type TrashItem struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"` // where the entry was deleted from
+	IsDir     bool      `json:"isDir"`
+	Size      int64     `json:"size"` // total size of the regular files
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// moveToTrash moves the entry at the root-relative name into the trash. The
+// entry is renamed, so deleting is as fast as before; entries on another file
+// system than the root, such as mounted world folders, are copied.
+func (s *LocalFileService) moveToTrash(name string, fi fs.FileInfo) error {
+	if name == "." {
+		return ErrReservedPath
+	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	item := TrashItem{
+		ID:        id,
+		Path:      filepath.ToSlash(name),
+		IsDir:     fi.IsDir(),
+		Size:      fi.Size(),
+		DeletedAt: time.Now().UTC(),
+	}
+	if fi.IsDir() {
+		if item.Size, err = s.treeSize(name); err != nil {
+			return pathError(err)
+		}
+	} else if !fi.Mode().IsRegular() {
+		item.Size = 0
+	}
+
+	dir := filepath.Join(trashDir, id)
+	if err := s.root.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := s.root.WriteFile(filepath.Join(dir, trashInfo), data, 0o600); err != nil {
+		s.root.RemoveAll(dir)
+		return err
+	}
+	if err := s.move(name, s, filepath.Join(dir, trashData)); err != nil {
+		s.root.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// remove deletes the entry at name, moving it to the trash when enabled.
+func (s *LocalFileService) remove(name string, fi fs.FileInfo) error {
+	if s.Trash != nil {
+		return s.moveToTrash(name, fi)
+	}
+	return pathError(s.root.RemoveAll(name))
+}
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// move renames the entry at name to dstName below the root of to. Entries
+// are copied and removed instead when to is another mount or the rename
+// crosses a file system mounted inside the root.
+func (s *LocalFileService) move(name string, to *LocalFileService, dstName string) error {
+	if s.root == to.root {
+		err := s.root.Rename(name, dstName)
+		if err == nil || !isCrossDevice(err) {
+			return pathError(err)
+		}
+	}
+	c := &copier{src: s.root, dst: to.root, ctx: context.Background()}
+	if s.root != to.root {
+		c.reserve = to.reserve
+	}
+	if err := c.copy(name, dstName); err != nil {
+		to.root.RemoveAll(dstName)
+		return pathError(err)
+	}
+	return pathError(s.root.RemoveAll(name))
+}
+
+func (s *LocalFileService) readTrashItem(id string) (TrashItem, error) {
+	var item TrashItem
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return item, ErrTrashItemNotFound
+	}
+	data, err := s.root.ReadFile(filepath.Join(trashDir, id, trashInfo))
+	if err != nil {
+		return item, ErrTrashItemNotFound
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, err
+	}
+	item.ID = id
+	return item, nil
+}
+
+// ListTrash returns the items in the trash of the root and the mounts, most
+// recently deleted first.
+func (s *LocalFileService) ListTrash() ([]TrashItem, error) {
+	var items []TrashItem
+	for _, files := range s.services() {
+		own, err := files.listTrash()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range own {
+			if name := filepath.FromSlash(item.Path); files.visible(name) && files.allowed(name) {
+				item.Path = files.treePath(item.Path)
+				items = append(items, item)
+			}
+		}
+	}
+	slices.SortFunc(items, func(a, b TrashItem) int {
+		return b.DeletedAt.Compare(a.DeletedAt)
+	})
+	return items, nil
+}
+
+// listTrash returns the items in the trash below the root of s, with paths
+// relative to it.
+func (s *LocalFileService) listTrash() ([]TrashItem, error) {
+	dir, err := s.root.Open(trashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TrashItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]TrashItem, 0, len(ids))
+	for _, id := range ids {
+		item, err := s.readTrashItem(id)
+		if err != nil {
+			// partially written or removed meanwhile
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// findTrashItem returns the service whose trash holds the item with the
+// given id and the item, with its path relative to that service's root.
+func (s *LocalFileService) findTrashItem(id string) (*LocalFileService, TrashItem, error) {
+	for _, files := range s.services() {
+		item, err := files.readTrashItem(id)
+		if errors.Is(err, ErrTrashItemNotFound) {
+			continue
+		}
+		if name := filepath.FromSlash(item.Path); err == nil && (!files.visible(name) || !files.allowed(name)) {
+			err = ErrTrashItemNotFound
+		}
+		return files, item, err
+	}
+	return nil, TrashItem{}, ErrTrashItemNotFound
+}
+
+// GetTrashItem returns the trash item with the given id.
+func (s *LocalFileService) GetTrashItem(id string) (TrashItem, error) {
+	files, item, err := s.findTrashItem(id)
+	if err != nil {
+		return item, err
+	}
+	item.Path = files.treePath(item.Path)
+	return item, nil
+}
+
+// RestoreTrash moves a trash item back to rel, or to where it was deleted
+// from when rel is empty. Missing parent directories are recreated.
+func (s *LocalFileService) RestoreTrash(id, rel string, overwrite bool) (TrashItem, error) {
+	owner, item, err := s.findTrashItem(id)
+	if err != nil {
+		return item, err
+	}
+	if rel == "" {
+		rel = owner.treePath(item.Path)
+	}
+	files, rel := s.locate(rel)
+	name, err := files.resolve(rel)
+	if err != nil {
+		return item, err
+	}
+	if err := files.check(name, accessTree); err != nil {
+		return item, err
+	}
+	fi, err := files.root.Lstat(name)
+	if err == nil {
+		if !overwrite {
+			return item, ErrAlreadyExists
+		}
+		if err := files.checkMounts(name); err != nil {
+			return item, err
+		}
+	}
+	if files.root == owner.root {
+		// restored by a rename, moves between mounts reserve while copying
+		if err := files.reserve(item.Size); err != nil {
+			return item, err
+		}
+	}
+	if fi != nil {
+		if err := files.remove(name, fi); err != nil {
+			return item, err
+		}
+	}
+	if err := files.root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return item, pathError(err)
+	}
+	if err := owner.move(filepath.Join(trashDir, id, trashData), files, name); err != nil {
+		return item, err
+	}
+	item.Path = files.treePath(name)
+	return item, pathError(owner.root.RemoveAll(filepath.Join(trashDir, id)))
+}
+
+// PurgeTrash permanently deletes a trash item.
+func (s *LocalFileService) PurgeTrash(id string) error {
+	files, item, err := s.findTrashItem(id)
+	if err != nil {
+		return err
+	}
+	if err := files.checkPath(filepath.FromSlash(item.Path), accessWrite); err != nil {
+		return err
+	}
+	return files.root.RemoveAll(filepath.Join(trashDir, id))
+}
+
+// pruneTrash purges the items that exceed the trash retention.
+func (s *LocalFileService) pruneTrash(now time.Time) {
+	if s.Trash == nil {
+		return
+	}
+	items, err := s.listTrash()
+	if err != nil {
+		return
+	}
+	slices.SortFunc(items, func(a, b TrashItem) int {
+		return b.DeletedAt.Compare(a.DeletedAt)
+	})
+	var total int64
+	for _, item := range items {
+		total += item.Size
+		expired := s.Trash.MaxAge > 0 && now.Sub(item.DeletedAt) > s.Trash.MaxAge
+		if expired || (s.Trash.MaxSize > 0 && total > s.Trash.MaxSize) {
+			s.root.RemoveAll(filepath.Join(trashDir, item.ID))
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package file
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+// Upload describes a resumable upload session.
+type Upload struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Overwrite bool      `json:"overwrite"`
+	SHA256    string    `json:"sha256,omitempty"` // expected hex digest of the whole file
+	Owner     string    `json:"-"`                // id of the identity that created the session
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type uploadSession struct {
+	Upload
+	mu       sync.Mutex        // serializes chunk writes
+	partPath string            // relative to the root of files
+	sub      string            // destination relative to the root of files
+	files    *LocalFileService // holds the destination, as seen by the owner
+	free     int64             // size of the replaced file not reserved yet
+}
+
+// UploadManager keeps resumable upload sessions. Chunks are appended to a
+// .part file next to the destination, which is renamed over the destination
+// once the declared size has been received. Sessions without activity for
+// the configured TTL are removed together with their .part file.
+type UploadManager struct {
+	files    *LocalFileService
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+func NewUploadManager(files *LocalFileService, ttl time.Duration) *UploadManager {
+	return &UploadManager{
+		files:    files,
+		ttl:      ttl,
+		sessions: make(map[string]*uploadSession),
+	}
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Create starts an upload session of identity for a file of size bytes at rel.
+func (m *UploadManager) Create(rel string, size int64, overwrite bool, sha256sum string, identity *auth.Identity) (Upload, error) {
+	if size < 0 {
+		return Upload{}, ErrInvalidUploadSize
+	}
+	files, sub := m.files.As(identity).locate(rel)
+	name, err := files.resolve(sub)
+	if err != nil {
+		return Upload{}, err
+	}
+	if err := files.check(name, accessWrite); err != nil {
+		return Upload{}, err
+	}
+	var owner string
+	if identity != nil {
+		owner = identity.ID
+	}
+	root := files.root
+	var replaced int64
+	if fi, err := root.Lstat(name); err == nil {
+		if fi.IsDir() {
+			return Upload{}, ErrIsDirectory
+		}
+		if !overwrite {
+			return Upload{}, ErrAlreadyExists
+		}
+		if fi.Mode().IsRegular() {
+			replaced = fi.Size()
+		}
+	}
+	// the chunks are reserved as they arrive, fail early when they cannot
+	// fit anyway. Like WriteFile, only the growth over a replaced file counts.
+	if err := files.checkQuota(size - replaced); err != nil {
+		return Upload{}, err
+	}
+	if err := root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return Upload{}, pathError(err)
+	}
+	id, err := newID()
+	if err != nil {
+		return Upload{}, err
+	}
+	partPath := name + "." + id + ".part"
+	f, err := root.OpenFile(partPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return Upload{}, pathError(err)
+	}
+	f.Close()
+
+	now := time.Now().UTC()
+	session := &uploadSession{
+		Upload: Upload{
+			ID:        id,
+			Path:      strings.TrimPrefix(filepath.ToSlash(rel), "/"),
+			Size:      size,
+			Overwrite: overwrite,
+			SHA256:    strings.ToLower(sha256sum),
+			Owner:     owner,
+			CreatedAt: now,
+			ExpiresAt: now.Add(m.ttl),
+		},
+		partPath: partPath,
+		sub:      sub,
+		files:    files,
+		free:     replaced,
+	}
+	m.mu.Lock()
+	m.sessions[id] = session
+	m.mu.Unlock()
+
+	// empty files are complete as soon as they are created
+	if size == 0 {
+		return m.finish(session)
+	}
+	return session.Upload, nil
+}
+
+func (m *UploadManager) get(id string) (*uploadSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+func (m *UploadManager) remove(session *uploadSession) {
+	m.mu.Lock()
+	delete(m.sessions, session.ID)
+	m.mu.Unlock()
+	session.files.root.Remove(session.partPath)
+}
+
+// Get returns the current state of an upload session.
+func (m *UploadManager) Get(id string) (Upload, error) {
+	session, err := m.get(id)
+	if err != nil {
+		return Upload{}, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.Upload, nil
+}
+
+// WriteChunk appends r at offset, which must equal the current offset of the
+// session. The file is finalized when the last byte has been written; the
+// returned Upload then has Offset equal to Size.
+func (m *UploadManager) WriteChunk(id string, offset int64, r io.Reader) (Upload, error) {
+	session, err := m.get(id)
+	if err != nil {
+		return Upload{}, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if offset != session.Offset {
+		return session.Upload, ErrOffsetMismatch
+	}
+
+	f, err := session.files.root.OpenFile(session.partPath, os.O_WRONLY, 0)
+	if err != nil {
+		return session.Upload, pathError(err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return session.Upload, err
+	}
+	remaining := session.Size - offset
+	w := &quotaWriter{files: session.files, w: f, free: session.free}
+	n, copyErr := io.Copy(w, io.LimitReader(r, remaining+1))
+	if copyErr == nil && n > remaining {
+		copyErr = ErrUploadTooLarge
+	}
+	if copyErr != nil {
+		// drop the partial chunk so that the client can resend it
+		f.Truncate(offset)
+		f.Close()
+		return session.Upload, copyErr
+	}
+	if err := f.Close(); err != nil {
+		return session.Upload, err
+	}
+
+	session.Offset += n
+	session.free = w.free
+	session.ExpiresAt = time.Now().UTC().Add(m.ttl)
+	if session.Offset < session.Size {
+		return session.Upload, nil
+	}
+	return m.finish(session)
+}
+
+// finish verifies the checksum and moves the .part file into place. The
+// session is removed whether or not it succeeds.
+func (m *UploadManager) finish(session *uploadSession) (Upload, error) {
+	defer m.remove(session)
+	if session.SHA256 != "" {
+		sum, err := fileSHA256(session.files.root, session.partPath)
+		if err != nil {
+			return session.Upload, err
+		}
+		if sum != session.SHA256 {
+			return session.Upload, ErrChecksumMismatch
+		}
+	}
+	name, err := session.files.resolve(session.sub)
+	if err != nil {
+		return session.Upload, err
+	}
+	// the rules may have changed since the session was created
+	if err := session.files.check(name, accessWrite); err != nil {
+		return session.Upload, err
+	}
+	root := session.files.root
+	if fi, err := root.Lstat(name); err == nil {
+		if !session.Overwrite {
+			return session.Upload, ErrAlreadyExists
+		}
+		// Preserve destination's permissions
+		if fi.Mode().IsRegular() {
+			_ = root.Chmod(session.partPath, fi.Mode().Perm())
+			session.files.keepVersion(name)
+		}
+	}
+	if err := root.Rename(session.partPath, name); err != nil {
+		return session.Upload, pathError(err)
+	}
+	return session.Upload, nil
+}
+
+func fileSHA256(root *os.Root, name string) (string, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Abort cancels an upload session and deletes the received data.
+func (m *UploadManager) Abort(id string) error {
+	session, err := m.get(id)
+	if err != nil {
+		return err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	m.remove(session)
+	return nil
+}
+
+// expire removes sessions that expired before now. Sessions with a chunk
+// write in progress are skipped.
+func (m *UploadManager) expire(now time.Time) {
+	m.mu.Lock()
+	var expired []*uploadSession
+	for _, session := range m.sessions {
+		if !session.mu.TryLock() {
+			continue
+		}
+		if now.After(session.ExpiresAt) {
+			expired = append(expired, session)
+		}
+		session.mu.Unlock()
+	}
+	m.mu.Unlock()
+	for _, session := range expired {
+		m.remove(session)
+	}
+}
+
+// ExpireLoop periodically removes abandoned sessions until done is closed.
+func (m *UploadManager) ExpireLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(min(m.ttl, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.expire(now)
+		case <-done:
+			return
+		}
+	}
+}
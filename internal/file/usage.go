@@ -0,0 +1,251 @@
+package file
+
+import (
+	"cmp"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+// defaultUsageTTL is how long directory sizes are cached when UsageTTL is not
+// set.
+const defaultUsageTTL = 5 * time.Minute
+
+// UsageEntry is the disk usage of an entry in a directory.
+type UsageEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"isDir"`
+	Size  int64  `json:"size"`  // bytes in the regular files at or below the entry
+	Files int64  `json:"files"` // regular files at or below the entry
+}
+
+// DirUsage is the disk usage of a directory broken down by its entries,
+// largest first.
+type DirUsage struct {
+	Path      string       `json:"path"`
+	Size      int64        `json:"size"`
+	Files     int64        `json:"files"`
+	Entries   []UsageEntry `json:"entries"`
+	ScannedAt time.Time    `json:"scannedAt"` // when the sizes were computed
+}
+
+type dirTotal struct {
+	size      int64
+	files     int64
+	scannedAt time.Time
+}
+
+// usageCache keeps the sizes of the directories below the root, computed by
+// recursive scans. A scan caches every directory it visits, so browsing into
+// a scanned directory is free until the sizes expire.
+type usageCache struct {
+	mu   sync.Mutex // held while scanning
+	dirs map[string]dirTotal
+
+	// the size of the root as of its last scan, when it completed in unix
+	// nanoseconds and the bytes reserved by writes since, readable while a
+	// scan is running
+	rootSize  atomic.Int64
+	scannedAt atomic.Int64
+	written   atomic.Int64
+	quotaMu   sync.Mutex // serializes reservations against the quota
+}
+
+func (s *LocalFileService) usageTTL() time.Duration {
+	if s.UsageTTL > 0 {
+		return s.UsageTTL
+	}
+	return defaultUsageTTL
+}
+
+// scanUsage computes the size of the directory at the root-relative name and
+// stores the size of every directory below it in dirs. Unreadable
+// directories count as empty, mount points are left to their mount.
+func (s *LocalFileService) scanUsage(name string, dirs map[string]dirTotal, now time.Time) dirTotal {
+	total := dirTotal{scannedAt: now}
+	dir, err := s.root.Open(name)
+	if err != nil {
+		return total
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		return total
+	}
+	for _, e := range entries {
+		p := filepath.Join(name, e.Name())
+		if isReserved(p) || s.isMountPoint(p) {
+			continue
+		}
+		switch {
+		case e.IsDir():
+			sub := s.scanUsage(p, dirs, now)
+			total.size += sub.size
+			total.files += sub.files
+		case e.Type().IsRegular():
+			if info, err := e.Info(); err == nil {
+				total.size += info.Size()
+				total.files++
+			}
+		}
+	}
+	dirs[filepath.ToSlash(name)] = total
+	return total
+}
+
+// dirUsage returns the size of the directory at the root-relative name,
+// scanning it when the cached size expired or refresh is set.
+func (s *LocalFileService) dirUsage(name string, refresh bool) dirTotal {
+	key := filepath.ToSlash(name)
+	c := s.usage
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if total, ok := c.dirs[key]; ok && !refresh && time.Since(total.scannedAt) < s.usageTTL() {
+		return total
+	}
+	// bytes reserved while the scan runs may be missed by it, so only what
+	// was reserved before it is dropped afterwards
+	reserved := c.written.Load()
+	dirs := make(map[string]dirTotal)
+	total := s.scanUsage(name, dirs, time.Now())
+	if c.dirs == nil {
+		c.dirs = make(map[string]dirTotal)
+	}
+	for p, t := range dirs {
+		c.dirs[p] = t
+	}
+	if key == "." {
+		// the scan includes what was written before it, and the staged
+		// content which the state dir is not scanned for
+		c.rootSize.Store(total.size + s.stagedUsage())
+		c.written.Add(-reserved)
+		c.scannedAt.Store(total.scannedAt.UnixNano())
+	}
+	return total
+}
+
+// mountsUsage returns the total size of the mounts below the root-relative
+// directory name.
+func (s *LocalFileService) mountsUsage(name string, refresh bool) dirTotal {
+	var total dirTotal
+	for _, m := range s.mounts {
+		if within(m.mountPath, s.treePath(name)) {
+			sub := m.dirUsage(".", refresh)
+			total.size += sub.size
+			total.files += sub.files
+		}
+	}
+	return total
+}
+
+// Usage returns the disk usage of the directory at rel, including the mounts
+// below it. Sizes are cached for UsageTTL, refresh scans the directory again.
+// Entries the caller may not see are left out of the breakdown but counted
+// in the total.
+func (s *LocalFileService) Usage(rel string, refresh bool) (*DirUsage, error) {
+	if files, rel := s.locate(rel); files != s {
+		return files.Usage(rel, refresh)
+	}
+	name, err := s.resolveFollow(rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(name, accessRead); err != nil {
+		return nil, err
+	}
+	fi, err := s.root.Stat(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
+	if !fi.IsDir() {
+		return nil, ErrNotDirectory
+	}
+
+	total := s.dirUsage(name, refresh)
+	mounted := s.mountsUsage(name, refresh)
+	usage := &DirUsage{
+		Path:      s.treePath(name),
+		Size:      total.size + mounted.size,
+		Files:     total.files + mounted.files,
+		Entries:   []UsageEntry{},
+		ScannedAt: total.scannedAt.UTC(),
+	}
+	dir, err := s.root.Open(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		return nil, pathError(err)
+	}
+	for _, e := range entries {
+		p := filepath.Join(name, e.Name())
+		if isReserved(p) || s.isMountPoint(p) || !s.visible(p) {
+			continue
+		}
+		entry := UsageEntry{Name: e.Name(), IsDir: e.IsDir()}
+		switch {
+		case e.IsDir():
+			// cached by the scan of the parent
+			sub, mounted := s.dirUsage(p, false), s.mountsUsage(p, false)
+			entry.Size, entry.Files = sub.size+mounted.size, sub.files+mounted.files
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			entry.Size, entry.Files = info.Size(), 1
+		}
+		usage.Entries = append(usage.Entries, entry)
+	}
+	for _, m := range s.mounts {
+		view := m.As(s.identity)
+		if path.Dir(m.mountPath) != filepath.ToSlash(name) || !view.visible(".") {
+			continue
+		}
+		sub := m.dirUsage(".", false)
+		usage.Entries = append(usage.Entries, UsageEntry{
+			Name:  path.Base(m.mountPath),
+			IsDir: true,
+			Size:  sub.size,
+			Files: sub.files,
+		})
+	}
+	slices.SortFunc(usage.Entries, func(a, b UsageEntry) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Name, b.Name))
+	})
+	return usage, nil
+}
+
+// TreeUsage returns the bytes used by the files below the root and the
+// staged writes, not counting the mounts and the trash, as of the last scan
+// plus what was written since.
+// It never scans, and returns false before the first scan completed.
+func (s *LocalFileService) TreeUsage() (int64, bool) {
+	c := s.usage
+	return c.rootSize.Load() + c.written.Load(), c.scannedAt.Load() != 0
+}
+
+// UsageLoop scans the root right away and again whenever its size expires,
+// keeping TreeUsage and the quota current, until done is closed.
+func (s *LocalFileService) UsageLoop(done <-chan struct{}) {
+	start := time.Now()
+	total := s.dirUsage(".", true)
+	logger.Debugf("Scanned the disk usage of %s in %s: %d bytes in %d files", s.RootDir, time.Since(start).Round(time.Millisecond), total.size, total.files)
+	ticker := time.NewTicker(s.usageTTL())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.dirUsage(".", true)
+		case <-done:
+			return
+		}
+	}
+}
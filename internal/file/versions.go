@@ -0,0 +1,306 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+// versionsDir holds one directory per versioned file, named after the hash of
+// its path. It contains the path in versionPath and every version in a file
+// named after the time it was replaced, in nanoseconds.
+var versionsDir = filepath.Join(stateDir, "versions")
+
+const (
+	versionPath = "path"
+	// maxVersionedSize is the size of the largest file kept in the history,
+	// larger files are plugin jars or world data rather than configs
+	maxVersionedSize = 1 << 20
+)
+
+// Version is a previous content of a file.
+type Version struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"` // when the content was replaced
+}
+
+func versionKey(name string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(name)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func parseVersionID(id string) (time.Time, bool) {
+	nsec, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || nsec <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nsec).UTC(), true
+}
+
+// saveVersion keeps the current content of the file at the root-relative name
+// before it is replaced. Only text files up to maxVersionedSize are kept, and
+// nothing is kept when the content is the same as the latest version.
+func (s *LocalFileService) saveVersion(name string) error {
+	if s.Versions == nil {
+		return nil
+	}
+	fi, err := s.root.Lstat(name)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > maxVersionedSize {
+		return nil
+	}
+	content, err := s.root.ReadFile(name)
+	if err != nil {
+		return pathError(err)
+	}
+	if bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		return nil
+	}
+
+	dir := filepath.Join(versionsDir, versionKey(name))
+	if err := s.root.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := s.root.WriteFile(filepath.Join(dir, versionPath), []byte(filepath.ToSlash(name)), 0o600); err != nil {
+		return err
+	}
+	versions, err := s.listVersions(name)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		latest, err := s.root.ReadFile(filepath.Join(dir, versions[0].ID))
+		if err == nil && bytes.Equal(latest, content) {
+			return nil
+		}
+	}
+	// ids are unique as long as two versions are not saved within the same
+	// nanosecond, O_EXCL catches the rest
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	f, err := s.root.OpenFile(filepath.Join(dir, id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, writeErr := f.Write(content)
+	if err := f.Close(); writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		s.root.Remove(filepath.Join(dir, id))
+		return writeErr
+	}
+	if keep := s.Versions.MaxCount; keep > 0 && len(versions)+1 > keep {
+		for _, v := range versions[keep-1:] {
+			s.root.Remove(filepath.Join(dir, v.ID))
+		}
+	}
+	return nil
+}
+
+// keepVersion saves a version of the file at name before it is overwritten.
+// Failing to do so does not prevent the write.
+func (s *LocalFileService) keepVersion(name string) {
+	if err := s.saveVersion(name); err != nil {
+		logger.Warnln("Failed to keep file version", "path", name, "error", err)
+	}
+}
+
+// listVersions returns the versions of the file at the root-relative name,
+// newest first.
+func (s *LocalFileService) listVersions(name string) ([]Version, error) {
+	dir, err := s.root.Open(filepath.Join(versionsDir, versionKey(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]Version, 0, len(entries))
+	for _, e := range entries {
+		createdAt, ok := parseVersionID(e.Name())
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{
+			ID:        e.Name(),
+			Path:      s.treePath(name),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+	slices.SortFunc(versions, func(a, b Version) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return versions, nil
+}
+
+// ListVersions returns the kept versions of the file at rel, newest first.
+// Files without history have no versions, even when they do not exist.
+func (s *LocalFileService) ListVersions(rel string) ([]Version, error) {
+	if files, rel := s.locate(rel); files != s {
+		return files.ListVersions(rel)
+	}
+	name, err := s.resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(name, accessRead); err != nil {
+		return nil, err
+	}
+	return s.listVersions(name)
+}
+
+// ReadVersion returns the content of a version of the file at rel.
+func (s *LocalFileService) ReadVersion(rel, id string) ([]byte, Version, error) {
+	if files, rel := s.locate(rel); files != s {
+		return files.ReadVersion(rel, id)
+	}
+	name, err := s.resolve(rel)
+	if err != nil {
+		return nil, Version{}, err
+	}
+	if err := s.check(name, accessRead); err != nil {
+		return nil, Version{}, err
+	}
+	createdAt, ok := parseVersionID(id)
+	if !ok {
+		return nil, Version{}, ErrVersionNotFound
+	}
+	content, err := s.root.ReadFile(filepath.Join(versionsDir, versionKey(name), id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Version{}, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, Version{}, err
+	}
+	v := Version{ID: id, Path: s.treePath(name), Size: int64(len(content)), CreatedAt: createdAt}
+	return content, v, nil
+}
+
+// RestoreVersion replaces the content of the file at rel with a version. The
+// replaced content becomes a version itself, so restoring can be undone.
+func (s *LocalFileService) RestoreVersion(rel, id string) error {
+	content, _, err := s.ReadVersion(rel, id)
+	if err != nil {
+		return err
+	}
+	return s.SaveStream(rel, bytes.NewReader(content), true)
+}
+
+// DiffVersion returns a unified diff from the version id of the file at rel
+// to the version other, or to the current content when other is empty.
+func (s *LocalFileService) DiffVersion(rel, id, other string) (string, error) {
+	from, v, err := s.ReadVersion(rel, id)
+	if err != nil {
+		return "", err
+	}
+	var to []byte
+	toLabel := v.Path
+	if other != "" {
+		if to, _, err = s.ReadVersion(rel, other); err != nil {
+			return "", err
+		}
+		toLabel += "@" + other
+	} else {
+		f, _, err := s.Open(rel)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+		if f != nil {
+			defer f.Close()
+			if to, err = io.ReadAll(io.LimitReader(f, maxVersionedSize+1)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return unifiedDiff(v.Path+"@"+id, toLabel, string(from), string(to)), nil
+}
+
+// pruneVersions removes the versions that exceed the version retention,
+// across all files.
+func (s *LocalFileService) pruneVersions(now time.Time) {
+	if s.Versions == nil {
+		return
+	}
+	dir, err := s.root.Open(versionsDir)
+	if err != nil {
+		return
+	}
+	keys, _ := dir.Readdirnames(-1)
+	dir.Close()
+
+	type versionFile struct {
+		name      string
+		size      int64
+		createdAt time.Time
+	}
+	var all []versionFile
+	for _, key := range keys {
+		data, err := s.root.ReadFile(filepath.Join(versionsDir, key, versionPath))
+		if err != nil {
+			continue
+		}
+		name := filepath.FromSlash(strings.TrimSpace(string(data)))
+		versions, err := s.listVersions(name)
+		if err != nil {
+			continue
+		}
+		if len(versions) == 0 {
+			s.root.RemoveAll(filepath.Join(versionsDir, key))
+			continue
+		}
+		for _, v := range versions {
+			all = append(all, versionFile{filepath.Join(versionsDir, key, v.ID), v.Size, v.CreatedAt})
+		}
+	}
+	slices.SortFunc(all, func(a, b versionFile) int {
+		return b.createdAt.Compare(a.createdAt)
+	})
+	var total int64
+	for _, v := range all {
+		total += v.size
+		expired := s.Versions.MaxAge > 0 && now.Sub(v.createdAt) > s.Versions.MaxAge
+		if expired || (s.Versions.MaxSize > 0 && total > s.Versions.MaxSize) {
+			s.root.Remove(v.name)
+		}
+	}
+}
+
+// RetentionLoop periodically purges the trash and the version history
+// according to their retention until done is closed.
+func (s *LocalFileService) RetentionLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, files := range s.services() {
+				files.pruneTrash(now)
+				files.pruneVersions(now)
+			}
+		case <-done:
+			return
+		}
+	}
+}
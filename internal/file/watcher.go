@@ -0,0 +1,347 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+// subscriberBuffer is the number of events queued per subscriber before
+// further events are dropped and replaced by an overflow event.
+const subscriberBuffer = 256
+
+type EventOp string
+
+const (
+	EventCreate EventOp = "create"
+	EventModify EventOp = "modify"
+	EventDelete EventOp = "delete"
+	// EventRename is reported for the old path, the new path follows as a
+	// create event when it is inside a watched directory.
+	EventRename EventOp = "rename"
+	// EventOverflow means events were lost and the subscriber should reload.
+	EventOverflow EventOp = "overflow"
+)
+
+// Event is a change in the tree. Paths are slash separated and relative to
+// the root, changes in mounts are reported at their path in the tree.
+type Event struct {
+	Op    EventOp `json:"op"`
+	Path  string  `json:"path,omitempty"`
+	IsDir bool    `json:"isDir,omitempty"`
+}
+
+// Subscription delivers the events of a subtree until it is closed.
+type Subscription struct {
+	watcher *Watcher
+	prefix  string
+	files   *LocalFileService // evaluates the path rules for the subscriber
+	events  chan Event
+	lost    bool // events were dropped since the last delivered one
+}
+
+// Events returns the event channel, closed when the watcher stops.
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+// Close ends the subscription and releases the watches nobody else needs.
+func (sub *Subscription) Close() {
+	sub.watcher.unsubscribe(sub)
+}
+
+// Watcher reports changes below the root of a LocalFileService. Directories
+// are watched recursively while a subscription covers them, including
+// directories created later. Events for the same path are coalesced for the
+// debounce interval so that a file written in many small chunks is reported
+// once.
+type Watcher struct {
+	files    *LocalFileService
+	debounce time.Duration
+	fsw      *fsnotify.Watcher
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	watched map[string]bool // directories by tree path
+	pending []Event
+	closed  bool
+}
+
+func NewWatcher(files *LocalFileService, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		files:    files,
+		debounce: debounce,
+		fsw:      fsw,
+		subs:     make(map[*Subscription]struct{}),
+		watched:  make(map[string]bool),
+	}, nil
+}
+
+// within reports whether the slash separated path p is prefix or below it.
+func within(p, prefix string) bool {
+	return prefix == "." || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// Subscribe watches the directory at rel and everything below it for
+// identity. Events for paths hidden from identity by its allowed paths or the
+// path rules are not delivered.
+func (w *Watcher) Subscribe(rel string, identity *auth.Identity) (*Subscription, error) {
+	files := w.files.As(identity)
+	owner, rel := files.locate(rel)
+	name, err := owner.resolveFollow(rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := owner.check(name, accessRead); err != nil {
+		return nil, err
+	}
+	fi, err := owner.root.Stat(name)
+	if err != nil {
+		return nil, pathError(err)
+	}
+	if !fi.IsDir() {
+		return nil, ErrNotDirectory
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, ErrWatcherClosed
+	}
+	prefix := owner.treePath(name)
+	if err := w.watch(prefix); err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		watcher: w,
+		prefix:  prefix,
+		files:   files,
+		events:  make(chan Event, subscriberBuffer),
+	}
+	w.subs[sub] = struct{}{}
+	w.watchTree(prefix, nil)
+	return sub, nil
+}
+
+func (w *Watcher) unsubscribe(sub *Subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.subs[sub]; !ok {
+		return
+	}
+	delete(w.subs, sub)
+	close(sub.events)
+	for dir := range w.watched {
+		if !w.covered(dir) {
+			w.fsw.Remove(w.files.hostPath(dir))
+			delete(w.watched, dir)
+		}
+	}
+}
+
+// covered reports whether a subscription needs p to be watched.
+func (w *Watcher) covered(p string) bool {
+	for sub := range w.subs {
+		if within(p, sub.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch adds a watch for the directory p. inotify follows symlinks, so the
+// watch is dropped again when p turned out not to be a plain directory.
+func (w *Watcher) watch(p string) error {
+	if w.watched[p] {
+		return nil
+	}
+	abs := w.files.hostPath(p)
+	if err := w.fsw.Add(abs); err != nil {
+		return err
+	}
+	owner, name := w.files.locate(p)
+	if fi, err := owner.root.Lstat(filepath.FromSlash(name)); err != nil || !fi.IsDir() {
+		w.fsw.Remove(abs)
+		return ErrNotDirectory
+	}
+	w.watched[p] = true
+	return nil
+}
+
+// watchTree watches the directories below p, including mounts. Entries found
+// on the way are passed to found, which reports files created in a new
+// directory before its watch was in place.
+func (w *Watcher) watchTree(p string, found func(Event)) {
+	w.files.walkTree(filepath.FromSlash(p), func(owner *LocalFileService, name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if isReserved(name) {
+			return fs.SkipDir
+		}
+		entry := owner.treePath(name)
+		if entry != p && found != nil {
+			found(Event{Op: EventCreate, Path: entry, IsDir: d.IsDir()})
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := w.watch(entry); err != nil {
+			if errors.Is(err, ErrNotDirectory) || errors.Is(err, fs.ErrNotExist) {
+				// replaced or removed meanwhile
+				return fs.SkipDir
+			}
+			// most likely the inotify watch limit, further watches would fail too
+			logger.Warnln("Failed to watch directory", "path", entry, "error", err)
+			return fs.SkipAll
+		}
+		return nil
+	})
+}
+
+// forget drops the watches of a removed or renamed directory tree. A watch
+// follows its directory when renamed and would keep reporting the old path,
+// the new path is watched again when its create event arrives.
+func (w *Watcher) forget(p string) bool {
+	wasDir := w.watched[p]
+	for dir := range w.watched {
+		if within(dir, p) {
+			w.fsw.Remove(w.files.hostPath(dir))
+			delete(w.watched, dir)
+		}
+	}
+	return wasDir
+}
+
+// queue adds an event to the pending batch. Modifications of a path that is
+// already pending are coalesced.
+func (w *Watcher) queue(e Event) {
+	if e.Op == EventModify {
+		for _, prev := range w.pending {
+			if prev.Path == e.Path && (prev.Op == EventCreate || prev.Op == EventModify) {
+				return
+			}
+		}
+	}
+	w.pending = append(w.pending, e)
+}
+
+func (w *Watcher) handle(ev fsnotify.Event) {
+	owner, rel, ok := w.files.fromHost(ev.Name)
+	if !ok || isReserved(rel) {
+		return
+	}
+	p := owner.treePath(rel)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case ev.Has(fsnotify.Create):
+		fi, err := owner.root.Lstat(rel)
+		isDir := err == nil && fi.IsDir()
+		w.queue(Event{Op: EventCreate, Path: p, IsDir: isDir})
+		if isDir && w.covered(p) {
+			w.watchTree(p, w.queue)
+		}
+	case ev.Has(fsnotify.Write):
+		w.queue(Event{Op: EventModify, Path: p})
+	case ev.Has(fsnotify.Remove):
+		w.queue(Event{Op: EventDelete, Path: p, IsDir: w.forget(p)})
+	case ev.Has(fsnotify.Rename):
+		w.queue(Event{Op: EventRename, Path: p, IsDir: w.forget(p)})
+	}
+}
+
+// flush delivers the pending events to the subscribers covering them. Slow
+// subscribers lose events and get an overflow event once they catch up.
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	events := w.pending
+	w.pending = nil
+	for sub := range w.subs {
+		for _, e := range events {
+			if e.Op != EventOverflow && !within(e.Path, sub.prefix) {
+				continue
+			}
+			if e.Op != EventOverflow {
+				if owner, name := sub.files.locate(e.Path); !owner.visible(filepath.FromSlash(name)) {
+					continue
+				}
+			}
+			if sub.lost {
+				select {
+				case sub.events <- Event{Op: EventOverflow}:
+					sub.lost = false
+				default:
+					continue
+				}
+			}
+			select {
+			case sub.events <- e:
+			default:
+				sub.lost = true
+			}
+		}
+	}
+}
+
+// Run processes file system events until done is closed, then closes all
+// subscriptions.
+func (w *Watcher) Run(done <-chan struct{}) {
+	defer w.stop()
+	var flushTimer <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+			if flushTimer == nil {
+				flushTimer = time.After(w.debounce)
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.mu.Lock()
+				w.pending = append(w.pending, Event{Op: EventOverflow})
+				w.mu.Unlock()
+				if flushTimer == nil {
+					flushTimer = time.After(w.debounce)
+				}
+				continue
+			}
+			logger.Warnln("File watcher error", "error", err)
+		case <-flushTimer:
+			flushTimer = nil
+			w.flush()
+		}
+	}
+}
+
+func (w *Watcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.fsw.Close()
+	for sub := range w.subs {
+		close(sub.events)
+		delete(w.subs, sub)
+	}
+}
@@ -0,0 +1,248 @@
+// Package grpcweb serves gRPC services to browsers over the gRPC-Web and
+// Connect protocols on the fiber HTTP server.
+//
+// Requests are dispatched directly to the registered service handlers with
+// the same interceptors as the native gRPC server, so authentication and
+// authorization behave identically. Only unary and server-streaming methods
+// are supported since HTTP/1.1 cannot carry client streams.
+package grpcweb
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type method struct {
+	fullName string
+	srv      any
+	unary    *grpc.MethodDesc
+	stream   *grpc.StreamDesc
+}
+
+// Handler implements grpc.ServiceRegistrar, so services are registered with
+// the generated Register functions, and serves them with Handle.
+type Handler struct {
+	methods           map[string]*method
+	unaryInterceptor  grpc.UnaryServerInterceptor
+	streamInterceptor grpc.StreamServerInterceptor
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithUnaryInterceptor sets the interceptor wrapping unary calls.
+func WithUnaryInterceptor(interceptor grpc.UnaryServerInterceptor) Option {
+	return func(h *Handler) {
+		h.unaryInterceptor = interceptor
+	}
+}
+
+// WithStreamInterceptor sets the interceptor wrapping streaming calls.
+func WithStreamInterceptor(interceptor grpc.StreamServerInterceptor) Option {
+	return func(h *Handler) {
+		h.streamInterceptor = interceptor
+	}
+}
+
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{methods: make(map[string]*method)}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// RegisterService implements grpc.ServiceRegistrar.
+func (h *Handler) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	for i := range desc.Methods {
+		md := &desc.Methods[i]
+		name := "/" + desc.ServiceName + "/" + md.MethodName
+		h.methods[name] = &method{fullName: name, srv: impl, unary: md}
+	}
+	for i := range desc.Streams {
+		sd := &desc.Streams[i]
+		name := "/" + desc.ServiceName + "/" + sd.StreamName
+		h.methods[name] = &method{fullName: name, srv: impl, stream: sd}
+	}
+}
+
+// Handle serves a gRPC-Web or Connect request. Mount it on POST routes
+// matching "/<service>/<method>".
+func (h *Handler) Handle(c *fiber.Ctx) error {
+	p, ok := parseContentType(c.Get(fiber.HeaderContentType))
+	if !ok {
+		return c.SendStatus(fiber.StatusUnsupportedMediaType)
+	}
+	m, ok := h.methods[c.Path()]
+	if !ok {
+		return writeUnaryResponse(c, p, nil, nil, nil, status.Errorf(codes.Unimplemented, "unknown method %s", c.Path()))
+	}
+	isStream := m.stream != nil
+	if isStream && m.stream.ClientStreams {
+		return writeUnaryResponse(c, p, nil, nil, nil, status.Errorf(codes.Unimplemented, "client streaming is not supported over %s", p.name()))
+	}
+	if p.kind == kindConnectUnary && isStream || p.kind == kindConnectStream && !isStream {
+		return writeUnaryResponse(c, p, nil, nil, nil, status.Errorf(codes.Unimplemented, "%s does not match the method type", p.name()))
+	}
+
+	req, err := readRequest(c.Body(), p)
+	if err != nil {
+		return writeUnaryResponse(c, p, nil, nil, nil, err)
+	}
+	ctx, cancel := newContext(c, p)
+
+	if !isStream {
+		defer cancel()
+		resp, header, trailer, err := h.invokeUnary(ctx, m, req, p.codec)
+		return writeUnaryResponse(c, p, resp, header, trailer, err)
+	}
+
+	c.Status(fiber.StatusOK)
+	c.Set(fiber.HeaderContentType, p.contentType)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		ss := &serverStream{ctx: ctx, cancel: cancel, proto: p, req: req, w: w}
+		err := h.invokeStream(m, ss)
+		ss.finish(err)
+	})
+	return nil
+}
+
+func (h *Handler) invokeUnary(ctx context.Context, m *method, req []byte, cdc codec) (proto.Message, metadata.MD, metadata.MD, error) {
+	ts := &transportStream{method: m.fullName}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, ts)
+	dec := func(v any) error {
+		if err := cdc.Unmarshal(req, v.(proto.Message)); err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+		}
+		return nil
+	}
+	resp, err := m.unary.Handler(m.srv, ctx, dec, h.unaryInterceptor)
+	if err != nil {
+		return nil, ts.header, ts.trailer, err
+	}
+	return resp.(proto.Message), ts.header, ts.trailer, nil
+}
+
+func (h *Handler) invokeStream(m *method, ss *serverStream) error {
+	if h.streamInterceptor == nil {
+		return m.stream.Handler(m.srv, ss)
+	}
+	info := &grpc.StreamServerInfo{
+		FullMethod:     m.fullName,
+		IsClientStream: m.stream.ClientStreams,
+		IsServerStream: m.stream.ServerStreams,
+	}
+	return h.streamInterceptor(m.srv, ss, info, m.stream.Handler)
+}
+
+// reservedHeaders are HTTP headers that are not passed on as gRPC metadata.
+var reservedHeaders = map[string]bool{
+	"connection":        true,
+	"content-length":    true,
+	"content-type":      true,
+	"host":              true,
+	"te":                true,
+	"transfer-encoding": true,
+}
+
+// newContext builds the call context carrying the request headers as
+// incoming metadata, the peer address and TLS state, and the deadline.
+func newContext(c *fiber.Ctx, p *protocol) (context.Context, context.CancelFunc) {
+	md := metadata.MD{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		k := strings.ToLower(string(key))
+		if reservedHeaders[k] {
+			return
+		}
+		v := string(value)
+		if strings.HasSuffix(k, "-bin") {
+			if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+				v = string(b)
+			} else if b, err := base64.RawStdEncoding.DecodeString(v); err == nil {
+				v = string(b)
+			}
+		}
+		md.Append(k, v)
+	})
+
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	pr := &peer.Peer{Addr: c.Context().RemoteAddr()}
+	if state := c.Context().TLSConnectionState(); state != nil {
+		pr.AuthInfo = credentials.TLSInfo{
+			State:          *state,
+			CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		}
+	}
+	ctx = peer.NewContext(ctx, pr)
+
+	if timeout, ok := p.timeout(c); ok {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// transportStream collects the header and trailer metadata set by unary
+// handlers through grpc.SetHeader and grpc.SetTrailer.
+type transportStream struct {
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// parseTimeout parses a grpc-timeout header value such as "10S" or "500m".
+func parseTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	var n int64
+	for _, ch := range value[:len(value)-1] {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(ch-'0')
+	}
+	return time.Duration(n) * unit, true
+}
@@ -0,0 +1,340 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Envelope flags. gRPC-Web marks the trailers frame with 0x80 and Connect
+// marks the end-of-stream message with 0x02.
+const (
+	flagCompressed     byte = 0x01
+	flagConnectEnd     byte = 0x02
+	flagGRPCWebTrailer byte = 0x80
+)
+
+type protocolKind int
+
+const (
+	kindGRPCWeb       protocolKind = iota // application/grpc-web[+proto|+json]
+	kindConnectUnary                      // application/proto, application/json
+	kindConnectStream                     // application/connect+proto, application/connect+json
+)
+
+type protocol struct {
+	kind        protocolKind
+	text        bool // application/grpc-web-text, base64 encoded frames
+	codec       codec
+	contentType string
+}
+
+func (p *protocol) name() string {
+	if p.kind == kindGRPCWeb {
+		return "gRPC-Web"
+	}
+	return "Connect"
+}
+
+// parseContentType selects the protocol and codec from the request content
+// type. The response uses the same content type.
+func parseContentType(contentType string) (*protocol, bool) {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	p := &protocol{contentType: mediaType}
+	switch mediaType {
+	case "application/grpc-web", "application/grpc-web+proto":
+		p.kind, p.codec = kindGRPCWeb, protoCodec{}
+	case "application/grpc-web+json":
+		p.kind, p.codec = kindGRPCWeb, jsonCodec{}
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		p.kind, p.codec, p.text = kindGRPCWeb, protoCodec{}, true
+	case "application/proto":
+		p.kind, p.codec = kindConnectUnary, protoCodec{}
+	case "application/json":
+		p.kind, p.codec = kindConnectUnary, jsonCodec{}
+	case "application/connect+proto":
+		p.kind, p.codec = kindConnectStream, protoCodec{}
+	case "application/connect+json":
+		p.kind, p.codec = kindConnectStream, jsonCodec{}
+	default:
+		return nil, false
+	}
+	return p, true
+}
+
+// timeout returns the call timeout requested by the client, if any.
+func (p *protocol) timeout(c *fiber.Ctx) (time.Duration, bool) {
+	if p.kind == kindGRPCWeb {
+		return parseTimeout(c.Get("Grpc-Timeout"))
+	}
+	ms, err := strconv.ParseInt(c.Get("Connect-Timeout-Ms"), 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+type codec interface {
+	Marshal(m proto.Message) ([]byte, error)
+	Unmarshal(data []byte, m proto.Message) error
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(m proto.Message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, m proto.Message) error {
+	return proto.Unmarshal(data, m)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(m proto.Message) ([]byte, error) {
+	return protojson.Marshal(m)
+}
+
+func (jsonCodec) Unmarshal(data []byte, m proto.Message) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// readRequest extracts the single request message from the body. The
+// returned slice does not alias the fiber request buffer, which is reused
+// once the handler returns.
+func readRequest(body []byte, p *protocol) ([]byte, error) {
+	if p.kind == kindConnectUnary {
+		return bytes.Clone(body), nil
+	}
+	if p.text {
+		decoded, err := decodeBase64Chunks(body)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid base64 request body: %v", err)
+		}
+		body = decoded
+	}
+	if len(body) < 5 {
+		return nil, status.Errorf(codes.InvalidArgument, "missing request message")
+	}
+	flags, length := body[0], binary.BigEndian.Uint32(body[1:5])
+	if flags&flagCompressed != 0 {
+		return nil, status.Errorf(codes.Unimplemented, "compressed messages are not supported")
+	}
+	if uint64(len(body)-5) < uint64(length) {
+		return nil, status.Errorf(codes.InvalidArgument, "truncated request message")
+	}
+	return bytes.Clone(body[5 : 5+length]), nil
+}
+
+// decodeBase64Chunks decodes gRPC-Web text bodies, which may consist of
+// several independently padded base64 chunks.
+func decodeBase64Chunks(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '=')
+		if end < 0 {
+			end = len(data)
+		} else {
+			for end < len(data) && data[end] == '=' {
+				end++
+			}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(data[:end]))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, decoded...)
+		data = data[end:]
+	}
+	return out, nil
+}
+
+// writeEnvelope writes a length-prefixed message frame.
+func writeEnvelope(w io.Writer, flags byte, data []byte, text bool) error {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	if text {
+		_, err := io.WriteString(w, base64.StdEncoding.EncodeToString(frame))
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// writeEnd writes the final frame of a gRPC-Web or Connect streaming
+// response carrying the call status and trailers.
+func writeEnd(w io.Writer, p *protocol, err error, trailer metadata.MD) error {
+	st := status.Convert(err)
+	if p.kind == kindGRPCWeb {
+		return writeEnvelope(w, flagGRPCWebTrailer, grpcWebTrailers(st, trailer), p.text)
+	}
+	end := connectEndStream{Metadata: trailer}
+	if st.Code() != codes.OK {
+		end.Error = newConnectError(st)
+	}
+	data, jsonErr := json.Marshal(end)
+	if jsonErr != nil {
+		return jsonErr
+	}
+	return writeEnvelope(w, flagConnectEnd, data, false)
+}
+
+func grpcWebTrailers(st *status.Status, trailer metadata.MD) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", st.Code())
+	fmt.Fprintf(&b, "grpc-message: %s\r\n", encodeGRPCMessage(st.Message()))
+	for key, values := range trailer {
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = base64.RawStdEncoding.EncodeToString([]byte(value))
+			}
+			fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+		}
+	}
+	return b.Bytes()
+}
+
+// encodeGRPCMessage percent-encodes the status message as required by the
+// gRPC HTTP/2 protocol.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		ch := msg[i]
+		if ch >= ' ' && ch <= '~' && ch != '%' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// writeUnaryResponse writes a complete response for a unary call, or the
+// error of a call rejected before it started.
+func writeUnaryResponse(c *fiber.Ctx, p *protocol, resp proto.Message, header, trailer metadata.MD, err error) error {
+	setMetadataHeaders(c, header, "")
+	if p.kind != kindConnectUnary {
+		var body bytes.Buffer
+		if err == nil && resp != nil {
+			data, marshalErr := p.codec.Marshal(resp)
+			if marshalErr != nil {
+				err = status.Errorf(codes.Internal, "failed to encode response: %v", marshalErr)
+			} else {
+				writeEnvelope(&body, 0, data, p.text)
+			}
+		}
+		writeEnd(&body, p, err, trailer)
+		c.Set(fiber.HeaderContentType, p.contentType)
+		return c.Status(fiber.StatusOK).Send(body.Bytes())
+	}
+
+	setMetadataHeaders(c, trailer, "Trailer-")
+	if err == nil {
+		data, marshalErr := p.codec.Marshal(resp)
+		if marshalErr == nil {
+			c.Set(fiber.HeaderContentType, p.contentType)
+			return c.Status(fiber.StatusOK).Send(data)
+		}
+		err = status.Errorf(codes.Internal, "failed to encode response: %v", marshalErr)
+	}
+	st := status.Convert(err)
+	data, jsonErr := json.Marshal(newConnectError(st))
+	if jsonErr != nil {
+		return jsonErr
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(connectHTTPStatus(st.Code())).Send(data)
+}
+
+func setMetadataHeaders(c *fiber.Ctx, md metadata.MD, prefix string) {
+	for key, values := range md {
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = base64.RawStdEncoding.EncodeToString([]byte(value))
+			}
+			c.Response().Header.Add(prefix+key, value)
+		}
+	}
+}
+
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type connectEndStream struct {
+	Error    *connectError `json:"error,omitempty"`
+	Metadata metadata.MD   `json:"metadata,omitempty"`
+}
+
+func newConnectError(st *status.Status) *connectError {
+	return &connectError{Code: connectCodes[st.Code()], Message: st.Message()}
+}
+
+// connectCodes are the Connect protocol names of the gRPC status codes.
+var connectCodes = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+// connectHTTPStatus maps a status code to the HTTP status of a Connect
+// unary error response.
+func connectHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return fiber.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return fiber.StatusGatewayTimeout
+	case codes.NotFound:
+		return fiber.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return fiber.StatusConflict
+	case codes.PermissionDenied:
+		return fiber.StatusForbidden
+	case codes.ResourceExhausted:
+		return fiber.StatusTooManyRequests
+	case codes.Unimplemented:
+		return fiber.StatusNotImplemented
+	case codes.Unavailable:
+		return fiber.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return fiber.StatusUnauthorized
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,99 @@
+package grpcweb
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var errStreamClosed = status.Error(codes.Unavailable, "stream closed")
+
+// serverStream implements grpc.ServerStream on top of a streamed HTTP/1.1
+// response. The response headers are already sent when the handler runs, so
+// header metadata is ignored; trailers are sent in the final frame.
+type serverStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	proto  *protocol
+	req    []byte
+
+	received bool
+
+	mu      sync.Mutex
+	w       *bufio.Writer
+	closed  bool
+	trailer metadata.MD
+}
+
+func (s *serverStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg writes and flushes one message. A write error means the client
+// went away, which cancels the call context so the handler returns.
+func (s *serverStream) SendMsg(m any) error {
+	data, err := s.proto.codec.Marshal(m.(proto.Message))
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errStreamClosed
+	}
+	if err := writeEnvelope(s.w, 0, data, s.proto.text); err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		s.closed = true
+		s.cancel()
+		return errStreamClosed
+	}
+	return nil
+}
+
+// RecvMsg returns the single request message, then io.EOF.
+func (s *serverStream) RecvMsg(m any) error {
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+	if err := s.proto.codec.Unmarshal(s.req, m.(proto.Message)); err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+	}
+	return nil
+}
+
+// finish writes the final status frame. Messages sent afterwards, e.g. by a
+// broadcast racing with the handler return, are dropped.
+func (s *serverStream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if writeEnd(s.w, s.proto, err, s.trailer) == nil {
+		s.w.Flush()
+	}
+}
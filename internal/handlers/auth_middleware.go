@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+const identityLocalsKey = "identity"
+
+var (
+	ErrUnauthorized      = NewAPIError(fiber.StatusUnauthorized, "unauthorized", "UNAUTHORIZED")
+	ErrTokenExpired      = NewAPIError(fiber.StatusUnauthorized, "access token expired", "TOKEN_EXPIRED")
+	ErrInsufficientScope = NewAPIError(fiber.StatusForbidden, "insufficient scope", "INSUFFICIENT_SCOPE")
+)
+
+// AuthMiddleware authenticates the bearer token or client certificate of each
+// request and stores the caller identity in the request locals. A nil
+// authenticator disables authentication and every request is treated as
+// anonymous admin.
+func AuthMiddleware(authenticator auth.Authenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if authenticator == nil {
+			c.Locals(identityLocalsKey, auth.AnonymousIdentity)
+			return c.Next()
+		}
+		token := auth.ParseBearerToken(c.Get(fiber.HeaderAuthorization))
+		var peerCerts []*x509.Certificate
+		if state := c.Context().TLSConnectionState(); state != nil {
+			peerCerts = state.PeerCertificates
+		}
+		identity, err := auth.AuthenticateRequest(authenticator, token, peerCerts)
+		if err != nil {
+			if errors.Is(err, auth.ErrTokenExpired) {
+				return ErrTokenExpired
+			}
+			return ErrUnauthorized
+		}
+		c.Locals(identityLocalsKey, identity)
+		return c.Next()
+	}
+}
+
+// RequireScope rejects requests whose identity was not granted scope.
+func RequireScope(scope auth.Scope) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity := identityFrom(c)
+		if identity == nil {
+			return ErrUnauthorized
+		}
+		if !identity.HasScope(scope) {
+			return ErrInsufficientScope
+		}
+		return c.Next()
+	}
+}
+
+// identityFrom returns the identity stored by AuthMiddleware.
+func identityFrom(c *fiber.Ctx) *auth.Identity {
+	identity, _ := c.Locals(identityLocalsKey).(*auth.Identity)
+	return identity
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+
+	// extractProgressInterval limits how often progress lines are streamed
+	extractProgressInterval = 500 * time.Millisecond
+)
+
+// extractEvent is a line of a streamed extract response: progress updates
+// followed by either the result or the error.
+type extractEvent struct {
+	Progress *file.ExtractProgress `json:"progress,omitempty"`
+	Result   *file.ExtractResult   `json:"result,omitempty"`
+	Error    *APIError             `json:"error,omitempty"`
+}
+
+func mapArchiveError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, file.ErrUnsupportedArchive):
+		return NewAPIError(fiber.StatusBadRequest, err.Error(), "UNSUPPORTED_ARCHIVE")
+	case errors.Is(err, file.ErrUnsafeArchivePath):
+		return NewAPIError(fiber.StatusBadRequest, err.Error(), "UNSAFE_ARCHIVE_PATH")
+	case errors.Is(err, file.ErrAlreadyExists):
+		return NewAPIError(fiber.StatusConflict, err.Error(), "FILE_EXISTS")
+	case errors.Is(err, file.ErrIsDirectory), errors.Is(err, file.ErrNotDirectory):
+		return BadRequestError(err.Error())
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// toAPIError converts a handler error for responses that are already being
+// streamed and cannot go through the error handler.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return &APIError{Code: fiberErr.Code, Message: fiberErr.Message}
+	}
+	return &APIError{Code: fiber.StatusInternalServerError, Message: err.Error()}
+}
+
+// sendArchive streams the directory at rel as an archive, leaving out the
+// files the caller may not access.
+func (h *FSHandler) sendArchive(c *fiber.Ctx, rel string, formatName string) error {
+	format, err := file.ParseArchiveFormat(formatName)
+	if err != nil {
+		return BadRequestError(err.Error())
+	}
+	name := filepath.Base(rel)
+	if rel == "" {
+		name = "root"
+	}
+	files := h.files(c)
+	if err := files.CheckRead(rel); err != nil {
+		return mapLocalFileServiceError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, format.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name+"."+string(format)))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// the status is already sent, a failure leaves a truncated archive
+		if err := files.WriteArchive(w, rel, format); err != nil {
+			logger.Errorln("Failed to write archive", "path", rel, "error", err)
+		}
+	})
+	return nil
+}
+
+// runExtract runs an extraction. Clients accepting application/x-ndjson get
+// progress lines while it runs, others get the result once it completes.
+// extract may run after the handler returned and must not use ctx.
+func (h *FSHandler) runExtract(ctx *fiber.Ctx, onConflict string, extract func(opts file.ExtractOptions) (*file.ExtractResult, error)) error {
+	policy, err := file.ParseConflictPolicy(onConflict)
+	if err != nil {
+		return BadRequestError(err.Error())
+	}
+	opts := file.ExtractOptions{OnConflict: policy}
+	if !strings.Contains(ctx.Get(fiber.HeaderAccept), mimeNDJSON) {
+		result, err := extract(opts)
+		if err != nil {
+			return mapArchiveError(ctx, err)
+		}
+		return ctx.JSON(APIResponse{
+			Data: result,
+		})
+	}
+
+	ctx.Set(fiber.HeaderContentType, mimeNDJSON)
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		var lastSent time.Time
+		opts.Progress = func(progress file.ExtractProgress) {
+			if time.Since(lastSent) < extractProgressInterval {
+				return
+			}
+			lastSent = time.Now()
+			enc.Encode(extractEvent{Progress: &progress})
+			w.Flush()
+		}
+		result, err := extract(opts)
+		event := extractEvent{Result: result}
+		if err != nil {
+			// ctx is released once the handler returned, never use it here
+			event.Error = toAPIError(mapArchiveError(nil, err))
+		}
+		enc.Encode(event)
+	})
+	return nil
+}
+
+// handleExtract unpacks an existing archive into the directory at rel.
+func (h *FSHandler) handleExtract(ctx *fiber.Ctx, rel, archive, onConflict string) error {
+	if strings.TrimSpace(archive) == "" {
+		return BadRequestError("missing archive path")
+	}
+	files := h.files(ctx)
+	return h.runExtract(ctx, onConflict, func(opts file.ExtractOptions) (*file.ExtractResult, error) {
+		return files.Extract(archive, rel, opts)
+	})
+}
+
+// handleExtractUpload unpacks an uploaded archive into the directory at rel
+// without storing the archive itself.
+func (h *FSHandler) handleExtractUpload(ctx *fiber.Ctx, rel string, upload *multipart.FileHeader) error {
+	files := h.files(ctx)
+	return h.runExtract(ctx, ctx.FormValue("onConflict"), func(opts file.ExtractOptions) (*file.ExtractResult, error) {
+		src, err := upload.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+		return files.ExtractReader(src, upload.Size, rel, opts)
+	})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrRangeNotSatisfiable = NewAPIError(fiber.StatusRequestedRangeNotSatisfiable, "requested range not satisfiable", "RANGE_NOT_SATISFIABLE")
+
+// quoteETag formats an entity tag of the file service as a strong HTTP
+// entity tag.
+func quoteETag(etag string) string {
+	return "\"" + etag + "\""
+}
+
+// parseIfMatch returns the entity tags listed in an If-Match header value
+// without their quotes. Weak tags never match If-Match and are dropped.
+func parseIfMatch(header string) []string {
+	var etags []string
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			etags = append(etags, candidate)
+		} else if len(candidate) >= 2 && strings.HasPrefix(candidate, "\"") && strings.HasSuffix(candidate, "\"") {
+			etags = append(etags, candidate[1:len(candidate)-1])
+		}
+	}
+	return etags
+}
+
+// etagMatches reports whether etag is listed in an If-None-Match or If-Match
+// header value. Weak comparison ignores the W/ prefix.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match, then If-Modified-Since when no entity
+// tags were sent, as specified by RFC 9110 section 13.2.2.
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if inm := c.Get(fiber.HeaderIfNoneMatch); inm != "" {
+		return etagMatches(inm, etag, true)
+	}
+	if ims := c.Get(fiber.HeaderIfModifiedSince); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !lastModified.After(t)
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether the Range header should be honored. An
+// If-Range validator must match exactly, otherwise the whole file is sent.
+func ifRangeMatches(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	ifRange := c.Get(fiber.HeaderIfRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && t.Equal(lastModified)
+}
+
+// parseRange parses a single "bytes=" range against size. It returns ok false
+// for headers that should be ignored, such as other units or multiple ranges,
+// and ErrRangeNotSatisfiable when the range lies beyond the end of the file.
+func parseRange(header string, size int64) (start, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	if first == "" {
+		// suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, perr = strconv.ParseInt(last, 10, 64)
+		if perr != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, ErrRangeNotSatisfiable
+	}
+	return start, end - start + 1, true, nil
+}
+
+// sectionReadCloser streams a section of a file and closes the file once the
+// response body has been written.
+type sectionReadCloser struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (s *sectionReadCloser) Close() error {
+	return s.file.Close()
+}
+
+// sendFile streams the file at rel without buffering it in memory, handling
+// conditional and range requests.
+func (h *FSHandler) sendFile(c *fiber.Ctx, rel string) error {
+	files := h.files(c)
+	f, fi, err := files.Open(rel)
+	if err != nil {
+		return mapLocalFileServiceError(c, err)
+	}
+
+	size := fi.Size()
+	etag, err := files.FileETag(f, fi)
+	if err != nil {
+		f.Close()
+		return mapLocalFileServiceError(c, err)
+	}
+	etag = quoteETag(etag)
+	lastModified := fi.ModTime().UTC().Truncate(time.Second)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if notModified(c, etag, lastModified) {
+		f.Close()
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	mime, _ := files.DetectMIMEType(rel)
+	if mime != "" {
+		c.Set(fiber.HeaderContentType, mime)
+	}
+	if strings.EqualFold(c.Query("download"), "true") {
+		// Force download
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filepath.Base(rel)))
+	}
+
+	start, length := int64(0), size
+	if rangeHeader := c.Get(fiber.HeaderRange); rangeHeader != "" && ifRangeMatches(c, etag, lastModified) {
+		rangeStart, rangeLength, ok, err := parseRange(rangeHeader, size)
+		if err != nil {
+			f.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return err
+		}
+		if ok {
+			start, length = rangeStart, rangeLength
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+			c.Status(fiber.StatusPartialContent)
+		}
+	}
+	return c.SendStream(&sectionReadCloser{io.NewSectionReader(f, start, length), f}, int(length))
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxListLimit = 10000
+	maxListDepth = 8
+
+	// maxTreeEntries caps the entries of a recursive listing, deeper levels
+	// are cut off once it is reached
+	maxTreeEntries = 50000
+
+	headerNextCursor = "X-Next-Cursor"
+	headerTotalCount = "X-Total-Count"
+	headerTruncated  = "X-Truncated"
+)
+
+// listEntry is an entry of a directory listing. Children are only set in
+// recursive listings.
+type listEntry struct {
+	Name         string      `json:"name"`
+	Type         FileType    `json:"type"`
+	Size         int64       `json:"size"`
+	LastModified string      `json:"lastModified"` // RFC3339 per design doc
+	Mode         string      `json:"mode"`         // permission bits in octal, e.g. "0644"
+	Owner        string      `json:"owner,omitempty"`
+	Group        string      `json:"group,omitempty"`
+	Target       string      `json:"target,omitempty"` // symlink target
+	Children     []listEntry `json:"children,omitempty"`
+
+	modTime time.Time
+}
+
+// listOptions are the query parameters of a directory listing.
+type listOptions struct {
+	Sort   string // name, size or mtime
+	Desc   bool
+	Type   FileType // 0 for any
+	Glob   string
+	Limit  int // 0 for no limit
+	Cursor *listCursor
+	Depth  int
+}
+
+// listCursor is the position after the last entry of a page: its sort key
+// and name, together with the sort order it belongs to.
+type listCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  int64  `json:"k,omitempty"`
+	Name string `json:"n"`
+}
+
+func (cur *listCursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur listCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// parseListOptions reads and validates the listing query parameters.
+func parseListOptions(c *fiber.Ctx) (*listOptions, error) {
+	opts := &listOptions{
+		Sort:  strings.ToLower(c.Query("sort", "name")),
+		Glob:  c.Query("glob"),
+		Limit: c.QueryInt("limit", 0),
+		Depth: c.QueryInt("depth", 1),
+	}
+	switch opts.Sort {
+	case "name", "size", "mtime":
+	default:
+		return nil, fmt.Errorf("unsupported sort %q, expected name, size or mtime", opts.Sort)
+	}
+	switch order := strings.ToLower(c.Query("order", "asc")); order {
+	case "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return nil, fmt.Errorf("unsupported order %q, expected asc or desc", order)
+	}
+	switch typ := strings.ToLower(c.Query("type")); typ {
+	case "":
+	case "file":
+		opts.Type = FileTypeFile
+	case "dir", "directory":
+		opts.Type = FileTypeDirectory
+	case "symlink":
+		opts.Type = FileTypeSymbolicLink
+	default:
+		return nil, fmt.Errorf("unsupported type %q, expected file, dir or symlink", typ)
+	}
+	if opts.Glob != "" {
+		if _, err := path.Match(opts.Glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q", opts.Glob)
+		}
+	}
+	if opts.Limit < 0 || opts.Limit > maxListLimit {
+		return nil, fmt.Errorf("limit must be between 0 and %d, 0 lists everything", maxListLimit)
+	}
+	if opts.Depth < 1 || opts.Depth > maxListDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", maxListDepth)
+	}
+	if s := c.Query("cursor"); s != "" {
+		cur, err := decodeListCursor(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		if cur.Sort != opts.Sort || cur.Desc != opts.Desc {
+			return nil, fmt.Errorf("cursor belongs to a different sort order")
+		}
+		opts.Cursor = cur
+	}
+	return opts, nil
+}
+
+// key returns the value entries are sorted by besides their name.
+func (o *listOptions) key(e *listEntry) int64 {
+	switch o.Sort {
+	case "size":
+		return e.Size
+	case "mtime":
+		return e.modTime.UnixNano()
+	}
+	return 0
+}
+
+// compare orders entries by the sort key, then by name.
+func (o *listOptions) compare(a, b *listEntry) int {
+	c := cmp.Or(cmp.Compare(o.key(a), o.key(b)), strings.Compare(a.Name, b.Name))
+	if o.Desc {
+		return -c
+	}
+	return c
+}
+
+// after reports whether the entry comes after the cursor.
+func (o *listOptions) after(e *listEntry, cur *listCursor) bool {
+	c := cmp.Or(cmp.Compare(o.key(e), cur.Key), strings.Compare(e.Name, cur.Name))
+	if o.Desc {
+		return c < 0
+	}
+	return c > 0
+}
+
+// match reports whether the entry passes the type and glob filters.
+func (o *listOptions) match(e *listEntry) bool {
+	if o.Type != 0 && e.Type != o.Type {
+		return false
+	}
+	if o.Glob != "" {
+		ok, _ := path.Match(strings.ToLower(o.Glob), strings.ToLower(e.Name))
+		return ok
+	}
+	return true
+}
+
+// dirLister builds the entries of a listing, counting them against
+// maxTreeEntries. Entries only searched for a match below them are counted
+// apart, so that counting the skipped pages cannot cut the returned one.
+type dirLister struct {
+	files   LocalFileService
+	opts    *listOptions
+	count   int
+	scanned int
+	cut     bool
+}
+
+// entries returns the visible entries of the directory at rel, sorted and
+// without children.
+func (l *dirLister) entries(rel string) ([]listEntry, error) {
+	items, err := l.files.List(rel)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]listEntry, 0, len(items))
+	for _, it := range items {
+		entry := newListEntry(it)
+		if entry.Type == FileTypeSymbolicLink {
+			entry.Target, _ = l.files.Readlink(filepath.Join(rel, it.Name()))
+		}
+		out = append(out, entry)
+	}
+	slices.SortFunc(out, func(a, b listEntry) int { return l.opts.compare(&a, &b) })
+	return out, nil
+}
+
+// list returns the sorted and filtered entries of the directory at rel, with
+// their children down to depth levels.
+func (l *dirLister) list(rel string, depth int) ([]listEntry, error) {
+	items, err := l.entries(rel)
+	if err != nil {
+		return nil, err
+	}
+	out := items[:0]
+	for _, entry := range items {
+		if l.keep(filepath.Join(rel, entry.Name), &entry, depth) {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// keep fills in the children of the entry at p down to depth levels and
+// reports whether it stays in the listing: directories stay in a filtered
+// tree while something below matches.
+func (l *dirLister) keep(p string, entry *listEntry, depth int) bool {
+	if entry.Type == FileTypeDirectory && depth > 1 {
+		if l.count >= maxTreeEntries {
+			l.cut = true
+		} else if children, err := l.list(p, depth-1); err == nil {
+			entry.Children = children
+		}
+	}
+	if !l.opts.match(entry) && len(entry.Children) == 0 {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// counts reports whether the entry at p would stay in the listing, without
+// building its children.
+func (l *dirLister) counts(p string, entry *listEntry, depth int) bool {
+	if l.opts.match(entry) {
+		return true
+	}
+	return entry.Type == FileTypeDirectory && depth > 1 && l.matchesBelow(p, depth-1)
+}
+
+// matchesBelow reports whether an entry of the directory at rel, or below it
+// down to depth levels, passes the filters. It stops at the first match.
+func (l *dirLister) matchesBelow(rel string, depth int) bool {
+	items, err := l.files.List(rel)
+	if err != nil {
+		return false
+	}
+	for _, it := range items {
+		if l.scanned >= maxTreeEntries {
+			l.cut = true
+			return false
+		}
+		l.scanned++
+		entry := newListEntry(it)
+		if l.counts(filepath.Join(rel, it.Name()), &entry, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the top level page of the listing of rel after the cursor,
+// with the children of its entries, the number of entries of all pages and
+// the cursor of the next page, nil on the last one. Only the entries of the
+// page are listed in depth, the others are searched for a match below them
+// when a filter is set.
+func (l *dirLister) page(rel string) ([]listEntry, int, *listCursor, error) {
+	top, err := l.entries(rel)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	opts := l.opts
+	out := make([]listEntry, 0, len(top))
+	total := 0
+	var next *listCursor
+	for _, entry := range top {
+		p := filepath.Join(rel, entry.Name)
+		pending := opts.Cursor == nil || opts.after(&entry, opts.Cursor)
+		if pending && (opts.Limit == 0 || len(out) < opts.Limit) {
+			if l.keep(p, &entry, opts.Depth) {
+				out = append(out, entry)
+				total++
+			}
+			continue
+		}
+		if !l.counts(p, &entry, opts.Depth) {
+			continue
+		}
+		total++
+		if pending && next == nil {
+			// the page is full and more entries follow
+			last := &out[len(out)-1]
+			next = &listCursor{Sort: opts.Sort, Desc: opts.Desc, Key: opts.key(last), Name: last.Name}
+		}
+	}
+	return out, total, next, nil
+}
+
+func newListEntry(fi fs.FileInfo) listEntry {
+	entry := listEntry{
+		Name:         fi.Name(),
+		Type:         fileTypeOf(fi),
+		Size:         fi.Size(),
+		LastModified: fi.ModTime().UTC().Format(time.RFC3339),
+		Mode:         octalMode(fi.Mode()),
+		modTime:      fi.ModTime(),
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		entry.Owner = ownerNames.user(st.Uid)
+		entry.Group = ownerNames.group(st.Gid)
+	}
+	return entry
+}
+
+// octalMode formats the permission and special bits of a mode like chmod.
+func octalMode(mode fs.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// idNames caches the user and group names of numeric ids, ids without a name
+// are reported as numbers.
+type idNames struct {
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+var ownerNames = &idNames{users: map[uint32]string{}, groups: map[uint32]string{}}
+
+func (n *idNames) user(uid uint32) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	name, ok := n.users[uid]
+	if !ok {
+		id := strconv.FormatUint(uint64(uid), 10)
+		name = id
+		if u, err := user.LookupId(id); err == nil {
+			name = u.Username
+		}
+		n.users[uid] = name
+	}
+	return name
+}
+
+func (n *idNames) group(gid uint32) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	name, ok := n.groups[gid]
+	if !ok {
+		id := strconv.FormatUint(uint64(gid), 10)
+		name = id
+		if g, err := user.LookupGroupId(id); err == nil {
+			name = g.Name
+		}
+		n.groups[gid] = name
+	}
+	return name
+}
+
+// sendList lists the directory at rel as a JSON array, sorted by sort=name,
+// size or mtime in order=asc or desc and filtered by type=file, dir or
+// symlink and a case-insensitive name glob. depth > 1 nests the entries of
+// subdirectories as children; filters apply at every level, keeping the
+// directories that lead to a match. limit pages the top level: the cursor
+// for the next page is returned in X-Next-Cursor and the number of matching
+// entries in X-Total-Count.
+func (h *FSHandler) sendList(c *fiber.Ctx, rel string) error {
+	opts, err := parseListOptions(c)
+	if err != nil {
+		return BadRequestError(err.Error())
+	}
+	lister := &dirLister{files: h.files(c), opts: opts}
+	out, total, next, err := lister.page(rel)
+	if err != nil {
+		return mapLocalFileServiceError(c, err)
+	}
+	c.Set(headerTotalCount, strconv.Itoa(total))
+	if lister.cut {
+		c.Set(headerTruncated, "true")
+	}
+	if next != nil {
+		c.Set(headerNextCursor, next.encode())
+	}
+	return c.Status(fiber.StatusOK).JSON(out)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+const (
+	defaultSearchContext  = 2
+	maxSearchContext      = 10
+	defaultSearchFileSize = 8 << 20
+	maxSearchFileSize     = 64 << 20
+	defaultSearchMatches  = 1000
+	maxSearchMatches      = 10000
+
+	// searchTimeout ends searches whose client stopped reading
+	searchTimeout = 5 * time.Minute
+)
+
+// searchMatch is a line of a search response. Name matches carry the entry
+// metadata only, content matches also the matching line and its context.
+type searchMatch struct {
+	Path         string   `json:"path"`
+	Type         FileType `json:"type"`
+	Size         int64    `json:"size"`
+	LastModified string   `json:"lastModified"`
+	Line         int      `json:"line,omitempty"`
+	Text         string   `json:"text,omitempty"`
+	Before       []string `json:"before,omitempty"`
+	After        []string `json:"after,omitempty"`
+}
+
+// searchEvent is the last line of a search response.
+type searchEvent struct {
+	Done  *file.SearchSummary `json:"done,omitempty"`
+	Error *APIError           `json:"error,omitempty"`
+}
+
+// searchOptions reads the search query parameters, clamping the limits.
+func searchOptions(c *fiber.Ctx) file.SearchOptions {
+	return file.SearchOptions{
+		Name:        c.Query("search"),
+		Content:     c.Query("content"),
+		Regex:       strings.EqualFold(c.Query("regex"), "true"),
+		IgnoreCase:  strings.EqualFold(c.Query("ignoreCase"), "true"),
+		Context:     min(max(c.QueryInt("context", defaultSearchContext), 0), maxSearchContext),
+		MaxFileSize: int64(min(max(c.QueryInt("maxSize", defaultSearchFileSize), 1), maxSearchFileSize)),
+		MaxMatches:  min(max(c.QueryInt("limit", defaultSearchMatches), 1), maxSearchMatches),
+	}
+}
+
+// sendSearch streams the matches of a search in the directory at rel as
+// newline delimited JSON, ending with a summary line. Entries the caller may
+// not access are neither reported nor searched. The search stops when the
+// client goes away.
+func (h *FSHandler) sendSearch(c *fiber.Ctx, rel string) error {
+	opts := searchOptions(c)
+	if err := opts.Validate(); err != nil {
+		return BadRequestError(err.Error())
+	}
+	files := h.files(c)
+	if err := files.CheckRead(rel); err != nil {
+		return mapLocalFileServiceError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, mimeNDJSON)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+		defer cancel()
+		enc := json.NewEncoder(w)
+		emit := func(m file.SearchMatch) error {
+			enc.Encode(searchMatch{
+				Path:         m.Path,
+				Type:         fileTypeOf(m.Info),
+				Size:         m.Info.Size(),
+				LastModified: m.Info.ModTime().UTC().Format(time.RFC3339),
+				Line:         m.Line,
+				Text:         m.Text,
+				Before:       m.Before,
+				After:        m.After,
+			})
+			// a failed flush means the client disconnected
+			return w.Flush()
+		}
+		summary, err := files.Search(ctx, rel, opts, emit)
+		event := searchEvent{Done: summary}
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				logger.Warnln("Search timed out", "path", rel)
+			}
+			// c is released once the handler returned, never use it here
+			event.Error = toAPIError(mapLocalFileServiceError(nil, err))
+		}
+		enc.Encode(event)
+	})
+	return nil
+}
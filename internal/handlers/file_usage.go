@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendUsage reports the disk usage of the directory at rel broken down by its
+// entries, largest first. Sizes come from a cached scan, refresh=true scans
+// the directory again. Entries the caller may not access are left out.
+func (h *FSHandler) sendUsage(c *fiber.Ctx, rel string) error {
+	usage, err := h.files(c).Usage(rel, strings.EqualFold(c.Query("refresh"), "true"))
+	if err != nil {
+		return mapLocalFileServiceError(c, err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(usage)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+// watchKeepAlive is the interval of the comments sent on idle event streams,
+// which keep proxies from closing them and detect disconnected clients.
+const watchKeepAlive = 30 * time.Second
+
+// sendEvents streams the changes below the directory at rel as server-sent
+// events named after the operation, carrying the event as JSON. Changes to
+// paths the caller may not see are not sent.
+func (h *FSHandler) sendEvents(c *fiber.Ctx, rel string) error {
+	sub, err := h.watcher.Subscribe(rel, identityFrom(c))
+	if err != nil {
+		if errors.Is(err, file.ErrWatcherClosed) {
+			return fiber.ErrServiceUnavailable
+		}
+		return mapLocalFileServiceError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		keepAlive := time.NewTicker(watchKeepAlive)
+		defer keepAlive.Stop()
+		// tell the client that the watch is in place
+		fmt.Fprint(w, ": watching\n\n")
+		if w.Flush() != nil {
+			return
+		}
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Op, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
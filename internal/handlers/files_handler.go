@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/fs"
 	"net/url"
 	"os"
@@ -17,10 +16,14 @@ import (
 )
 
 var (
-	ErrFileExists        = NewAPIError(fiber.StatusConflict, "file is already exists", "FILE_EXISTS")
-	ErrFileNotFound      = NewAPIError(fiber.StatusNotFound, "file not found", "FILE_NOT_FOUND")
-	ErrNoPermissions     = NewAPIError(fiber.StatusForbidden, "no permissions", "NO_PERMISSIONS")
-	ErrDirectoryNotEmpty = NewAPIError(fiber.StatusBadRequest, "directory is not empty", "DIRECTORY_NOT_EMPTY")
+	ErrFileExists         = NewAPIError(fiber.StatusConflict, "file is already exists", "FILE_EXISTS")
+	ErrFileNotFound       = NewAPIError(fiber.StatusNotFound, "file not found", "FILE_NOT_FOUND")
+	ErrNoPermissions      = NewAPIError(fiber.StatusForbidden, "no permissions", "NO_PERMISSIONS")
+	ErrDirectoryNotEmpty  = NewAPIError(fiber.StatusBadRequest, "directory is not empty", "DIRECTORY_NOT_EMPTY")
+	ErrSymlinkForbidden   = NewAPIError(fiber.StatusForbidden, "symbolic link cannot be followed", "SYMLINK_FORBIDDEN")
+	ErrReservedPath       = NewAPIError(fiber.StatusForbidden, "path is reserved", "RESERVED_PATH")
+	ErrPreconditionFailed = NewAPIError(fiber.StatusPreconditionFailed, "file has changed", "PRECONDITION_FAILED")
+	ErrMountPoint         = NewAPIError(fiber.StatusConflict, "path is or contains a mount point", "MOUNT_POINT")
 )
 
 type FileType int
@@ -33,11 +36,19 @@ const (
 
 // FSHandler implements the File Explorer API under /api/fs
 type FSHandler struct {
-	svc LocalFileService
+	svc     LocalFileService
+	jobs    *file.JobManager
+	watcher *file.Watcher
 }
 
-func NewFSHandler(svc LocalFileService) *FSHandler {
-	return &FSHandler{svc: svc}
+func NewFSHandler(svc LocalFileService, jobs *file.JobManager, watcher *file.Watcher) *FSHandler {
+	return &FSHandler{svc: svc, jobs: jobs, watcher: watcher}
+}
+
+// files returns the file service as seen by the caller, which applies the
+// path rules for its identity.
+func (h *FSHandler) files(c *fiber.Ctx) LocalFileService {
+	return h.svc.As(identityFrom(c))
 }
 
 // Helper functions
@@ -51,11 +62,64 @@ func mapLocalFileServiceError(ctx *fiber.Ctx, err error) error {
 	if errors.Is(err, file.ErrDirNotEmpty) {
 		return ErrDirectoryNotEmpty
 	}
+	if errors.Is(err, file.ErrSymlinkNotAllowed) {
+		return ErrSymlinkForbidden
+	}
+	if errors.Is(err, file.ErrReservedPath) {
+		return ErrReservedPath
+	}
+	if errors.Is(err, file.ErrAccessDenied) {
+		return NewAPIError(fiber.StatusForbidden, err.Error(), "PATH_DENIED")
+	}
+	if errors.Is(err, file.ErrReadOnlyPath) {
+		return NewAPIError(fiber.StatusForbidden, err.Error(), "READ_ONLY")
+	}
+	if errors.Is(err, file.ErrPreconditionFailed) {
+		return ErrPreconditionFailed
+	}
+	if errors.Is(err, file.ErrMountPoint) {
+		return ErrMountPoint
+	}
+	if errors.Is(err, file.ErrQuotaExceeded) {
+		return NewAPIError(fiber.StatusInsufficientStorage, err.Error(), "QUOTA_EXCEEDED")
+	}
+	if errors.Is(err, file.ErrPathTraversal) {
+		return BadRequestError(err.Error())
+	}
 	return InternalServerError(err)
 }
 
+// ifMatch calls fn under the If-Match precondition of the request, if any.
+func (h *FSHandler) ifMatch(c *fiber.Ctx, rel string, fn func() error) error {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return fn()
+	}
+	return h.files(c).IfMatch(rel, parseIfMatch(header), fn)
+}
+
+// stagedIfMatch returns the entity tags of the If-Match header for a staged
+// change, which checks them when it is staged and again when it is applied.
+func stagedIfMatch(c *fiber.Ctx) ([]string, error) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return nil, nil
+	}
+	etags := parseIfMatch(header)
+	if len(etags) == 0 {
+		// weak tags never match
+		return nil, ErrPreconditionFailed
+	}
+	return etags, nil
+}
+
 // helper: parse wildcard path from route, normalize to relative (no leading slash)
 func (h *FSHandler) pathFromParam(c *fiber.Ctx) string {
+	return pathParam(c)
+}
+
+// pathParam returns the wildcard path of a route, relative and unescaped.
+func pathParam(c *fiber.Ctx) string {
 	p := c.Params("*")
 	// if mounted at exact path without wildcard, fallback to empty
 	if p == "" || p == "/" {
@@ -71,63 +135,55 @@ func (h *FSHandler) pathFromParam(c *fiber.Ctx) string {
 
 // GET /api/v1/fs/*path
 // - Directory: list as JSON array
-// - File: return raw content; when download=true, set Content-Disposition
+// - File: stream raw content with Range and conditional request support; when download=true, set Content-Disposition
 // - With stat=true: return JSON metadata for file or directory
+// - Directory with archive=zip|tar|tar.gz|tar.zst: stream an archive of the directory
+// - Directory with search=<glob|regex>[&content=<text|regex>]: stream matching entries or lines as NDJSON
+// - Directory with watch=true: stream create/modify/delete/rename events of the subtree as SSE
 func (h *FSHandler) Get(c *fiber.Ctx) error {
 	rel := h.pathFromParam(c)
-	fi, err := h.svc.Stat(rel)
+	files := h.files(c)
+	fi, err := files.Stat(rel)
 	if err != nil {
 		return mapLocalFileServiceError(c, err)
 	}
 
 	if strings.EqualFold(c.Query("stat"), "true") {
 		// Return metadata
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		meta := fiber.Map{
 			"type":         fileTypeOf(fi),
 			"size":         fi.Size(),
 			"lastModified": fi.ModTime().UTC().Format(time.RFC3339),
-		})
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			meta["target"], _ = files.Readlink(rel)
+		}
+		if fi.Mode().IsRegular() {
+			if etag, err := files.ETag(rel); err == nil {
+				meta["etag"] = quoteETag(etag)
+			}
+		}
+		return c.Status(fiber.StatusOK).JSON(meta)
 	}
 
 	if fi.IsDir() {
-		items, err := h.svc.List(rel)
-		if err != nil {
-			return mapLocalFileServiceError(c, err)
+		if format := c.Query("archive"); format != "" {
+			return h.sendArchive(c, rel, format)
+		}
+		if c.Context().QueryArgs().Has("search") {
+			return h.sendSearch(c, rel)
 		}
-		// Format lastModified as RFC3339 per design doc
-		type listEntry struct {
-			Name         string   `json:"name"`
-			Type         FileType `json:"type"`
-			Size         int64    `json:"size"`
-			LastModified string   `json:"lastModified"`
+		if strings.EqualFold(c.Query("watch"), "true") {
+			return h.sendEvents(c, rel)
 		}
-		out := make([]listEntry, 0, len(items))
-		for _, it := range items {
-			out = append(out, listEntry{
-				Name:         it.Name(),
-				Type:         fileTypeOf(it),
-				Size:         it.Size(),
-				LastModified: it.ModTime().UTC().Format(time.RFC3339),
-			})
+		if strings.EqualFold(c.Query("usage"), "true") {
+			return h.sendUsage(c, rel)
 		}
-		return c.Status(fiber.StatusOK).JSON(out)
+		return h.sendList(c, rel)
 	}
 
 	// File
-	data, err := h.svc.ReadFile(rel)
-	if err != nil {
-		return mapLocalFileServiceError(c, err)
-	}
-	mime, _ := h.svc.DetectMIMEType(rel)
-	if mime != "" {
-		c.Set(fiber.HeaderContentType, mime)
-	}
-	c.Set(fiber.HeaderContentLength, fmt.Sprintf("%d", len(data)))
-	if strings.EqualFold(c.Query("download"), "true") {
-		// Force download
-		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filepath.Base(rel)))
-	}
-	return c.Send(data)
+	return h.sendFile(c, rel)
 }
 
 // fileTypeOf returns a int type for a given file info.
@@ -143,18 +199,22 @@ func fileTypeOf(info fs.FileInfo) FileType {
 }
 
 // POST /api/v1/fs/*parent { path: <child_path>, type: "file"|"directory", "create": <bool>, "overwrite": <bool> }
+// POST /api/v1/fs/*dir { type: "extract", archive: <archive_path>, onConflict: "fail"|"skip"|"overwrite" }
+// POST /api/v1/fs/*dir { type: "copy", source: <source_path>, path: <child_path>, overwrite: <bool> }
+// - With staged=true: queue the upload, creation or copy until the next start, the directory may not exist yet
 func (h *FSHandler) Post(ctx *fiber.Ctx) error {
 	rel := h.pathFromParam(ctx)
 
 	// Check that target directory exists
-	st, err := h.svc.Stat(rel)
-	if err != nil {
+	st, err := h.files(ctx).Stat(rel)
+	switch {
+	case isStaged(ctx) && errors.Is(err, file.ErrNotFound):
+	case err != nil:
 		if os.IsNotExist(err) {
 			return fiber.NewError(fiber.StatusNotFound, "target path not found")
 		}
 		return mapLocalFileServiceError(ctx, err)
-	}
-	if !st.IsDir() {
+	case !st.IsDir():
 		return BadRequestError("target path is not a directory")
 	}
 
@@ -166,9 +226,12 @@ func (h *FSHandler) Post(ctx *fiber.Ctx) error {
 
 	// handle create empty file or directory
 	var body struct {
-		Path      string `json:"path"`
-		Type      string `json:"type"`
-		Overwrite bool   `json:"overwrite"`
+		Path       string `json:"path"`
+		Type       string `json:"type"`
+		Overwrite  bool   `json:"overwrite"`
+		Archive    string `json:"archive"`
+		OnConflict string `json:"onConflict"`
+		Source     string `json:"source"`
 	}
 	if err := json.Unmarshal(ctx.Body(), &body); err != nil {
 		return BadRequestError("invalid request body")
@@ -179,13 +242,21 @@ func (h *FSHandler) Post(ctx *fiber.Ctx) error {
 		return h.handleCreateDirectories(ctx, rel, body.Path)
 	case "file":
 		return h.handlerCreateFile(ctx, rel, body.Path, body.Overwrite)
+	case "extract":
+		if isStaged(ctx) {
+			return BadRequestError("extraction cannot be staged")
+		}
+		return h.handleExtract(ctx, rel, body.Archive, body.OnConflict)
+	case "copy":
+		return h.handleCopy(ctx, rel, body.Source, body.Path, body.Overwrite)
 	}
 
 	// Unsupported body/type for POST
 	return BadRequestError("invalid request body")
 }
 
-// uploadFile handles multipart file uploads into an existing directory.
+// uploadFile handles multipart file uploads into an existing directory. With
+// extract=true the uploaded archive is unpacked into the directory instead.
 func (h *FSHandler) handleUploadFile(ctx *fiber.Ctx, rel string) error {
 	mf, err := ctx.MultipartForm()
 	if err != nil {
@@ -199,12 +270,27 @@ func (h *FSHandler) handleUploadFile(ctx *fiber.Ctx, rel string) error {
 	overwrite := strings.EqualFold(ctx.FormValue("overwrite"), "true")
 
 	toUpload := fileInputs[0]
+	if strings.EqualFold(ctx.FormValue("extract"), "true") {
+		if isStaged(ctx) {
+			return BadRequestError("extraction cannot be staged")
+		}
+		return h.handleExtractUpload(ctx, rel, toUpload)
+	}
 	name := filepath.Base(toUpload.Filename)
 	destRel := filepath.Join(rel, name)
+	if isStaged(ctx) {
+		src, err := toUpload.Open()
+		if err != nil {
+			return mapLocalFileServiceError(ctx, err)
+		}
+		defer src.Close()
+		change, err := h.files(ctx).StageWrite(destRel, src, overwrite, nil)
+		return sendStaged(ctx, change, err)
+	}
 
 	// If overwrite is false, check existence and return 409 with code
 	if !overwrite {
-		if _, err := h.svc.Stat(destRel); err == nil {
+		if _, err := h.files(ctx).Stat(destRel); err == nil {
 			return ErrFileExists
 		} else if !errors.Is(err, file.ErrNotFound) {
 			return mapLocalFileServiceError(ctx, err)
@@ -215,7 +301,7 @@ func (h *FSHandler) handleUploadFile(ctx *fiber.Ctx, rel string) error {
 	if err != nil {
 		return mapLocalFileServiceError(ctx, err)
 	}
-	if err := h.svc.SaveStream(destRel, src, overwrite); err != nil {
+	if err := h.files(ctx).SaveStream(destRel, src, overwrite); err != nil {
 		_ = src.Close()
 		return mapLocalFileServiceError(ctx, err)
 	}
@@ -226,31 +312,73 @@ func (h *FSHandler) handleUploadFile(ctx *fiber.Ctx, rel string) error {
 // handleCreateDirectories creates all directories in the given path under parent dir.
 func (h *FSHandler) handleCreateDirectories(ctx *fiber.Ctx, parentPath, path string) error {
 	fullpath := filepath.Join(parentPath, path)
-	if _, err := h.svc.Stat(fullpath); err == nil {
+	if isStaged(ctx) {
+		change, err := h.files(ctx).Stage(file.StagedChange{Op: file.StagedMkdir, Path: fullpath})
+		return sendStaged(ctx, change, err)
+	}
+	if _, err := h.files(ctx).Stat(fullpath); err == nil {
 		return ErrFileExists
 	}
 
-	if err := h.svc.MkdirAll(fullpath); err != nil {
+	if err := h.files(ctx).MkdirAll(fullpath); err != nil {
 		return mapLocalFileServiceError(ctx, err)
 	}
 	return ctx.SendStatus(fiber.StatusCreated)
 }
 
+// handleCopy copies source into the directory at rel, named path or the base
+// name of source. Copies running longer than jobWaitTimeout continue as a job
+// and are answered with 202.
+func (h *FSHandler) handleCopy(ctx *fiber.Ctx, rel, source, path string, overwrite bool) error {
+	if strings.TrimSpace(source) == "" {
+		return BadRequestError("missing source path")
+	}
+	if path == "" {
+		path = filepath.Base(source)
+	}
+	op := file.BatchOp{Op: file.BatchCopy, Path: source, NewPath: filepath.Join(rel, path), Overwrite: overwrite}
+	if isStaged(ctx) {
+		change, err := h.files(ctx).Stage(file.StagedChange{Op: file.StagedCopy, Path: op.Path, NewPath: op.NewPath, Overwrite: overwrite})
+		return sendStaged(ctx, change, err)
+	}
+	job, err := startJob(ctx, h.jobs, []file.BatchOp{op})
+	if err != nil {
+		return err
+	}
+	if job, err = waitJob(ctx, h.jobs, job.ID); err != nil {
+		return ErrJobNotFound
+	}
+	if job.Status == file.JobRunning {
+		return sendJob(ctx, job)
+	}
+	if err := job.Errors[0]; err != nil {
+		return mapBatchError(ctx, err)
+	}
+	return ctx.SendStatus(fiber.StatusCreated)
+}
+
 func (h *FSHandler) handlerCreateFile(ctx *fiber.Ctx, rel, name string, overwrite bool) error {
 	destRel := filepath.Join(rel, name)
+	if isStaged(ctx) {
+		change, err := h.files(ctx).StageWrite(destRel, bytes.NewReader(nil), overwrite, nil)
+		return sendStaged(ctx, change, err)
+	}
 	if !overwrite {
-		if _, err := h.svc.Stat(destRel); err == nil {
+		if _, err := h.files(ctx).Stat(destRel); err == nil {
 			return ErrFileExists
 		} else if !os.IsNotExist(err) {
 			return mapLocalFileServiceError(ctx, err)
 		}
 	}
-	if err := h.svc.WriteFile(destRel, nil, true); err != nil {
+	if err := h.files(ctx).WriteFile(destRel, nil, true); err != nil {
 		return mapLocalFileServiceError(ctx, err)
 	}
 	return ctx.SendStatus(fiber.StatusCreated)
 }
 
+// PUT /api/v1/fs/*path with an application/octet-stream body
+// - With If-Match: replace the file only while its ETag is one of the listed ones, 412 otherwise
+// - With staged=true: queue the write until the next start and answer 202 with the staged change, If-Match is checked again then
 func (h *FSHandler) Put(ctx *fiber.Ctx) error {
 	rel := h.pathFromParam(ctx)
 	overwrite := strings.EqualFold(ctx.Query("overwrite"), "true")
@@ -259,16 +387,32 @@ func (h *FSHandler) Put(ctx *fiber.Ctx) error {
 		return BadRequestError("expected application/octet-stream")
 	}
 
-	err := h.svc.SaveStream(rel, bytes.NewReader(ctx.Body()), overwrite)
+	// a precondition on the current content implies replacing it
+	overwrite = overwrite || ctx.Get(fiber.HeaderIfMatch) != ""
+	if isStaged(ctx) {
+		ifMatch, err := stagedIfMatch(ctx)
+		if err != nil {
+			return err
+		}
+		change, err := h.files(ctx).StageWrite(rel, bytes.NewReader(ctx.Body()), overwrite, ifMatch)
+		return sendStaged(ctx, change, err)
+	}
+	err := h.ifMatch(ctx, rel, func() error {
+		return h.files(ctx).SaveStream(rel, bytes.NewReader(ctx.Body()), overwrite)
+	})
 	if err != nil {
 		return mapLocalFileServiceError(ctx, err)
 	}
-
+	if etag, err := h.files(ctx).ETag(rel); err == nil {
+		ctx.Set(fiber.HeaderETag, quoteETag(etag))
+	}
 	return ctx.SendStatus(fiber.StatusOK)
 }
 
 // PATCH /api/v1/fs/*path
 // - Rename file or directory with body {"name": <new_name>}
+// - With If-Match: rename only while the ETag of the file matches
+// - With staged=true: queue the rename until the next start, If-Match is checked again then
 func (h *FSHandler) Patch(c *fiber.Ctx) error {
 	relPath := h.pathFromParam(c)
 	var body struct {
@@ -281,24 +425,45 @@ func (h *FSHandler) Patch(c *fiber.Ctx) error {
 	if strings.TrimSpace(body.NewPath) == "" {
 		return BadRequestError("missing new path")
 	}
+	if isStaged(c) {
+		ifMatch, err := stagedIfMatch(c)
+		if err != nil {
+			return err
+		}
+		change, err := h.files(c).Stage(file.StagedChange{Op: file.StagedMove, Path: relPath, NewPath: body.NewPath, Overwrite: body.Overwrite, IfMatch: ifMatch})
+		return sendStaged(c, change, err)
+	}
 	// Rename file or directory
-	if err := h.svc.Rename(relPath, body.NewPath, body.Overwrite); err != nil {
+	err := h.ifMatch(c, relPath, func() error {
+		return h.files(c).Rename(relPath, body.NewPath, body.Overwrite)
+	})
+	if err != nil {
 		return mapLocalFileServiceError(c, err)
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
 // DELETE /api/v1/fs/*path
+// - With If-Match: delete only while the ETag of the file matches
+// - With staged=true: queue the deletion until the next start, If-Match is checked again then
 func (h *FSHandler) Delete(c *fiber.Ctx) error {
 	rel := h.pathFromParam(c)
 	recursive := strings.EqualFold(c.Query("recursive"), "true")
-	if recursive {
-		if err := h.svc.DeleteRecursive(rel); err != nil {
-			return mapLocalFileServiceError(c, err)
+	if isStaged(c) {
+		ifMatch, err := stagedIfMatch(c)
+		if err != nil {
+			return err
 		}
-		return c.SendStatus(fiber.StatusOK)
+		change, err := h.files(c).Stage(file.StagedChange{Op: file.StagedDelete, Path: rel, Recursive: recursive, IfMatch: ifMatch})
+		return sendStaged(c, change, err)
 	}
-	if err := h.svc.Delete(rel); err != nil {
+	err := h.ifMatch(c, rel, func() error {
+		if recursive {
+			return h.files(c).DeleteRecursive(rel)
+		}
+		return h.files(c).Delete(rel)
+	})
+	if err != nil {
 		return mapLocalFileServiceError(c, err)
 	}
 	return c.SendStatus(fiber.StatusOK)
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var (
+	ErrJobNotFound       = NewAPIError(fiber.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+	ErrJobFinished       = NewAPIError(fiber.StatusConflict, "job already finished", "JOB_FINISHED")
+	ErrOperationCanceled = NewAPIError(fiber.StatusConflict, "operation canceled", "CANCELED")
+)
+
+// jobWaitTimeout is how long a request waits for its job before answering
+// 202 Accepted and leaving the job to run in the background.
+const jobWaitTimeout = 5 * time.Second
+
+// BatchRequest is the body of POST /api/batch.
+type BatchRequest struct {
+	Operations []file.BatchOp `json:"operations"`
+}
+
+// BatchResult is the outcome of one operation of a batch.
+type BatchResult struct {
+	file.BatchOp
+	Error *APIError `json:"error,omitempty"`
+}
+
+// JobInfo is the public view of a batch job. Results are filled in as the
+// operations complete.
+type JobInfo struct {
+	file.Job
+	Results []BatchResult `json:"results"`
+}
+
+// JobsHandler implements batch file operations under /api/batch and their
+// background jobs under /api/jobs.
+type JobsHandler struct {
+	jobs *file.JobManager
+}
+
+func mapBatchError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrOperationCanceled
+	case errors.Is(err, file.ErrAlreadyExists):
+		return ErrFileExists
+	case errors.Is(err, file.ErrOverlappingPaths), errors.Is(err, file.ErrPathTraversal), errors.Is(err, file.ErrMissingNewName):
+		return BadRequestError(err.Error())
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+func newJobInfo(ctx *fiber.Ctx, job file.Job) JobInfo {
+	results := make([]BatchResult, len(job.Operations))
+	for i, op := range job.Operations {
+		results[i] = BatchResult{BatchOp: op}
+		if i < job.Progress.Completed && job.Errors[i] != nil {
+			results[i].Error = toAPIError(mapBatchError(ctx, job.Errors[i]))
+		}
+	}
+	return JobInfo{Job: job, Results: results}
+}
+
+// startJob starts the operations as a job of the caller, whose allowed paths
+// and path rules apply to each operation.
+func startJob(ctx *fiber.Ctx, jobs *file.JobManager, ops []file.BatchOp) (file.Job, error) {
+	job, err := jobs.StartBatch(ops, identityFrom(ctx))
+	if errors.Is(err, file.ErrInvalidBatchOp) {
+		return job, BadRequestError(err.Error())
+	}
+	return job, err
+}
+
+// waitJob waits for a job to finish unless the client asked for async=true.
+// The job is still running when it takes longer than jobWaitTimeout.
+func waitJob(ctx *fiber.Ctx, jobs *file.JobManager, id string) (file.Job, error) {
+	timeout := jobWaitTimeout
+	if strings.EqualFold(ctx.Query("async"), "true") {
+		timeout = 0
+	}
+	return jobs.Wait(id, timeout)
+}
+
+// sendJob answers 200 with a finished job, or 202 pointing to the job while it
+// is still running.
+func sendJob(ctx *fiber.Ctx, job file.Job) error {
+	if job.Status == file.JobRunning {
+		ctx.Location("/api/jobs/" + job.ID)
+		ctx.Status(fiber.StatusAccepted)
+	}
+	return ctx.JSON(APIResponse{
+		Data: newJobInfo(ctx, job),
+	})
+}
+
+// getJob returns the job if it belongs to the caller, admins get every job.
+// Jobs of other callers are reported as not found.
+func (h *JobsHandler) getJob(ctx *fiber.Ctx) (file.Job, error) {
+	job, err := h.jobs.Get(ctx.Params("id"))
+	if err != nil {
+		return job, ErrJobNotFound
+	}
+	identity := identityFrom(ctx)
+	if identity != nil && identity.ID != job.Owner && !identity.HasScope(auth.ScopeAdmin) {
+		return job, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// POST /api/batch { operations: [{ op: "copy"|"move"|"delete", path, newPath, overwrite, recursive }] }
+// - Operations run in order, a failure does not stop the following ones
+// - Answers 200 with per-operation results, or 202 with the job when it runs longer
+func (h *JobsHandler) PostBatch(ctx *fiber.Ctx) error {
+	var req BatchRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequestError("invalid request payload")
+	}
+	job, err := startJob(ctx, h.jobs, req.Operations)
+	if err != nil {
+		return err
+	}
+	if job, err = waitJob(ctx, h.jobs, job.ID); err != nil {
+		return ErrJobNotFound
+	}
+	return sendJob(ctx, job)
+}
+
+// GET /api/jobs lists the jobs of the caller, admins get the jobs of all callers
+func (h *JobsHandler) GetJobs(ctx *fiber.Ctx) error {
+	var owner string
+	all := true
+	if identity := identityFrom(ctx); identity != nil {
+		owner, all = identity.ID, identity.HasScope(auth.ScopeAdmin)
+	}
+	jobs := h.jobs.List(owner, all)
+	out := make([]JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		out = append(out, newJobInfo(ctx, job))
+	}
+	return ctx.JSON(APIResponse{
+		Data: out,
+	})
+}
+
+// GET /api/jobs/:id
+func (h *JobsHandler) GetJob(ctx *fiber.Ctx) error {
+	job, err := h.getJob(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(APIResponse{
+		Data: newJobInfo(ctx, job),
+	})
+}
+
+// DELETE /api/jobs/:id cancels a running job
+func (h *JobsHandler) DeleteJob(ctx *fiber.Ctx) error {
+	if _, err := h.getJob(ctx); err != nil {
+		return err
+	}
+	if err := h.jobs.Cancel(ctx.Params("id")); err != nil {
+		if errors.Is(err, file.ErrJobFinished) {
+			return ErrJobFinished
+		}
+		return ErrJobNotFound
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewJobsHandler(jobs *file.JobManager) *JobsHandler {
+	return &JobsHandler{
+		jobs: jobs,
+	}
+}
@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"context"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/khanghh/mcrunner/internal/mcagent"
 	"github.com/khanghh/mcrunner/internal/mccmd"
-	"github.com/khanghh/mcrunner/internal/sysmetrics"
+	"github.com/khanghh/mcrunner/internal/serverstate"
 	"github.com/khanghh/mcrunner/pkg/api"
 )
 
@@ -19,48 +18,35 @@ var (
 type MCRunnerHandler struct {
 	mcserver *mccmd.MCServerCmd     // server process
 	mcagent  *mcagent.MCAgentBridge // plugin bridge
+	state    *serverstate.Builder   // state shared with the gRPC API
 }
 
 func (h *MCRunnerHandler) getServerState() api.ServerState {
-	status := h.mcserver.GetStatus()
-
-	var serverIPAddr string
-	if ipAddr, err := sysmetrics.GetOutboundIP(); err == nil {
-		serverIPAddr = ipAddr.String()
-	}
-
+	state := h.state.Build()
+	usage := state.Usage
 	serverState := api.ServerState{
-		Status:    api.ServerStatus(status),
-		IPAddress: serverIPAddr,
-	}
-
-	usage := sysmetrics.GetResourceUsage()
-	serverState.MemoryUsage = &usage.MemoryUsage
-	serverState.MemoryLimit = &usage.MemoryLimit
-	serverState.CPUUsage = &usage.CPUUsage
-	serverState.CPULimit = &usage.CPULimit
-	serverState.DiskUsage = &usage.DiskUsage
-	serverState.DiskSize = &usage.DiskSize
-
-	process := h.mcserver.GetProcess()
-	if process == nil {
-		return serverState
-	}
-	serverState.PID = process.Pid
-	if startTime := h.mcserver.GetStartTime(); startTime != nil {
-		serverState.UptimeSec = uint64(time.Since(*startTime).Seconds())
-	}
-
-	if serverInfo, err := h.mcagent.GetServerInfo(); err == nil {
+		Status:      api.ServerStatus(state.Status),
+		PID:         state.PID,
+		IPAddress:   state.IPAddress,
+		MemoryUsage: &usage.MemoryUsage,
+		MemoryLimit: &usage.MemoryLimit,
+		CPUUsage:    &usage.CPUUsage,
+		CPULimit:    &usage.CPULimit,
+		DiskUsage:   &usage.DiskUsage,
+		DiskSize:    &usage.DiskSize,
+		DataUsage:   &usage.DataUsage,
+		DataQuota:   &usage.DataQuota,
+		UptimeSec:   state.UptimeSec,
+	}
+	if state.Server != nil {
 		serverState.Server = &api.ServerInfo{
-			Name:          serverInfo.Name,
-			Version:       serverInfo.Version,
-			TPS:           serverInfo.TPS,
-			PlayersOnline: serverInfo.PlayersOnline,
-			PlayersMax:    serverInfo.PlayersMax,
+			Name:          state.Server.Name,
+			Version:       state.Server.Version,
+			TPS:           state.Server.TPS,
+			PlayersOnline: state.Server.PlayersOnline,
+			PlayersMax:    state.Server.PlayersMax,
 		}
 	}
-
 	return serverState
 }
 
@@ -175,8 +161,10 @@ func (h *MCRunnerHandler) GetState(ctx *fiber.Ctx) error {
 	})
 }
 
-func NewMCRunnerHandler(mcserver *mccmd.MCServerCmd) *MCRunnerHandler {
+func NewMCRunnerHandler(mcserver *mccmd.MCServerCmd, mcagent *mcagent.MCAgentBridge) *MCRunnerHandler {
 	return &MCRunnerHandler{
 		mcserver: mcserver,
+		mcagent:  mcagent,
+		state:    serverstate.NewBuilder(mcserver, mcagent),
 	}
 }
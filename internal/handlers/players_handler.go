@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/mcplayers"
+)
+
+var (
+	ErrListNotFound  = NewAPIError(fiber.StatusNotFound, "list not found", "LIST_NOT_FOUND")
+	ErrEntryNotFound = NewAPIError(fiber.StatusNotFound, "entry not found", "ENTRY_NOT_FOUND")
+)
+
+// PlayersHandler manages the whitelist, operator and ban lists.
+type PlayersHandler struct {
+	players *mcplayers.Manager
+}
+
+func mapPlayersError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, mcplayers.ErrUnknownList):
+		return ErrListNotFound
+	case errors.Is(err, mcplayers.ErrEntryNotFound):
+		return ErrEntryNotFound
+	case errors.Is(err, mcplayers.ErrNoPermissions):
+		return ErrNoPermissions
+	case errors.Is(err, mcplayers.ErrInvalidEntry):
+		return NewAPIError(fiber.StatusBadRequest, err.Error(), "INVALID_ENTRY")
+	case errors.Is(err, mcplayers.ErrUnknownPlayer):
+		return NewAPIError(fiber.StatusUnprocessableEntity, err.Error(), "UNKNOWN_PLAYER")
+	case errors.Is(err, mcplayers.ErrInvalidFile):
+		return NewAPIError(fiber.StatusConflict, err.Error(), "INVALID_LIST_FILE")
+	case errors.Is(err, mcplayers.ErrServerRunning):
+		return NewAPIError(fiber.StatusConflict, err.Error(), "SERVER_RUNNING")
+	case errors.Is(err, mccmd.ErrNotRunning):
+		return ErrServerNotRunning
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// changeStatus is 202 Accepted for changes sent to the console, which the
+// server applies asynchronously.
+func changeStatus(change *mcplayers.Change) int {
+	if change.Console {
+		return fiber.StatusAccepted
+	}
+	return fiber.StatusOK
+}
+
+// GET /api/mc/lists/:list returns the entries of whitelist, ops,
+// banned-players or banned-ips.
+func (h *PlayersHandler) GetList(ctx *fiber.Ctx) error {
+	list, err := mcplayers.ParseList(ctx.Params("list"))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	entries, err := h.players.Entries(list, identityFrom(ctx))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	return ctx.JSON(APIResponse{
+		Data: entries,
+	})
+}
+
+// POST /api/mc/lists/:list adds the entry in the body, identifying players by
+// name or uuid and banned addresses by ip.
+func (h *PlayersHandler) PostEntry(ctx *fiber.Ctx) error {
+	list, err := mcplayers.ParseList(ctx.Params("list"))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	var entry mcplayers.Entry
+	if err := ctx.BodyParser(&entry); err != nil {
+		return BadRequestError("invalid request payload")
+	}
+	change, err := h.players.Add(list, entry, identityFrom(ctx))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	return ctx.Status(changeStatus(change)).JSON(APIResponse{
+		Data: change,
+	})
+}
+
+// DELETE /api/mc/lists/:list/:player removes the entry of a player, by name
+// or uuid, or of a banned ip.
+func (h *PlayersHandler) DeleteEntry(ctx *fiber.Ctx) error {
+	list, err := mcplayers.ParseList(ctx.Params("list"))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	player, err := url.PathUnescape(ctx.Params("player"))
+	if err != nil || player == "" {
+		return BadRequestError("invalid player")
+	}
+	change, err := h.players.Remove(list, player, identityFrom(ctx))
+	if err != nil {
+		return mapPlayersError(ctx, err)
+	}
+	return ctx.Status(changeStatus(change)).JSON(APIResponse{
+		Data: change,
+	})
+}
+
+func NewPlayersHandler(players *mcplayers.Manager) *PlayersHandler {
+	return &PlayersHandler{players: players}
+}
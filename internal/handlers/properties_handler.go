@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/mcprops"
+)
+
+// propertiesFile is the server.properties file relative to the root dir,
+// which is the working directory of the server
+const propertiesFile = "server.properties"
+
+// property is an entry of server.properties with its schema. Keys unknown to
+// vanilla servers, such as ones added by mods, have no type.
+type property struct {
+	Key     string       `json:"key"`
+	Value   string       `json:"value"`
+	Type    mcprops.Type `json:"type,omitempty"`
+	Min     *int64       `json:"min,omitempty"`
+	Max     *int64       `json:"max,omitempty"`
+	Values  []string     `json:"values,omitempty"`
+	Live    bool         `json:"live"` // applied without a restart
+	Unknown bool         `json:"unknown,omitempty"`
+}
+
+// propertiesUpdate is the body of PATCH /api/mc/properties. Values may be
+// strings, booleans or numbers; null removes the key.
+type propertiesUpdate struct {
+	Properties   map[string]any `json:"properties"`
+	Apply        bool           `json:"apply"`        // apply live changes through the console
+	AllowUnknown bool           `json:"allowUnknown"` // accept keys missing from the schema
+}
+
+// propertyChange is a change made by PATCH /api/mc/properties.
+type propertyChange struct {
+	Key             string  `json:"key"`
+	OldValue        *string `json:"oldValue"`
+	NewValue        *string `json:"newValue"`
+	Applied         bool    `json:"applied"`         // applied to the running server
+	RestartRequired bool    `json:"restartRequired"` // takes effect after a restart
+}
+
+type propertiesResult struct {
+	Changes         []propertyChange `json:"changes"`
+	RestartRequired bool             `json:"restartRequired"`
+}
+
+// PropertiesHandler edits server.properties through the file service, so
+// path rules and file versions apply to it like to any other file.
+type PropertiesHandler struct {
+	files    *file.LocalFileService
+	mcserver *mccmd.MCServerCmd
+	mu       sync.Mutex // serializes read-modify-write cycles
+}
+
+func newProperty(key, value string) property {
+	prop := property{Key: key, Value: value}
+	schema, ok := mcprops.Lookup(key)
+	if !ok {
+		prop.Unknown = true
+		return prop
+	}
+	prop.Type = schema.Type
+	prop.Values = schema.Values
+	prop.Live = schema.Live()
+	if schema.Type == mcprops.TypeInteger || schema.Type == mcprops.TypePort {
+		prop.Min, prop.Max = &schema.Min, &schema.Max
+	}
+	return prop
+}
+
+// load reads and parses server.properties, a missing file is empty.
+func (h *PropertiesHandler) load(files *file.LocalFileService) (*mcprops.Properties, error) {
+	data, err := files.ReadFile(propertiesFile)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return nil, err
+	}
+	return mcprops.Parse(data), nil
+}
+
+// parseValue converts a JSON value of an update to a property value.
+func parseValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		// kept as sent, a float64 would round large integers
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// validate returns the normalized values of the update, nil for removals.
+func (u *propertiesUpdate) validate() (map[string]*string, error) {
+	values := make(map[string]*string, len(u.Properties))
+	var problems []string
+	for key, raw := range u.Properties {
+		if key == "" || strings.ContainsAny(key, "\r\n") {
+			problems = append(problems, fmt.Sprintf("invalid key %q", key))
+			continue
+		}
+		if raw == nil {
+			values[key] = nil
+			continue
+		}
+		value, err := parseValue(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		schema, ok := mcprops.Lookup(key)
+		if !ok {
+			if !u.AllowUnknown {
+				problems = append(problems, fmt.Sprintf("unknown key %s, set allowUnknown to write it", key))
+			}
+			values[key] = &value
+			continue
+		}
+		if value, err = schema.Normalize(value); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		values[key] = &value
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, NewAPIError(fiber.StatusBadRequest, strings.Join(problems, "; "), "INVALID_PROPERTIES")
+	}
+	return values, nil
+}
+
+// GET /api/mc/properties lists the entries of server.properties in file
+// order, with the type, bounds or allowed values of known keys.
+func (h *PropertiesHandler) GetProperties(ctx *fiber.Ctx) error {
+	files := h.files.As(identityFrom(ctx))
+	props, err := h.load(files)
+	if err != nil {
+		return mapLocalFileServiceError(ctx, err)
+	}
+	out := make([]property, 0)
+	for _, key := range props.Keys() {
+		value, _ := props.Get(key)
+		out = append(out, newProperty(key, value))
+	}
+	if etag, err := files.ETag(propertiesFile); err == nil {
+		ctx.Set(fiber.HeaderETag, quoteETag(etag))
+	}
+	return ctx.JSON(APIResponse{
+		Data: out,
+	})
+}
+
+// PATCH /api/mc/properties sets and removes keys of server.properties,
+// keeping its comments and order. Values are validated against the schema of
+// vanilla servers first, nothing is written when one is invalid. With If-Match
+// the file is only changed while its ETag matches. While the server runs,
+// apply=true sends the console commands applying live keys; the response
+// reports the changes that take effect after a restart.
+func (h *PropertiesHandler) PatchProperties(ctx *fiber.Ctx) error {
+	var req propertiesUpdate
+	dec := json.NewDecoder(bytes.NewReader(ctx.Body()))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return BadRequestError("invalid request payload")
+	}
+	if len(req.Properties) == 0 {
+		return BadRequestError("missing properties")
+	}
+	identity := identityFrom(ctx)
+	// live changes are applied through the console
+	if req.Apply && identity != nil && !identity.HasScope(auth.ScopeConsoleWrite) {
+		return ErrInsufficientScope
+	}
+	values, err := req.validate()
+	if err != nil {
+		return err
+	}
+
+	files := h.files.As(identity)
+	var changes []propertyChange
+	update := func() error {
+		props, err := h.load(files)
+		if err != nil {
+			return err
+		}
+		// new keys are appended in a stable order
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			value := values[key]
+			change := propertyChange{Key: key, NewValue: value}
+			if old, ok := props.Get(key); ok {
+				change.OldValue = &old
+			}
+			switch {
+			case value == nil && change.OldValue == nil:
+				continue
+			case value == nil:
+				props.Delete(key)
+			case change.OldValue != nil && *change.OldValue == *value:
+				continue
+			default:
+				props.Set(key, *value)
+			}
+			changes = append(changes, change)
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return files.WriteFile(propertiesFile, props.Bytes(), true)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if header := ctx.Get(fiber.HeaderIfMatch); header != "" {
+		err = files.IfMatch(propertiesFile, parseIfMatch(header), update)
+	} else {
+		err = update()
+	}
+	if err != nil {
+		return mapLocalFileServiceError(ctx, err)
+	}
+
+	result := propertiesResult{Changes: make([]propertyChange, 0, len(changes))}
+	running := h.mcserver.GetStatus() == mccmd.StatusRunning
+	for _, change := range changes {
+		if running {
+			schema, _ := mcprops.Lookup(change.Key)
+			command := ""
+			if change.NewValue != nil {
+				command = schema.Command(*change.NewValue)
+			}
+			if req.Apply && command != "" {
+				change.Applied = h.mcserver.SendCommand(command) == nil
+			}
+			change.RestartRequired = !change.Applied
+			result.RestartRequired = result.RestartRequired || change.RestartRequired
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	if etag, err := files.ETag(propertiesFile); err == nil {
+		ctx.Set(fiber.HeaderETag, quoteETag(etag))
+	}
+	return ctx.JSON(APIResponse{
+		Data: result,
+	})
+}
+
+func NewPropertiesHandler(files *file.LocalFileService, mcserver *mccmd.MCServerCmd) *PropertiesHandler {
+	return &PropertiesHandler{
+		files:    files,
+		mcserver: mcserver,
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var ErrStagedChangeNotFound = NewAPIError(fiber.StatusNotFound, "staged change not found", "STAGED_CHANGE_NOT_FOUND")
+
+// StagingHandler implements the staged file changes under /api/staged. File
+// API requests with staged=true queue their change instead of performing it,
+// and the queue is applied the next time the server starts.
+type StagingHandler struct {
+	files *file.LocalFileService
+}
+
+func mapStagingError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, file.ErrStagedChangeNotFound):
+		return ErrStagedChangeNotFound
+	case errors.Is(err, file.ErrAlreadyExists):
+		return ErrFileExists
+	case errors.Is(err, file.ErrInvalidStagedChange), errors.Is(err, file.ErrNoStagedDiff), errors.Is(err, file.ErrIsDirectory):
+		return BadRequestError(err.Error())
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// isStaged reports whether a file API request asks to stage its change.
+func isStaged(ctx *fiber.Ctx) bool {
+	return strings.EqualFold(ctx.Query("staged"), "true")
+}
+
+// sendStaged answers a staged file API request with the queued change.
+func sendStaged(ctx *fiber.Ctx, change file.StagedChange, err error) error {
+	if err != nil {
+		return mapStagingError(ctx, err)
+	}
+	return ctx.Status(fiber.StatusAccepted).JSON(change)
+}
+
+// getChange returns the staged change if the caller may access its paths.
+// Other changes are reported as not found.
+func (h *StagingHandler) getChange(ctx *fiber.Ctx) (file.StagedChange, error) {
+	change, err := h.files.As(identityFrom(ctx)).GetStaged(ctx.Params("id"))
+	if err != nil {
+		return change, mapStagingError(ctx, err)
+	}
+	return change, nil
+}
+
+// GET /api/staged lists the staged changes in the order they will be applied
+func (h *StagingHandler) GetChanges(ctx *fiber.Ctx) error {
+	changes, err := h.files.As(identityFrom(ctx)).ListStaged()
+	if err != nil {
+		return mapStagingError(ctx, err)
+	}
+	return ctx.JSON(APIResponse{
+		Data: changes,
+	})
+}
+
+// GET /api/staged/:id
+func (h *StagingHandler) GetChange(ctx *fiber.Ctx) error {
+	change, err := h.getChange(ctx)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(APIResponse{
+		Data: change,
+	})
+}
+
+// GET /api/staged/:id/diff returns a unified diff from the current content of
+// the file a staged write or delete changes to its staged content
+func (h *StagingHandler) GetDiff(ctx *fiber.Ctx) error {
+	diff, err := h.files.As(identityFrom(ctx)).DiffStaged(ctx.Params("id"))
+	if err != nil {
+		return mapStagingError(ctx, err)
+	}
+	ctx.Set(fiber.HeaderContentType, "text/x-diff; charset=utf-8")
+	return ctx.SendString(diff)
+}
+
+// DELETE /api/staged/:id discards a staged change
+func (h *StagingHandler) DeleteChange(ctx *fiber.Ctx) error {
+	if err := h.files.As(identityFrom(ctx)).DiscardStaged(ctx.Params("id")); err != nil {
+		return mapStagingError(ctx, err)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// DELETE /api/staged discards all staged changes the caller may access
+func (h *StagingHandler) DeleteChanges(ctx *fiber.Ctx) error {
+	files := h.files.As(identityFrom(ctx))
+	changes, err := files.ListStaged()
+	if err != nil {
+		return mapStagingError(ctx, err)
+	}
+	for _, change := range changes {
+		err := files.DiscardStaged(change.ID)
+		if err != nil && !errors.Is(err, file.ErrStagedChangeNotFound) {
+			return mapStagingError(ctx, err)
+		}
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewStagingHandler(files *file.LocalFileService) *StagingHandler {
+	return &StagingHandler{
+		files: files,
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/auth"
+)
+
+var (
+	ErrTokenNotFound = NewAPIError(fiber.StatusNotFound, "token not found", "TOKEN_NOT_FOUND")
+)
+
+// TokenInfo is the public view of an API token; the hash is never returned.
+type TokenInfo struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Scopes    []auth.Scope `json:"scopes"`
+	Paths     []string     `json:"paths,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt *time.Time   `json:"expiresAt,omitempty"`
+	Expired   bool         `json:"expired,omitempty"`
+}
+
+// CreateTokenRequest is the body of POST /api/tokens.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Paths     []string   `json:"paths"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	ExpiresIn string     `json:"expiresIn"` // Go duration, e.g. "720h"
+}
+
+// CreateTokenResponse contains the token secret, returned only once.
+type CreateTokenResponse struct {
+	TokenInfo
+	Token string `json:"token"`
+}
+
+// TokensHandler implements API token management under /api/tokens
+type TokensHandler struct {
+	store *auth.TokenStore
+}
+
+func newTokenInfo(t *auth.Token) TokenInfo {
+	return TokenInfo{
+		ID:        t.ID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		Paths:     t.Paths,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		Expired:   t.Expired(time.Now()),
+	}
+}
+
+// GET /api/tokens
+func (h *TokensHandler) GetTokens(ctx *fiber.Ctx) error {
+	tokens := h.store.List()
+	out := make([]TokenInfo, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, newTokenInfo(t))
+	}
+	return ctx.JSON(APIResponse{
+		Data: out,
+	})
+}
+
+// POST /api/tokens
+func (h *TokensHandler) PostToken(ctx *fiber.Ctx) error {
+	var req CreateTokenRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequestError("invalid request payload")
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		return BadRequestError(err.Error())
+	}
+	expiresAt := req.ExpiresAt
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			return BadRequestError("invalid expiresIn duration")
+		}
+		t := time.Now().Add(ttl).UTC()
+		expiresAt = &t
+	}
+
+	secret, token, err := h.store.Create(req.Name, scopes, req.Paths, expiresAt)
+	if err != nil {
+		if errors.Is(err, auth.ErrMissingName) || errors.Is(err, auth.ErrNoScopes) || errors.Is(err, auth.ErrInvalidScope) {
+			return BadRequestError(err.Error())
+		}
+		return InternalServerError(err)
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(APIResponse{
+		Data: CreateTokenResponse{
+			TokenInfo: newTokenInfo(token),
+			Token:     secret,
+		},
+	})
+}
+
+// DELETE /api/tokens/:id
+func (h *TokensHandler) DeleteToken(ctx *fiber.Ctx) error {
+	if err := h.store.Revoke(ctx.Params("id")); err != nil {
+		if errors.Is(err, auth.ErrTokenNotFound) {
+			return ErrTokenNotFound
+		}
+		return InternalServerError(err)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewTokensHandler(store *auth.TokenStore) *TokensHandler {
+	return &TokensHandler{
+		store: store,
+	}
+}
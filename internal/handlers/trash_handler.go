@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var ErrTrashItemNotFound = NewAPIError(fiber.StatusNotFound, "trash item not found", "TRASH_ITEM_NOT_FOUND")
+
+// RestoreTrashRequest is the body of POST /api/trash/:id/restore.
+type RestoreTrashRequest struct {
+	Path      string `json:"path"` // defaults to where the item was deleted from
+	Overwrite bool   `json:"overwrite"`
+}
+
+// TrashHandler implements the trash under /api/trash. Deleting through the
+// file API moves entries into the trash, from where they are restored or
+// purged until the retention removes them.
+type TrashHandler struct {
+	files *file.LocalFileService
+}
+
+func mapTrashError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, file.ErrTrashItemNotFound):
+		return ErrTrashItemNotFound
+	case errors.Is(err, file.ErrAlreadyExists):
+		return ErrFileExists
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// GET /api/trash
+func (h *TrashHandler) GetTrash(ctx *fiber.Ctx) error {
+	items, err := h.files.As(identityFrom(ctx)).ListTrash()
+	if err != nil {
+		return mapTrashError(ctx, err)
+	}
+	return ctx.JSON(APIResponse{
+		Data: items,
+	})
+}
+
+// POST /api/trash/:id/restore { path: <restore_path>, overwrite: <bool> }
+func (h *TrashHandler) PostRestore(ctx *fiber.Ctx) error {
+	var req RestoreTrashRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&req); err != nil {
+			return BadRequestError("invalid request payload")
+		}
+	}
+	item, err := h.files.As(identityFrom(ctx)).RestoreTrash(ctx.Params("id"), req.Path, req.Overwrite)
+	if err != nil {
+		return mapTrashError(ctx, err)
+	}
+	return ctx.JSON(APIResponse{
+		Data: item,
+	})
+}
+
+// DELETE /api/trash/:id purges an item permanently
+func (h *TrashHandler) DeleteItem(ctx *fiber.Ctx) error {
+	if err := h.files.As(identityFrom(ctx)).PurgeTrash(ctx.Params("id")); err != nil {
+		return mapTrashError(ctx, err)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// DELETE /api/trash purges all items the caller may access, items of
+// read-only paths are kept
+func (h *TrashHandler) DeleteTrash(ctx *fiber.Ctx) error {
+	files := h.files.As(identityFrom(ctx))
+	items, err := files.ListTrash()
+	if err != nil {
+		return mapTrashError(ctx, err)
+	}
+	for _, item := range items {
+		err := files.PurgeTrash(item.ID)
+		if errors.Is(err, file.ErrTrashItemNotFound) || errors.Is(err, file.ErrReadOnlyPath) || errors.Is(err, file.ErrAccessDenied) {
+			continue
+		}
+		if err != nil {
+			return mapTrashError(ctx, err)
+		}
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewTrashHandler(files *file.LocalFileService) *TrashHandler {
+	return &TrashHandler{
+		files: files,
+	}
+}
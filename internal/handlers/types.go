@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"io"
 	"os"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
 )
 
 type LocalFileService interface {
 	Stat(relPath string) (os.FileInfo, error)
+	CheckRead(relPath string) error
 	List(relPath string) ([]os.FileInfo, error)
+	Readlink(relPath string) (string, error)
 	Open(relPath string) (*os.File, os.FileInfo, error)
+	ETag(relPath string) (string, error)
+	FileETag(f *os.File, fi os.FileInfo) (string, error)
+	IfMatch(relPath string, etags []string, fn func() error) error
 	ReadFile(relPath string) ([]byte, error)
 	WriteFile(relPath string, data []byte, create bool) error
 	SaveStream(relPath string, reader io.Reader, overwrite bool) error
@@ -17,6 +26,14 @@ type LocalFileService interface {
 	MkdirAll(relPath string) error
 	Rename(oldRelPath, newRelPath string, overwrite bool) error
 	DetectMIMEType(relPath string) (string, error)
+	WriteArchive(w io.Writer, relPath string, format file.ArchiveFormat) error
+	Extract(archiveRelPath, destRelPath string, opts file.ExtractOptions) (*file.ExtractResult, error)
+	ExtractReader(r io.ReaderAt, size int64, destRelPath string, opts file.ExtractOptions) (*file.ExtractResult, error)
+	Search(ctx context.Context, relPath string, opts file.SearchOptions, emit func(file.SearchMatch) error) (*file.SearchSummary, error)
+	Usage(relPath string, refresh bool) (*file.DirUsage, error)
+	Stage(change file.StagedChange) (file.StagedChange, error)
+	StageWrite(relPath string, reader io.Reader, overwrite bool, ifMatch []string) (file.StagedChange, error)
+	As(identity *auth.Identity) *file.LocalFileService
 }
 
 type MCRunnerService interface {
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var (
+	ErrUploadNotFound   = NewAPIError(fiber.StatusNotFound, "upload not found", "UPLOAD_NOT_FOUND")
+	ErrOffsetMismatch   = NewAPIError(fiber.StatusConflict, "upload offset mismatch", "OFFSET_MISMATCH")
+	ErrUploadTooLarge   = NewAPIError(fiber.StatusRequestEntityTooLarge, "upload exceeds the declared size", "UPLOAD_TOO_LARGE")
+	ErrChecksumMismatch = NewAPIError(fiber.StatusUnprocessableEntity, "checksum mismatch", "CHECKSUM_MISMATCH")
+)
+
+const (
+	headerUploadOffset = "Upload-Offset"
+	headerUploadLength = "Upload-Length"
+
+	mimeOffsetOctetStream = "application/offset+octet-stream"
+)
+
+// CreateUploadRequest is the body of POST /api/uploads.
+type CreateUploadRequest struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Overwrite bool   `json:"overwrite"`
+	SHA256    string `json:"sha256"` // optional hex digest verified before the file is replaced
+}
+
+// UploadsHandler implements resumable uploads under /api/uploads. A session
+// is created with the destination path and size, then the content is sent in
+// PATCH requests carrying the Upload-Offset they start at. After a failure the
+// client reads the current offset with HEAD and resumes from there.
+type UploadsHandler struct {
+	uploads *file.UploadManager
+}
+
+func mapUploadError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, file.ErrUploadNotFound):
+		return ErrUploadNotFound
+	case errors.Is(err, file.ErrOffsetMismatch):
+		return ErrOffsetMismatch
+	case errors.Is(err, file.ErrUploadTooLarge):
+		return ErrUploadTooLarge
+	case errors.Is(err, file.ErrChecksumMismatch):
+		return ErrChecksumMismatch
+	case errors.Is(err, file.ErrAlreadyExists):
+		return ErrFileExists
+	case errors.Is(err, file.ErrInvalidUploadSize), errors.Is(err, file.ErrIsDirectory), errors.Is(err, file.ErrPathTraversal):
+		return BadRequestError(err.Error())
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// getUpload returns the session if it belongs to the caller. Sessions of other
+// callers are reported as not found.
+func (h *UploadsHandler) getUpload(ctx *fiber.Ctx) (file.Upload, error) {
+	upload, err := h.uploads.Get(ctx.Params("id"))
+	if err != nil {
+		return upload, mapUploadError(ctx, err)
+	}
+	if identity := identityFrom(ctx); identity != nil && identity.ID != upload.Owner {
+		return upload, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func setUploadHeaders(ctx *fiber.Ctx, upload file.Upload) {
+	ctx.Set(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	ctx.Set(headerUploadLength, strconv.FormatInt(upload.Size, 10))
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+}
+
+// POST /api/uploads
+func (h *UploadsHandler) PostUpload(ctx *fiber.Ctx) error {
+	var req CreateUploadRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return BadRequestError("invalid request payload")
+	}
+	if strings.TrimSpace(req.Path) == "" {
+		return BadRequestError("missing path")
+	}
+	upload, err := h.uploads.Create(req.Path, req.Size, req.Overwrite, req.SHA256, identityFrom(ctx))
+	if err != nil {
+		return mapUploadError(ctx, err)
+	}
+	setUploadHeaders(ctx, upload)
+	ctx.Location("/api/uploads/" + upload.ID)
+	return ctx.Status(fiber.StatusCreated).JSON(APIResponse{
+		Data: upload,
+	})
+}
+
+// GET /api/uploads/:id
+func (h *UploadsHandler) GetUpload(ctx *fiber.Ctx) error {
+	upload, err := h.getUpload(ctx)
+	if err != nil {
+		return err
+	}
+	setUploadHeaders(ctx, upload)
+	return ctx.JSON(APIResponse{
+		Data: upload,
+	})
+}
+
+// HEAD /api/uploads/:id
+func (h *UploadsHandler) HeadUpload(ctx *fiber.Ctx) error {
+	upload, err := h.getUpload(ctx)
+	if err != nil {
+		return err
+	}
+	setUploadHeaders(ctx, upload)
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// PATCH /api/uploads/:id with the Upload-Offset header and a chunk body
+func (h *UploadsHandler) PatchUpload(ctx *fiber.Ctx) error {
+	if ctx.Get(fiber.HeaderContentType) != mimeOffsetOctetStream {
+		return BadRequestError("expected " + mimeOffsetOctetStream)
+	}
+	offset, err := strconv.ParseInt(ctx.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return BadRequestError("invalid " + headerUploadOffset + " header")
+	}
+	if _, err := h.getUpload(ctx); err != nil {
+		return err
+	}
+
+	upload, err := h.uploads.WriteChunk(ctx.Params("id"), offset, bytes.NewReader(ctx.Body()))
+	if err != nil {
+		if errors.Is(err, file.ErrOffsetMismatch) {
+			setUploadHeaders(ctx, upload)
+		}
+		return mapUploadError(ctx, err)
+	}
+	setUploadHeaders(ctx, upload)
+	return ctx.JSON(APIResponse{
+		Data: upload,
+	})
+}
+
+// DELETE /api/uploads/:id
+func (h *UploadsHandler) DeleteUpload(ctx *fiber.Ctx) error {
+	if _, err := h.getUpload(ctx); err != nil {
+		return err
+	}
+	if err := h.uploads.Abort(ctx.Params("id")); err != nil {
+		return mapUploadError(ctx, err)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewUploadsHandler(uploads *file.UploadManager) *UploadsHandler {
+	return &UploadsHandler{
+		uploads: uploads,
+	}
+}
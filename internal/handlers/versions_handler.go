@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var ErrVersionNotFound = NewAPIError(fiber.StatusNotFound, "version not found", "VERSION_NOT_FOUND")
+
+// RestoreVersionRequest is the body of POST /api/versions/*path.
+type RestoreVersionRequest struct {
+	ID string `json:"id"`
+}
+
+// VersionsHandler implements the history of overwritten text files under
+// /api/versions/*path.
+type VersionsHandler struct {
+	files *file.LocalFileService
+}
+
+func mapVersionError(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, file.ErrVersionNotFound) {
+		return ErrVersionNotFound
+	}
+	return mapLocalFileServiceError(ctx, err)
+}
+
+// GET /api/versions/*path
+// - Lists the versions of the file, newest first
+// - With id=<version>: return the content of the version
+// - With id=<version>&diff=true[&to=<version>]: return a unified diff from the version to another one or the current content
+func (h *VersionsHandler) GetVersions(ctx *fiber.Ctx) error {
+	rel := pathParam(ctx)
+	id := ctx.Query("id")
+	if id == "" {
+		versions, err := h.files.As(identityFrom(ctx)).ListVersions(rel)
+		if err != nil {
+			return mapVersionError(ctx, err)
+		}
+		return ctx.JSON(APIResponse{
+			Data: versions,
+		})
+	}
+	if strings.EqualFold(ctx.Query("diff"), "true") {
+		diff, err := h.files.As(identityFrom(ctx)).DiffVersion(rel, id, ctx.Query("to"))
+		if err != nil {
+			return mapVersionError(ctx, err)
+		}
+		ctx.Set(fiber.HeaderContentType, "text/x-diff; charset=utf-8")
+		return ctx.SendString(diff)
+	}
+	content, _, err := h.files.As(identityFrom(ctx)).ReadVersion(rel, id)
+	if err != nil {
+		return mapVersionError(ctx, err)
+	}
+	ctx.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return ctx.Send(content)
+}
+
+// POST /api/versions/*path { id: <version> } restores a version, keeping the
+// replaced content as a new version
+func (h *VersionsHandler) PostRestore(ctx *fiber.Ctx) error {
+	rel := pathParam(ctx)
+	var req RestoreVersionRequest
+	if err := ctx.BodyParser(&req); err != nil || req.ID == "" {
+		return BadRequestError("missing version id")
+	}
+	if err := h.files.As(identityFrom(ctx)).RestoreVersion(rel, req.ID); err != nil {
+		return mapVersionError(ctx, err)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func NewVersionsHandler(files *file.LocalFileService) *VersionsHandler {
+	return &VersionsHandler{
+		files: files,
+	}
+}
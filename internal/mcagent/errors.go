@@ -6,4 +6,5 @@ var (
 	ErrTicketNotFound  = fmt.Errorf("ticket not found")
 	ErrTicketExpired   = fmt.Errorf("ticket expired")
 	ErrServiceMismatch = fmt.Errorf("service mismatch")
+	ErrConfigNotLoaded = fmt.Errorf("plugin config not loaded")
 )
@@ -7,16 +7,31 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/khanghh/mcrunner/pkg/logger"
 )
 
+// statsTimeout bounds the stats request so a hung plugin does not stall the
+// state API.
+const statsTimeout = 2 * time.Second
+
 type MCAgentBridge struct {
-	configFile string
-	config     *PluginConfig
+	configFile  string
+	config      *PluginConfig
+	mu          sync.RWMutex
+	statsClient *http.Client
 }
 
+// HTTPPort returns the plugin HTTP port. The default port is used until the
+// plugin config has been loaded.
 func (m *MCAgentBridge) HTTPPort() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.config == nil {
+		return DefaultHTTPPort
+	}
 	return m.config.HTTPPort
 }
 
@@ -27,7 +42,7 @@ func IsValidateTicketErr(err error) bool {
 // LoginPlayer sends a login request to the MCAgent plugin
 // to log in the player with the given user information and ticket.
 func (m *MCAgentBridge) LoginPlayer(ctx context.Context, userInfo *UserInfo, playerUuid string, token string, ticket string) error {
-	loginURL := fmt.Sprintf("http://localhost:%d/auth/login", m.config.HTTPPort)
+	loginURL := fmt.Sprintf("http://localhost:%d/auth/login", m.HTTPPort())
 	resp, err := http.PostForm(loginURL, url.Values{
 		"userId":   {userInfo.UserID},
 		"username": {userInfo.Username},
@@ -55,7 +70,7 @@ func (m *MCAgentBridge) LoginPlayer(ctx context.Context, userInfo *UserInfo, pla
 // LogoutPlayer sends a logout request to the MCAgent plugin
 // to log out the player with the given username or login ticket.
 func (m *MCAgentBridge) LogoutPlayer(ctx context.Context, ticket string, username string) error {
-	logoutURL := fmt.Sprintf("http://localhost:%d/auth/logout", m.config.HTTPPort)
+	logoutURL := fmt.Sprintf("http://localhost:%d/auth/logout", m.HTTPPort())
 	resp, err := http.PostForm(logoutURL, url.Values{
 		"ticket":   {ticket},
 		"username": {username},
@@ -76,8 +91,14 @@ func (m *MCAgentBridge) LogoutPlayer(ctx context.Context, ticket string, usernam
 }
 
 func (m *MCAgentBridge) GetServerInfo() (*ServerInfo, error) {
-	statsURL := fmt.Sprintf("http://localhost:%d/stats", m.config.HTTPPort)
-	resp, err := http.Get(statsURL)
+	m.mu.RLock()
+	loaded := m.config != nil
+	m.mu.RUnlock()
+	if !loaded {
+		return nil, ErrConfigNotLoaded
+	}
+	statsURL := fmt.Sprintf("http://localhost:%d/stats", m.HTTPPort())
+	resp, err := m.statsClient.Get(statsURL)
 	if err != nil {
 		return nil, err
 	}
@@ -99,12 +120,15 @@ func (m *MCAgentBridge) Reload() error {
 		logger.Error(fmt.Sprintf("Failed to load config file %s", m.configFile), "error", err)
 		return err
 	}
+	m.mu.Lock()
 	m.config = config
+	m.mu.Unlock()
 	return nil
 }
 
 func NewMCAgentBridge(configFile string) *MCAgentBridge {
 	return &MCAgentBridge{
-		configFile: configFile,
+		configFile:  configFile,
+		statsClient: &http.Client{Timeout: statsTimeout},
 	}
 }
@@ -35,12 +35,14 @@ type MCServerCmd struct {
 	outputWriter io.Writer
 
 	mu        sync.Mutex
+	startMu   sync.Mutex // serializes Start, which runs beforeStart unlocked
 	done      chan struct{}
 	err       error
 	startTime *time.Time
 	status    Status
 
 	notifyStatusChanged func(status Status)
+	beforeStart         func() error
 }
 
 // NewMCServerCmd creates a new MCServerCmd instance with proper initialization.
@@ -153,12 +155,21 @@ func (m *MCServerCmd) GetStartTime() *time.Time {
 }
 
 // Start starts a Minecraft server process using the configured command and arguments.
+// The hook registered with OnBeforeStart runs first, while the server is still stopped.
 func (m *MCServerCmd) Start() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.status == StatusRunning {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+	if m.GetStatus() != StatusStopped {
 		return ErrAlreadyRunning
 	}
+	if m.beforeStart != nil {
+		if err := m.beforeStart(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	cmd := exec.Command(m.cmdPath, m.cmdArgs...)
 	if m.cmdDir != "" {
@@ -211,3 +222,10 @@ func (m *MCServerCmd) ResizeWindow(rows, cols int) error {
 func (m *MCServerCmd) OnStatusChanged(statusListener func(status Status)) {
 	m.notifyStatusChanged = statusListener
 }
+
+// OnBeforeStart registers a hook that runs on every start, including
+// restarts, before the server process is created. Start fails with the error
+// of the hook.
+func (m *MCServerCmd) OnBeforeStart(hook func() error) {
+	m.beforeStart = hook
+}
@@ -0,0 +1,16 @@
+package mcplayers
+
+import "errors"
+
+var (
+	ErrUnknownList   = errors.New("unknown list")
+	ErrInvalidEntry  = errors.New("invalid entry")
+	ErrInvalidFile   = errors.New("invalid list file")
+	ErrEntryNotFound = errors.New("entry not found")
+	ErrUnknownPlayer = errors.New("unknown player")
+	ErrNoPermissions = errors.New("no permissions for the list file")
+
+	// ErrServerRunning is returned for changes the console commands cannot
+	// make, such as a custom operator level or a temporary ban.
+	ErrServerRunning = errors.New("the change can only be made while the server is stopped")
+)
@@ -0,0 +1,217 @@
+// Package mcplayers manages the whitelist, operator and ban lists of a
+// Minecraft server. Changes go through the console while the server runs, so
+// it updates its own files, and are written to the JSON files while it is
+// stopped.
+package mcplayers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// List is one of the player lists of the server.
+type List string
+
+const (
+	Whitelist     List = "whitelist"
+	Ops           List = "ops"
+	BannedPlayers List = "banned-players"
+	BannedIPs     List = "banned-ips"
+)
+
+// Lists are the supported lists.
+var Lists = []List{Whitelist, Ops, BannedPlayers, BannedIPs}
+
+// ParseList returns the list named s.
+func ParseList(s string) (List, error) {
+	for _, l := range Lists {
+		if string(l) == s {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownList, s)
+}
+
+// File returns the file of the list relative to the root dir.
+func (l List) File() string {
+	return string(l) + ".json"
+}
+
+// timeFormat is the format of the created and expires fields of bans.
+const timeFormat = "2006-01-02 15:04:05 -0700"
+
+// forever is the expiry of permanent bans.
+const forever = "forever"
+
+// defaultReason is the reason the server gives bans without one.
+const defaultReason = "Banned by an operator."
+
+// Entry is an entry of a list. Players are identified by UUID and name,
+// banned addresses by IP. Level and BypassesPlayerLimit belong to operators,
+// the remaining fields to bans.
+type Entry struct {
+	UUID                string `json:"uuid,omitempty"`
+	Name                string `json:"name,omitempty"`
+	IP                  string `json:"ip,omitempty"`
+	Level               int    `json:"level,omitempty"`
+	BypassesPlayerLimit bool   `json:"bypassesPlayerLimit,omitempty"`
+	Created             string `json:"created,omitempty"`
+	Source              string `json:"source,omitempty"`
+	Expires             string `json:"expires,omitempty"`
+	Reason              string `json:"reason,omitempty"`
+}
+
+// the entries as the server writes them, with the fields of each list in
+// its order
+
+type whitelistRecord struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+type opRecord struct {
+	UUID                string `json:"uuid"`
+	Name                string `json:"name"`
+	Level               int    `json:"level"`
+	BypassesPlayerLimit bool   `json:"bypassesPlayerLimit"`
+}
+
+type playerBanRecord struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+type ipBanRecord struct {
+	IP      string `json:"ip"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+func (l List) record(e Entry) any {
+	switch l {
+	case Ops:
+		return opRecord{e.UUID, e.Name, e.Level, e.BypassesPlayerLimit}
+	case BannedPlayers:
+		return playerBanRecord{e.UUID, e.Name, e.Created, e.Source, e.Expires, e.Reason}
+	case BannedIPs:
+		return ipBanRecord{e.IP, e.Created, e.Source, e.Expires, e.Reason}
+	}
+	return whitelistRecord{e.UUID, e.Name}
+}
+
+// parseEntries parses a list file, an empty file is an empty list.
+func parseEntries(data []byte) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return entries, nil
+}
+
+// format formats entries like the server does.
+func (l List) format(entries []Entry) ([]byte, error) {
+	records := make([]any, 0, len(entries))
+	for _, e := range entries {
+		records = append(records, l.record(e))
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// matches reports whether e is the entry of player, a name, UUID or IP.
+func (l List) matches(e Entry, player string) bool {
+	if l == BannedIPs {
+		return e.IP == player
+	}
+	if uuid, err := parseUUID(player); err == nil {
+		return strings.EqualFold(e.UUID, uuid)
+	}
+	return strings.EqualFold(e.Name, player)
+}
+
+// namePattern matches player names, including the "." prefix proxies such
+// as Geyser give Bedrock players. It keeps names safe to use in commands.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.]{1,16}$`)
+
+func validName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// parseExpiry normalizes the expiry of a ban, which may be empty or
+// "forever" for permanent bans, RFC 3339 or the format of the server.
+func parseExpiry(s string) (string, error) {
+	if s == "" || strings.EqualFold(s, forever) {
+		return forever, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.Parse(timeFormat, s); err != nil {
+			return "", fmt.Errorf("%w: expires must be forever or a time", ErrInvalidEntry)
+		}
+	}
+	return t.Format(timeFormat), nil
+}
+
+// validate checks the fields of an entry to add to l and normalizes them.
+func (l List) validate(e *Entry) error {
+	switch l {
+	case BannedIPs:
+		ip := net.ParseIP(e.IP)
+		if ip == nil {
+			return fmt.Errorf("%w: invalid ip %q", ErrInvalidEntry, e.IP)
+		}
+		e.IP = ip.String()
+		e.UUID, e.Name = "", ""
+	default:
+		if e.Name == "" && e.UUID == "" {
+			return fmt.Errorf("%w: name or uuid required", ErrInvalidEntry)
+		}
+		if e.Name != "" && !validName(e.Name) {
+			return fmt.Errorf("%w: invalid name %q", ErrInvalidEntry, e.Name)
+		}
+		if e.UUID != "" {
+			uuid, err := parseUUID(e.UUID)
+			if err != nil {
+				return err
+			}
+			e.UUID = uuid
+		}
+		e.IP = ""
+	}
+	if l == Ops && (e.Level < 0 || e.Level > 4) {
+		return fmt.Errorf("%w: level must be between 1 and 4", ErrInvalidEntry)
+	}
+	if l != Ops {
+		e.Level, e.BypassesPlayerLimit = 0, false
+	}
+	if l != BannedPlayers && l != BannedIPs {
+		e.Expires, e.Reason = "", ""
+		return nil
+	}
+	if strings.ContainsFunc(e.Reason, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return fmt.Errorf("%w: reason contains control characters", ErrInvalidEntry)
+	}
+	expires, err := parseExpiry(e.Expires)
+	if err != nil {
+		return err
+	}
+	e.Expires = expires
+	e.Created, e.Source = "", ""
+	return nil
+}
@@ -0,0 +1,298 @@
+package mcplayers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/mcprops"
+)
+
+const propertiesFile = "server.properties"
+
+// Change is a change made to a list.
+type Change struct {
+	Entry   Entry `json:"entry"`
+	Console bool  `json:"console"` // sent to the running server as a command
+}
+
+// Manager reads and changes the lists. List files are accessed through the
+// file service as the calling identity, so path rules apply to them like to
+// any other file.
+type Manager struct {
+	files    *file.LocalFileService
+	mcserver *mccmd.MCServerCmd
+	mu       sync.Mutex // serializes read-modify-write cycles
+}
+
+func (m *Manager) running() bool {
+	return m.mcserver.GetStatus() == mccmd.StatusRunning
+}
+
+// property returns the value of a key of server.properties.
+func (m *Manager) property(key string) (string, bool) {
+	data, err := m.files.ReadFile(propertiesFile)
+	if err != nil {
+		return "", false
+	}
+	return mcprops.Parse(data).Get(key)
+}
+
+func (m *Manager) onlineMode() bool {
+	value, _ := m.property("online-mode")
+	return value != "false"
+}
+
+// opLevel returns the level the op command gives operators.
+func (m *Manager) opLevel() int {
+	value, _ := m.property("op-permission-level")
+	if level, err := strconv.Atoi(value); err == nil && level >= 1 && level <= 4 {
+		return level
+	}
+	return 4
+}
+
+// checkAccess rejects callers whose allowed paths do not cover the list file.
+func (m *Manager) checkAccess(list List, identity *auth.Identity) error {
+	if err := m.files.As(identity).CheckRead(list.File()); errors.Is(err, file.ErrPathNotAllowed) {
+		return ErrNoPermissions
+	}
+	return nil
+}
+
+func (m *Manager) read(files *file.LocalFileService, list List) ([]Entry, error) {
+	data, err := files.ReadFile(list.File())
+	if errors.Is(err, file.ErrNotFound) {
+		return make([]Entry, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(data)
+}
+
+// Entries returns the entries of a list in file order.
+func (m *Manager) Entries(list List, identity *auth.Identity) ([]Entry, error) {
+	if err := m.checkAccess(list, identity); err != nil {
+		return nil, err
+	}
+	return m.read(m.files.As(identity), list)
+}
+
+// addCommand returns the console command adding e to list.
+func addCommand(list List, e Entry) string {
+	switch list {
+	case Ops:
+		return "op " + e.Name
+	case BannedPlayers:
+		return joinCommand("ban", e.Name, e.Reason)
+	case BannedIPs:
+		return joinCommand("ban-ip", e.IP, e.Reason)
+	}
+	return "whitelist add " + e.Name
+}
+
+// removeCommand returns the console command removing player from list.
+func removeCommand(list List, player string) string {
+	switch list {
+	case Ops:
+		return "deop " + player
+	case BannedPlayers:
+		return "pardon " + player
+	case BannedIPs:
+		return "pardon-ip " + player
+	}
+	return "whitelist remove " + player
+}
+
+// commandTarget returns the name or IP of e for a console command. Entries
+// from files and the user cache are checked too, so that they cannot inject
+// commands.
+func commandTarget(list List, e Entry) (string, error) {
+	if list == BannedIPs {
+		if net.ParseIP(e.IP) == nil {
+			return "", fmt.Errorf("%w: invalid ip %q", ErrInvalidEntry, e.IP)
+		}
+		return e.IP, nil
+	}
+	if !validName(e.Name) {
+		return "", fmt.Errorf("%w: invalid name %q", ErrInvalidEntry, e.Name)
+	}
+	return e.Name, nil
+}
+
+func joinCommand(command, target, reason string) string {
+	if reason == "" {
+		return command + " " + target
+	}
+	return command + " " + target + " " + reason
+}
+
+// Add adds an entry to a list, replacing the entry of the same player or
+// address. While the server runs the matching console command is sent, which
+// cannot set an operator level other than op-permission-level, the player
+// limit bypass or an expiry. Otherwise the file is edited, which needs the
+// UUID of players.
+func (m *Manager) Add(list List, entry Entry, identity *auth.Identity) (*Change, error) {
+	if err := m.checkAccess(list, identity); err != nil {
+		return nil, err
+	}
+	if err := list.validate(&entry); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running() {
+		if list == Ops && (entry.Level != 0 && entry.Level != m.opLevel() || entry.BypassesPlayerLimit) {
+			return nil, fmt.Errorf("%w: the op command only grants level %d without player limit bypass", ErrServerRunning, m.opLevel())
+		}
+		if entry.Expires != "" && entry.Expires != forever {
+			return nil, fmt.Errorf("%w: the ban commands only ban forever", ErrServerRunning)
+		}
+		if list != BannedIPs {
+			// the server resolves names itself, the UUID is only needed
+			// to know the name
+			if err := m.resolve(&entry); err != nil && entry.Name == "" {
+				return nil, err
+			}
+		}
+		if _, err := commandTarget(list, entry); err != nil {
+			return nil, err
+		}
+		if err := m.mcserver.SendCommand(addCommand(list, entry)); err != nil {
+			return nil, err
+		}
+		return &Change{Entry: entry, Console: true}, nil
+	}
+
+	if list != BannedIPs {
+		if err := m.resolve(&entry); err != nil {
+			return nil, err
+		}
+	}
+	switch list {
+	case Ops:
+		if entry.Level == 0 {
+			entry.Level = m.opLevel()
+		}
+	case BannedPlayers, BannedIPs:
+		entry.Created = time.Now().Format(timeFormat)
+		entry.Source = "Server"
+		if identity != nil {
+			entry.Source = identity.Name
+		}
+		if entry.Reason == "" {
+			entry.Reason = defaultReason
+		}
+	}
+	files := m.files.As(identity)
+	entries, err := m.read(files, list)
+	if err != nil {
+		return nil, err
+	}
+	key := entry.UUID
+	if list == BannedIPs {
+		key = entry.IP
+	}
+	if i := slices.IndexFunc(entries, func(e Entry) bool { return list.matches(e, key) }); i >= 0 {
+		entries[i] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	if err := m.write(files, list, entries); err != nil {
+		return nil, err
+	}
+	return &Change{Entry: entry}, nil
+}
+
+// Remove removes the entry of player, a name, UUID or IP, from a list. While
+// the server runs the matching console command is sent, even for players
+// missing from the file, which the server may not have saved yet.
+func (m *Manager) Remove(list List, player string, identity *auth.Identity) (*Change, error) {
+	if err := m.checkAccess(list, identity); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := m.files.As(identity)
+	entries, err := m.read(files, list)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(entries, func(e Entry) bool { return list.matches(e, player) })
+
+	if m.running() {
+		var entry Entry
+		if i >= 0 {
+			entry = entries[i]
+		} else if err := m.removedEntry(list, player, &entry); err != nil {
+			return nil, err
+		}
+		target, err := commandTarget(list, entry)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.mcserver.SendCommand(removeCommand(list, target)); err != nil {
+			return nil, err
+		}
+		return &Change{Entry: entry, Console: true}, nil
+	}
+
+	if i < 0 {
+		return nil, ErrEntryNotFound
+	}
+	entry := entries[i]
+	entries = slices.DeleteFunc(entries, func(e Entry) bool { return list.matches(e, player) })
+	if err := m.write(files, list, entries); err != nil {
+		return nil, err
+	}
+	return &Change{Entry: entry}, nil
+}
+
+// removedEntry builds the entry of a player missing from the file, whose
+// name is needed for the console command.
+func (m *Manager) removedEntry(list List, player string, entry *Entry) error {
+	if list == BannedIPs {
+		ip := net.ParseIP(player)
+		if ip == nil {
+			return fmt.Errorf("%w: invalid ip %q", ErrInvalidEntry, player)
+		}
+		entry.IP = ip.String()
+		return nil
+	}
+	if uuid, err := parseUUID(player); err == nil {
+		entry.UUID = uuid
+	} else if validName(player) {
+		entry.Name = player
+	} else {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidEntry, player)
+	}
+	if err := m.resolve(entry); err != nil && entry.Name == "" {
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) write(files *file.LocalFileService, list List, entries []Entry) error {
+	data, err := list.format(entries)
+	if err != nil {
+		return err
+	}
+	return files.WriteFile(list.File(), data, true)
+}
+
+func NewManager(files *file.LocalFileService, mcserver *mccmd.MCServerCmd) *Manager {
+	return &Manager{
+		files:    files,
+		mcserver: mcserver,
+	}
+}
@@ -0,0 +1,83 @@
+package mcplayers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// userCacheFile is the cache of the names and UUIDs of the players the
+// server has seen.
+const userCacheFile = "usercache.json"
+
+type userCacheEntry struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+// parseUUID parses a UUID with or without dashes and returns it in the
+// dashed lowercase form of the list files.
+func parseUUID(s string) (string, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return "", fmt.Errorf("%w: invalid uuid %q", ErrInvalidEntry, s)
+	}
+	return formatUUID(b), nil
+}
+
+func formatUUID(b []byte) string {
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// offlineUUID returns the UUID servers in offline mode give name, a version
+// 3 UUID of "OfflinePlayer:" followed by the name.
+func offlineUUID(name string) string {
+	b := md5.Sum([]byte("OfflinePlayer:" + name))
+	b[6] = b[6]&0x0f | 0x30
+	b[8] = b[8]&0x3f | 0x80
+	return formatUUID(b[:])
+}
+
+// lookupUserCache returns the cached player with the given name or UUID,
+// names are matched case-insensitively like the server does.
+func (m *Manager) lookupUserCache(name, uuid string) (userCacheEntry, bool) {
+	data, err := m.files.ReadFile(userCacheFile)
+	if err != nil {
+		return userCacheEntry{}, false
+	}
+	var cache []userCacheEntry
+	if json.Unmarshal(data, &cache) != nil {
+		return userCacheEntry{}, false
+	}
+	for _, e := range cache {
+		if uuid != "" && strings.EqualFold(e.UUID, uuid) || uuid == "" && strings.EqualFold(e.Name, name) {
+			return e, true
+		}
+	}
+	return userCacheEntry{}, false
+}
+
+// resolve fills in the UUID or name missing from a player entry. Names are
+// looked up in the user cache and, on servers in offline mode, derived like
+// the server does; online-mode servers look up unknown names at Mojang, which
+// only the console commands can do.
+func (m *Manager) resolve(e *Entry) error {
+	if e.UUID != "" && e.Name != "" {
+		return nil
+	}
+	if cached, ok := m.lookupUserCache(e.Name, e.UUID); ok {
+		e.Name, e.UUID = cached.Name, strings.ToLower(cached.UUID)
+		return nil
+	}
+	if e.UUID != "" {
+		return fmt.Errorf("%w: no name known for %s, pass the name too", ErrUnknownPlayer, e.UUID)
+	}
+	if !m.onlineMode() {
+		e.UUID = offlineUUID(e.Name)
+		return nil
+	}
+	return fmt.Errorf("%w: %s has not joined the server, pass the uuid too or start the server", ErrUnknownPlayer, e.Name)
+}
@@ -0,0 +1,243 @@
+// Package mcprops reads and edits server.properties files. Edits keep the
+// comments, blank lines and order of the file, only the changed entries are
+// rewritten.
+package mcprops
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// line is a logical line of the file. Comments and blank lines have no key,
+// entries may span several physical lines joined by trailing backslashes.
+type line struct {
+	raw   string
+	key   string
+	value string
+	entry bool
+}
+
+// Properties is a parsed properties file. Like java.util.Properties, the
+// last of duplicate keys wins.
+type Properties struct {
+	lines []line
+	eol   string
+}
+
+// Parse parses a file in the java.util.Properties format written by
+// Minecraft servers.
+func Parse(data []byte) *Properties {
+	text := string(data)
+	p := &Properties{eol: "\n"}
+	if strings.Contains(text, "\r\n") {
+		p.eol = "\r\n"
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return p
+	}
+	physical := strings.Split(text, "\n")
+	for i := 0; i < len(physical); i++ {
+		raw := physical[i]
+		content := strings.TrimLeft(raw, " \t\f")
+		if content == "" || content[0] == '#' || content[0] == '!' {
+			p.lines = append(p.lines, line{raw: raw})
+			continue
+		}
+		// join continuation lines, leading whitespace of the next line is
+		// not part of the value
+		for continues(content) && i+1 < len(physical) {
+			i++
+			raw += "\n" + physical[i]
+			content = content[:len(content)-1] + strings.TrimLeft(physical[i], " \t\f")
+		}
+		if continues(content) {
+			content = content[:len(content)-1]
+		}
+		key, value := splitEntry(content)
+		p.lines = append(p.lines, line{raw: raw, key: key, value: value, entry: true})
+	}
+	return p
+}
+
+// continues reports whether a line ends with an odd number of backslashes.
+func continues(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitEntry splits a logical line into its unescaped key and value. The key
+// ends at the first unescaped '=', ':' or whitespace.
+func splitEntry(s string) (string, string) {
+	end := len(s)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", s[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	key, rest := s[:end], s[end:]
+	rest = strings.TrimLeft(rest, " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return unescape(key), unescape(rest)
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	var units []uint16
+	flush := func() {
+		if len(units) > 0 {
+			b.WriteString(string(utf16.Decode(units)))
+			units = units[:0]
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			flush()
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'u':
+			if i+4 < len(s) {
+				if u, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					units = append(units, uint16(u))
+					i += 4
+					continue
+				}
+			}
+			flush()
+			b.WriteByte(c)
+			continue
+		case 't':
+			c = '\t'
+		case 'n':
+			c = '\n'
+		case 'r':
+			c = '\r'
+		case 'f':
+			c = '\f'
+		}
+		flush()
+		b.WriteByte(c)
+	}
+	flush()
+	return b.String()
+}
+
+// escape escapes s like java.util.Properties.store, writing characters
+// outside of printable ASCII as \uXXXX so the file reads the same in any
+// charset. Spaces are escaped everywhere in keys, only leading in values.
+func escape(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case r == '\\' || r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// index returns the index of the line holding the value of key, or -1.
+func (p *Properties) index(key string) int {
+	for i := len(p.lines) - 1; i >= 0; i-- {
+		if p.lines[i].entry && p.lines[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of key.
+func (p *Properties) Get(key string) (string, bool) {
+	if i := p.index(key); i >= 0 {
+		return p.lines[i].value, true
+	}
+	return "", false
+}
+
+// Keys returns the keys in the order of the file.
+func (p *Properties) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, l := range p.lines {
+		if l.entry && !seen[l.key] {
+			seen[l.key] = true
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+// Set sets the value of key in place, or appends it to the end of the file
+// when it is new. Earlier duplicates of the key are removed.
+func (p *Properties) Set(key, value string) {
+	l := line{raw: escape(key, true) + "=" + escape(value, false), key: key, value: value, entry: true}
+	i := p.index(key)
+	if i < 0 {
+		p.lines = append(p.lines, l)
+		return
+	}
+	p.lines[i] = l
+	for j := i - 1; j >= 0; j-- {
+		if p.lines[j].entry && p.lines[j].key == key {
+			p.lines = slices.Delete(p.lines, j, j+1)
+		}
+	}
+}
+
+// Delete removes every entry of key, reporting whether there was one.
+func (p *Properties) Delete(key string) bool {
+	n := len(p.lines)
+	p.lines = slices.DeleteFunc(p.lines, func(l line) bool {
+		return l.entry && l.key == key
+	})
+	return len(p.lines) != n
+}
+
+// Bytes formats the file.
+func (p *Properties) Bytes() []byte {
+	var b strings.Builder
+	for _, l := range p.lines {
+		b.WriteString(strings.ReplaceAll(l.raw, "\n", p.eol))
+		b.WriteString(p.eol)
+	}
+	return []byte(b.String())
+}
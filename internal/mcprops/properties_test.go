@@ -0,0 +1,170 @@
+package mcprops
+
+import (
+	"strings"
+	"testing"
+)
+
+// vanillaProperties is a server.properties written by a vanilla 1.20 server,
+// trimmed to the keys that matter for the tests.
+const vanillaProperties = `#Minecraft server properties
+#Sat Mar 02 14:05:11 UTC 2024
+enable-jmx-monitoring=false
+rcon.port=25575
+level-seed=
+gamemode=survival
+enable-command-block=false
+enable-query=false
+generator-settings={}
+level-name=world
+motd=A Minecraft Server
+query.port=25565
+pvp=true
+difficulty=easy
+network-compression-threshold=256
+max-tick-time=60000
+require-resource-pack=false
+max-players=20
+resource-pack=https\://example.com/pack.zip
+online-mode=true
+resource-pack-prompt=
+view-distance=10
+server-ip=
+allow-flight=false
+white-list=false
+server-port=25565
+spawn-protection=16
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		key   string
+		want  string
+		found bool
+	}{
+		{"equals", "motd=A Minecraft Server", "motd", "A Minecraft Server", true},
+		{"colon", "motd: hello", "motd", "hello", true},
+		{"whitespace separator", "motd   hello", "motd", "hello", true},
+		{"empty value", "level-seed=", "level-seed", "", true},
+		{"escaped separator in key", `a\=b=c`, "a=b", "c", true},
+		{"escaped colon in value", `resource-pack=https\://example.com`, "resource-pack", "https://example.com", true},
+		{"leading whitespace", "  \tmotd=hi", "motd", "hi", true},
+		{"comment", "#motd=hi", "motd", "", false},
+		{"bang comment", "!motd=hi", "motd", "", false},
+		{"continuation", "motd=hello \\\n    world", "motd", "hello world", true},
+		{"continuation chain", "motd=a\\\n b\\\n c", "motd", "abc", true},
+		{"continuation at end of file", "motd=hello\\", "motd", "hello", true},
+		{"escaped backslash is no continuation", "motd=a\\\\\nb=c", "motd", `a\`, true},
+		{"continuation in crlf file", "motd=hello \\\r\n  world\r\n", "motd", "hello world", true},
+		{"escapes", `motd=a\tb\nc\rd\fe\\f`, "motd", "a\tb\nc\rd\fe\\f", true},
+		{"unicode escape", `motd=\u00A7aGreen`, "motd", "§aGreen", true},
+		{"surrogate pair", `motd=\uD83D\uDE00`, "motd", "😀", true},
+		{"lone surrogate", `motd=\uD83Dx`, "motd", "\uFFFDx", true},
+		{"short unicode escape", `motd=\u00`, "motd", "u00", true},
+		{"duplicate keys, last wins", "motd=first\nmotd=second", "motd", "second", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := Parse([]byte(tt.data)).Get(tt.key)
+			if got != tt.want || found != tt.found {
+				t.Fatalf("Get(%s) = %q, %v, want %q, %v", tt.key, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		key   bool
+		want  string
+	}{
+		{"plain", "A Minecraft Server", false, "A Minecraft Server"},
+		{"leading space in value", " hi there", false, `\ hi there`},
+		{"spaces in key", "a b", true, `a\ b`},
+		{"separators", "a=b:c", false, `a\=b\:c`},
+		{"comment chars", "#!", false, `\#\!`},
+		{"backslash", `a\b`, false, `a\\b`},
+		{"control chars", "a\tb\nc\rd\fe", false, `a\tb\nc\rd\fe`},
+		{"non ascii", "§a", false, `\u00A7a`},
+		{"surrogate pair", "😀", false, `\uD83D\uDE00`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := escape(tt.value, tt.key)
+			if got != tt.want {
+				t.Fatalf("escape(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+			if back := unescape(got); back != tt.value {
+				t.Fatalf("unescape(%q) = %q, want %q", got, back, tt.value)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		edit func(p *Properties)
+		want string
+	}{
+		{"set in place", "#c\na=1\nb=2\n", func(p *Properties) { p.Set("a", "3") }, "#c\na=3\nb=2\n"},
+		{"set appends", "a=1\n", func(p *Properties) { p.Set("b", "2") }, "a=1\nb=2\n"},
+		{"set empty file", "", func(p *Properties) { p.Set("a", "1") }, "a=1\n"},
+		{"set keeps crlf", "#c\r\na=1\r\nb=2\r\n", func(p *Properties) { p.Set("a", "3") }, "#c\r\na=3\r\nb=2\r\n"},
+		{"continuation kept with crlf", "a=x\\\r\n  y\r\nb=2\r\n", func(p *Properties) { p.Set("b", "3") }, "a=x\\\r\n  y\r\nb=3\r\n"},
+		{"set replaces continuation", "a=x\\\n  y\nb=2\n", func(p *Properties) { p.Set("a", "z") }, "a=z\nb=2\n"},
+		{"set drops earlier duplicates", "a=1\nb=2\na=3\n", func(p *Properties) { p.Set("a", "4") }, "b=2\na=4\n"},
+		{"delete removes duplicates", "a=1\nb=2\na=3\n", func(p *Properties) { p.Delete("a") }, "b=2\n"},
+		{"set escapes", "a=1\n", func(p *Properties) { p.Set("motd", " §a=hi") }, "a=1\nmotd=\\ \\u00A7a\\=hi\n"},
+		{"untouched escapes kept", "a=\\u00a7\nb=1\n", func(p *Properties) { p.Set("b", "2") }, "a=\\u00a7\nb=2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Parse([]byte(tt.data))
+			tt.edit(p)
+			if got := string(p.Bytes()); got != tt.want {
+				t.Fatalf("Bytes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVanillaRoundTrip(t *testing.T) {
+	p := Parse([]byte(vanillaProperties))
+	if got := string(p.Bytes()); got != vanillaProperties {
+		t.Fatalf("unchanged Bytes() differs from the input:\n%s", got)
+	}
+	if got, _ := p.Get("resource-pack"); got != "https://example.com/pack.zip" {
+		t.Fatalf("resource-pack = %q", got)
+	}
+
+	p.Set("motd", "§6Welcome")
+	p.Set("max-players", "50")
+	p.Set("resource-pack", "https://example.com/other.zip")
+	p.Delete("enable-jmx-monitoring")
+	p.Set("hide-online-players", "true")
+	want := strings.NewReplacer(
+		"motd=A Minecraft Server\n", "motd=\\u00A76Welcome\n",
+		"max-players=20\n", "max-players=50\n",
+		"resource-pack=https\\://example.com/pack.zip\n", "resource-pack=https\\://example.com/other.zip\n",
+		"enable-jmx-monitoring=false\n", "",
+	).Replace(vanillaProperties) + "hide-online-players=true\n"
+	got := p.Bytes()
+	if string(got) != want {
+		t.Fatalf("Bytes() = %q, want %q", got, want)
+	}
+
+	// the written file parses back to the same values
+	reparsed := Parse(got)
+	for _, key := range p.Keys() {
+		want, _ := p.Get(key)
+		if got, _ := reparsed.Get(key); got != want {
+			t.Fatalf("%s = %q after reparsing, want %q", key, got, want)
+		}
+	}
+}
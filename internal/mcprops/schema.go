@@ -0,0 +1,188 @@
+package mcprops
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of a property value.
+type Type string
+
+const (
+	TypeString  Type = "string"
+	TypeBoolean Type = "boolean"
+	TypeInteger Type = "integer"
+	TypePort    Type = "port"
+	TypeEnum    Type = "enum"
+)
+
+// Key describes a property known to vanilla servers.
+type Key struct {
+	Name   string
+	Type   Type
+	Min    int64    // lower bound of integers and ports
+	Max    int64    // upper bound of integers and ports
+	Values []string // allowed values of enums
+
+	// command returns the console command applying the value to a running
+	// server, keys without one only take effect after a restart
+	command func(value string) string
+}
+
+func boolean(name string) Key {
+	return Key{Name: name, Type: TypeBoolean}
+}
+
+func str(name string) Key {
+	return Key{Name: name, Type: TypeString}
+}
+
+func integer(name string, min, max int64) Key {
+	return Key{Name: name, Type: TypeInteger, Min: min, Max: max}
+}
+
+func port(name string) Key {
+	return Key{Name: name, Type: TypePort, Min: 1, Max: 65535}
+}
+
+func enum(name string, values ...string) Key {
+	return Key{Name: name, Type: TypeEnum, Values: values}
+}
+
+func (k Key) live(command func(value string) string) Key {
+	k.command = command
+	return k
+}
+
+// keys are the properties of the dedicated server as of Minecraft 1.21,
+// including ones older versions still read
+var keys = []Key{
+	boolean("accepts-transfers"),
+	boolean("allow-flight"),
+	boolean("allow-nether"),
+	boolean("broadcast-console-to-ops"),
+	boolean("broadcast-rcon-to-ops"),
+	str("bug-report-link"),
+	enum("difficulty", "peaceful", "easy", "normal", "hard").live(func(v string) string {
+		return "difficulty " + v
+	}),
+	boolean("enable-command-block"),
+	boolean("enable-jmx-monitoring"),
+	boolean("enable-query"),
+	boolean("enable-rcon"),
+	boolean("enable-status"),
+	boolean("enforce-secure-profile"),
+	boolean("enforce-whitelist"),
+	integer("entity-broadcast-range-percentage", 10, 1000),
+	boolean("force-gamemode"),
+	integer("function-permission-level", 1, 4),
+	enum("gamemode", "survival", "creative", "adventure", "spectator").live(func(v string) string {
+		return "defaultgamemode " + v
+	}),
+	boolean("generate-structures"),
+	str("generator-settings"),
+	boolean("hardcore"),
+	boolean("hide-online-players"),
+	str("initial-disabled-packs"),
+	str("initial-enabled-packs"),
+	str("level-name"),
+	str("level-seed"),
+	str("level-type"),
+	boolean("log-ips"),
+	integer("max-chained-neighbor-updates", math.MinInt32, math.MaxInt32),
+	integer("max-players", 0, math.MaxInt32),
+	integer("max-tick-time", -1, math.MaxInt64),
+	integer("max-world-size", 1, 29999984),
+	str("motd"),
+	integer("network-compression-threshold", -1, math.MaxInt32),
+	boolean("online-mode"),
+	integer("op-permission-level", 0, 4),
+	integer("pause-when-empty-seconds", math.MinInt32, math.MaxInt32),
+	integer("player-idle-timeout", 0, math.MaxInt32),
+	boolean("prevent-proxy-connections"),
+	boolean("pvp"),
+	port("query.port"),
+	integer("rate-limit", 0, math.MaxInt32),
+	str("rcon.password"),
+	port("rcon.port"),
+	enum("region-file-compression", "deflate", "lz4", "none"),
+	boolean("require-resource-pack"),
+	str("resource-pack"),
+	str("resource-pack-id"),
+	str("resource-pack-prompt"),
+	str("resource-pack-sha1"),
+	str("server-ip"),
+	port("server-port"),
+	integer("simulation-distance", 3, 32),
+	boolean("spawn-animals"),
+	boolean("spawn-monsters"),
+	boolean("spawn-npcs"),
+	integer("spawn-protection", 0, math.MaxInt32),
+	boolean("sync-chunk-writes"),
+	str("text-filtering-config"),
+	integer("text-filtering-version", 0, math.MaxInt32),
+	boolean("use-native-transport"),
+	integer("view-distance", 3, 32),
+	boolean("white-list").live(func(v string) string {
+		if v == "true" {
+			return "whitelist on"
+		}
+		return "whitelist off"
+	}),
+}
+
+// Lookup returns the description of a known key.
+func Lookup(name string) (Key, bool) {
+	i := slices.IndexFunc(keys, func(k Key) bool { return k.Name == name })
+	if i < 0 {
+		return Key{}, false
+	}
+	return keys[i], true
+}
+
+// Live reports whether a running server can apply the key without a restart.
+func (k Key) Live() bool {
+	return k.command != nil
+}
+
+// Command returns the console command applying value, empty when the key
+// needs a restart.
+func (k Key) Command(value string) string {
+	if k.command == nil {
+		return ""
+	}
+	return k.command(value)
+}
+
+// Normalize validates value against the type of the key and returns it in
+// the form the server writes, e.g. lowercase booleans and enum values.
+func (k Key) Normalize(value string) (string, error) {
+	switch k.Type {
+	case TypeBoolean:
+		// the server reads anything but "true" as false, reject typos
+		v := strings.ToLower(strings.TrimSpace(value))
+		if v != "true" && v != "false" {
+			return "", fmt.Errorf("%s must be true or false", k.Name)
+		}
+		return v, nil
+	case TypeInteger, TypePort:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || n < k.Min || n > k.Max {
+			if k.Type == TypePort {
+				return "", fmt.Errorf("%s must be a port between 1 and 65535", k.Name)
+			}
+			return "", fmt.Errorf("%s must be an integer between %d and %d", k.Name, k.Min, k.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case TypeEnum:
+		v := strings.ToLower(strings.TrimSpace(value))
+		if !slices.Contains(k.Values, v) {
+			return "", fmt.Errorf("%s must be one of %s", k.Name, strings.Join(k.Values, ", "))
+		}
+		return v, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,227 @@
+// Package netmux serves HTTP/2 (gRPC) and HTTP/1.x (REST, WebSocket) on a
+// single listener by sniffing the client connection preface.
+package netmux
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// http2Preface is the connection preface every HTTP/2 client sends first.
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// sniffTimeout bounds how long a client may take to complete the TLS
+// handshake and send its first bytes.
+const sniffTimeout = 10 * time.Second
+
+var ErrListenerClosed = errors.New("mux: listener closed")
+
+// Mux dispatches connections accepted by the root listener to an HTTP/2
+// listener and an HTTP/1.x listener.
+type Mux struct {
+	root  net.Listener
+	http2 *muxListener
+	http1 *muxListener
+
+	mu   sync.Mutex
+	open int
+}
+
+// New creates a multiplexer on l. If l is a TLS listener, the handshake is
+// completed before sniffing and the resulting connections expose the TLS
+// connection state.
+func New(l net.Listener) *Mux {
+	m := &Mux{root: l, open: 2}
+	m.http2 = newMuxListener(m)
+	m.http1 = newMuxListener(m)
+	return m
+}
+
+// HTTP2 returns the listener receiving HTTP/2 connections, for the gRPC server.
+func (m *Mux) HTTP2() net.Listener {
+	return m.http2
+}
+
+// HTTP1 returns the listener receiving all other connections.
+func (m *Mux) HTTP1() net.Listener {
+	return m.http1
+}
+
+// Serve accepts connections until the root listener is closed.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.root.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			m.http2.closeWithError(err)
+			m.http1.closeWithError(err)
+			return err
+		}
+		go m.dispatch(conn)
+	}
+}
+
+func (m *Mux) dispatch(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(sniffTimeout))
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return
+		}
+	}
+	r := bufio.NewReader(conn)
+	isHTTP2, err := sniffHTTP2(r)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	muxConn := wrapConn(conn, r)
+	if isHTTP2 {
+		m.http2.deliver(muxConn)
+	} else {
+		m.http1.deliver(muxConn)
+	}
+}
+
+// sniffHTTP2 reports whether the buffered connection starts with the HTTP/2
+// preface. It returns as soon as the bytes read so far diverge, so short
+// HTTP/1.x requests are not delayed.
+func sniffHTTP2(r *bufio.Reader) (bool, error) {
+	for n := 1; ; {
+		b, err := r.Peek(n)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(b, http2Preface[:n]) {
+			return false, nil
+		}
+		if n == len(http2Preface) {
+			return true, nil
+		}
+		n = min(max(n+1, r.Buffered()), len(http2Preface))
+	}
+}
+
+// listenerClosed closes the root listener once both child listeners are
+// closed, so each server can shut down independently.
+func (m *Mux) listenerClosed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.open--
+	if m.open == 0 {
+		m.root.Close()
+	}
+}
+
+type muxListener struct {
+	mux    *Mux
+	connCh chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func newMuxListener(m *Mux) *muxListener {
+	return &muxListener{
+		mux:    m,
+		connCh: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+}
+
+func (l *muxListener) deliver(conn net.Conn) {
+	select {
+	case l.connCh <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *muxListener) closeWithError(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+		l.mux.listenerClosed()
+	})
+}
+
+func (l *muxListener) Close() error {
+	l.closeWithError(ErrListenerClosed)
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.mux.root.Addr()
+}
+
+// conn replays the sniffed bytes before reading from the connection.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// tlsConn additionally exposes the TLS state, which fasthttp and the gRPC
+// transport credentials use to read client certificates.
+type tlsConn struct {
+	conn
+	tls *tls.Conn
+}
+
+func (c *tlsConn) Handshake() error {
+	return c.tls.Handshake()
+}
+
+func (c *tlsConn) ConnectionState() tls.ConnectionState {
+	return c.tls.ConnectionState()
+}
+
+func wrapConn(c net.Conn, r *bufio.Reader) net.Conn {
+	if t, ok := c.(*tls.Conn); ok {
+		return &tlsConn{conn: conn{Conn: c, r: r}, tls: t}
+	}
+	return &conn{Conn: c, r: r}
+}
+
+// TLSConfig returns a copy of cfg for a multiplexed TLS listener. HTTP/2 is
+// only negotiated with clients that do not also offer HTTP/1.1: gRPC clients
+// offer "h2" alone, whereas browsers and curl offer both and must be served
+// by the HTTP/1.x server.
+func TLSConfig(cfg *tls.Config) *tls.Config {
+	base := cfg.Clone()
+	base.NextProtos = []string{"h2", "http/1.1"}
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if !slices.Contains(hello.SupportedProtos, "http/1.1") {
+			return nil, nil
+		}
+		c := base.Clone()
+		c.NextProtos = []string{"http/1.1"}
+		c.GetConfigForClient = nil
+		return c, nil
+	}
+	return base
+}
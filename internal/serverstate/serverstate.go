@@ -0,0 +1,71 @@
+// Package serverstate builds the server state snapshot reported by both the
+// HTTP and gRPC APIs, so the two always expose the same data.
+package serverstate
+
+import (
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/mcagent"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/sysmetrics"
+)
+
+// State is a point-in-time snapshot of the server process, the container
+// resources and the Minecraft server as reported by the agent plugin.
+type State struct {
+	Status    mccmd.Status
+	PID       int
+	IPAddress string
+	UptimeSec uint64
+	Usage     sysmetrics.ResourceUsage
+	Server    *mcagent.ServerInfo // nil when the plugin is unreachable
+}
+
+// TPS returns the most recent TPS average, or 0 when unknown.
+func (s *State) TPS() float64 {
+	if s.Server == nil || len(s.Server.TPS) == 0 {
+		return 0
+	}
+	return s.Server.TPS[0]
+}
+
+// Builder collects State snapshots.
+type Builder struct {
+	mcserver *mccmd.MCServerCmd
+	mcagent  *mcagent.MCAgentBridge
+}
+
+func NewBuilder(mcserver *mccmd.MCServerCmd, mcagent *mcagent.MCAgentBridge) *Builder {
+	return &Builder{
+		mcserver: mcserver,
+		mcagent:  mcagent,
+	}
+}
+
+// Build returns the current server state.
+func (b *Builder) Build() *State {
+	state := &State{
+		Status: b.mcserver.GetStatus(),
+	}
+	if ipAddr, err := sysmetrics.GetOutboundIP(); err == nil {
+		state.IPAddress = ipAddr.String()
+	}
+	if usage := sysmetrics.GetResourceUsage(); usage != nil {
+		state.Usage = *usage
+	}
+
+	process := b.mcserver.GetProcess()
+	if process == nil {
+		return state
+	}
+	state.PID = process.Pid
+	if startTime := b.mcserver.GetStartTime(); startTime != nil {
+		state.UptimeSec = uint64(time.Since(*startTime).Seconds())
+	}
+	if b.mcagent != nil {
+		if serverInfo, err := b.mcagent.GetServerInfo(); err == nil {
+			state.Server = serverInfo
+		}
+	}
+	return state
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/pkg/logger"
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes maps each RPC to the scope required to call it. RPCs missing
+// from the map require the admin scope.
+var methodScopes = map[string]auth.Scope{
+	pb.MCRunner_StartServer_FullMethodName:   auth.ScopeLifecycle,
+	pb.MCRunner_StopServer_FullMethodName:    auth.ScopeLifecycle,
+	pb.MCRunner_KillServer_FullMethodName:    auth.ScopeLifecycle,
+	pb.MCRunner_RestartServer_FullMethodName: auth.ScopeLifecycle,
+	pb.MCRunner_GetState_FullMethodName:      auth.ScopeStateRead,
+	pb.MCRunner_SendCommand_FullMethodName:   auth.ScopeConsoleWrite,
+	pb.MCRunner_ResizeConsole_FullMethodName: auth.ScopeConsoleWrite,
+	pb.MCRunner_StreamConsole_FullMethodName: auth.ScopeConsoleRead,
+	pb.MCRunner_StreamState_FullMethodName:   auth.ScopeStateRead,
+	pb.MCRunner_WatchConsole_FullMethodName:  auth.ScopeConsoleRead,
+	pb.MCRunner_WriteConsole_FullMethodName:  auth.ScopeConsoleWrite,
+	pb.Files_Stat_FullMethodName:             auth.ScopeFilesRead,
+	pb.Files_List_FullMethodName:             auth.ScopeFilesRead,
+	pb.Files_Download_FullMethodName:         auth.ScopeFilesRead,
+	pb.Files_Watch_FullMethodName:            auth.ScopeFilesRead,
+	pb.Files_Mkdir_FullMethodName:            auth.ScopeFilesWrite,
+	pb.Files_Rename_FullMethodName:           auth.ScopeFilesWrite,
+	pb.Files_Delete_FullMethodName:           auth.ScopeFilesWrite,
+	pb.Files_Upload_FullMethodName:           auth.ScopeFilesWrite,
+	pb.Players_List_FullMethodName:           auth.ScopeStateRead,
+	pb.Players_Add_FullMethodName:            auth.ScopeConsoleWrite,
+	pb.Players_Remove_FullMethodName:         auth.ScopeConsoleWrite,
+}
+
+// requiredScope returns the scope needed to call method.
+func requiredScope(method string) auth.Scope {
+	if scope, ok := methodScopes[method]; ok {
+		return scope
+	}
+	return auth.ScopeAdmin
+}
+
+// authenticate resolves the caller identity from the bearer token in the
+// incoming metadata or from the client TLS certificate.
+func authenticate(ctx context.Context, authenticator auth.Authenticator) (*auth.Identity, error) {
+	if authenticator == nil {
+		return auth.AnonymousIdentity, nil
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = auth.ParseBearerToken(values[0])
+		}
+	}
+	var peerCerts []*x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			peerCerts = tlsInfo.State.PeerCertificates
+		}
+	}
+	identity, err := auth.AuthenticateRequest(authenticator, token, peerCerts)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrMissingToken):
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		case errors.Is(err, auth.ErrTokenExpired):
+			return nil, status.Error(codes.Unauthenticated, "token expired")
+		default:
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+	}
+	return identity, nil
+}
+
+// authorize authenticates the caller and checks that it was granted the scope
+// required by method. The returned context carries the caller identity.
+func authorize(ctx context.Context, authenticator auth.Authenticator, method string) (context.Context, error) {
+	identity, err := authenticate(ctx, authenticator)
+	if err != nil {
+		logger.Warn("auth", "Rejected unauthenticated call", "method", method, "error", err)
+		return nil, err
+	}
+	scope := requiredScope(method)
+	if !identity.HasScope(scope) {
+		logger.Warn("auth", "Rejected unauthorized call", "method", method, "identity", identity.Name, "scope", scope)
+		return nil, status.Errorf(codes.PermissionDenied, "missing scope %s", scope)
+	}
+	if scope == auth.ScopeStateRead || scope == auth.ScopeConsoleRead {
+		logger.Debug("auth", "Authorized call", "method", method, "identity", identity.Name)
+	} else {
+		logger.Info("auth", "Authorized call", "method", method, "identity", identity.Name)
+	}
+	return auth.NewContext(ctx, identity), nil
+}
+
+// authServerStream overrides the stream context with the authorized one.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryAuthInterceptor enforces per-RPC scopes on unary calls. A nil
+// authenticator disables authentication.
+func UnaryAuthInterceptor(authenticator auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		authCtx, err := authorize(ctx, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(authCtx, req)
+	}
+}
+
+// StreamAuthInterceptor enforces per-RPC scopes on streaming calls. A nil
+// authenticator disables authentication.
+func StreamAuthInterceptor(authenticator auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		authCtx, err := authorize(ss.Context(), authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: authCtx})
+	}
+}
+
+// AuthServerOptions returns the server options installing both interceptors.
+func AuthServerOptions(authenticator auth.Authenticator) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryAuthInterceptor(authenticator)),
+		grpc.ChainStreamInterceptor(StreamAuthInterceptor(authenticator)),
+	}
+}
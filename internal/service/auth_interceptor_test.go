@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// identityRecorder is a fake MCRunner server recording the identity each
+// RPC was called with.
+type identityRecorder struct {
+	pb.UnimplementedMCRunnerServer
+	mu    sync.Mutex
+	calls map[string]string
+}
+
+func (r *identityRecorder) record(ctx context.Context, method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if identity, ok := auth.FromContext(ctx); ok {
+		r.calls[method] = identity.Name
+	} else {
+		r.calls[method] = ""
+	}
+}
+
+func (r *identityRecorder) identityOf(method string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name, ok := r.calls[method]
+	return name, ok
+}
+
+func (r *identityRecorder) StartServer(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_StartServer_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) StopServer(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_StopServer_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) KillServer(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_KillServer_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) RestartServer(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_RestartServer_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) GetState(ctx context.Context, _ *emptypb.Empty) (*pb.ServerState, error) {
+	r.record(ctx, pb.MCRunner_GetState_FullMethodName)
+	return &pb.ServerState{}, nil
+}
+
+func (r *identityRecorder) SendCommand(ctx context.Context, _ *pb.CommandRequest) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_SendCommand_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) ResizeConsole(ctx context.Context, _ *pb.PtyResize) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_ResizeConsole_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *identityRecorder) StreamConsole(stream grpc.BidiStreamingServer[pb.ConsoleMessage, pb.ConsoleMessage]) error {
+	r.record(stream.Context(), pb.MCRunner_StreamConsole_FullMethodName)
+	return stream.Send(NewPtyBufferMessage([]byte("hello")))
+}
+
+func (r *identityRecorder) StreamState(_ *emptypb.Empty, stream grpc.ServerStreamingServer[pb.ServerState]) error {
+	r.record(stream.Context(), pb.MCRunner_StreamState_FullMethodName)
+	return stream.Send(&pb.ServerState{})
+}
+
+func (r *identityRecorder) WatchConsole(_ *emptypb.Empty, stream grpc.ServerStreamingServer[pb.ConsoleMessage]) error {
+	r.record(stream.Context(), pb.MCRunner_WatchConsole_FullMethodName)
+	return stream.Send(NewPtyBufferMessage([]byte("hello")))
+}
+
+func (r *identityRecorder) WriteConsole(ctx context.Context, _ *pb.ConsoleMessage) (*emptypb.Empty, error) {
+	r.record(ctx, pb.MCRunner_WriteConsole_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+// filesRecorder is a fake Files server recording into the calls of the
+// MCRunner recorder.
+type filesRecorder struct {
+	pb.UnimplementedFilesServer
+	*identityRecorder
+}
+
+func (r *filesRecorder) Stat(ctx context.Context, _ *pb.FilePath) (*pb.FileInfo, error) {
+	r.record(ctx, pb.Files_Stat_FullMethodName)
+	return &pb.FileInfo{}, nil
+}
+
+func (r *filesRecorder) List(ctx context.Context, _ *pb.FilePath) (*pb.FileList, error) {
+	r.record(ctx, pb.Files_List_FullMethodName)
+	return &pb.FileList{}, nil
+}
+
+func (r *filesRecorder) Mkdir(ctx context.Context, _ *pb.FilePath) (*emptypb.Empty, error) {
+	r.record(ctx, pb.Files_Mkdir_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *filesRecorder) Rename(ctx context.Context, _ *pb.RenameRequest) (*emptypb.Empty, error) {
+	r.record(ctx, pb.Files_Rename_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *filesRecorder) Delete(ctx context.Context, _ *pb.DeleteRequest) (*emptypb.Empty, error) {
+	r.record(ctx, pb.Files_Delete_FullMethodName)
+	return &emptypb.Empty{}, nil
+}
+
+func (r *filesRecorder) Upload(stream grpc.ClientStreamingServer[pb.UploadRequest, pb.UploadResponse]) error {
+	r.record(stream.Context(), pb.Files_Upload_FullMethodName)
+	return stream.SendAndClose(&pb.UploadResponse{})
+}
+
+func (r *filesRecorder) Download(_ *pb.DownloadRequest, stream grpc.ServerStreamingServer[pb.DownloadResponse]) error {
+	r.record(stream.Context(), pb.Files_Download_FullMethodName)
+	return stream.Send(&pb.DownloadResponse{})
+}
+
+func (r *filesRecorder) Watch(_ *pb.FilePath, stream grpc.ServerStreamingServer[pb.FileEvent]) error {
+	r.record(stream.Context(), pb.Files_Watch_FullMethodName)
+	return stream.Send(&pb.FileEvent{})
+}
+
+// playersRecorder is a fake Players server recording into the calls of the
+// MCRunner recorder.
+type playersRecorder struct {
+	pb.UnimplementedPlayersServer
+	*identityRecorder
+}
+
+func (r *playersRecorder) List(ctx context.Context, _ *pb.PlayerListRequest) (*pb.PlayerEntries, error) {
+	r.record(ctx, pb.Players_List_FullMethodName)
+	return &pb.PlayerEntries{}, nil
+}
+
+func (r *playersRecorder) Add(ctx context.Context, _ *pb.AddPlayerRequest) (*pb.PlayerChange, error) {
+	r.record(ctx, pb.Players_Add_FullMethodName)
+	return &pb.PlayerChange{}, nil
+}
+
+func (r *playersRecorder) Remove(ctx context.Context, _ *pb.RemovePlayerRequest) (*pb.PlayerChange, error) {
+	r.record(ctx, pb.Players_Remove_FullMethodName)
+	return &pb.PlayerChange{}, nil
+}
+
+// testClients are the clients of the services served by the test server.
+type testClients struct {
+	runner  pb.MCRunnerClient
+	files   pb.FilesClient
+	players pb.PlayersClient
+}
+
+// rpcCalls invokes every RPC of the MCRunner, Files and Players services.
+// Streaming calls read the first message so that interceptor errors are
+// surfaced.
+var rpcCalls = map[string]func(ctx context.Context, cl *testClients) error{
+	pb.MCRunner_StartServer_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.StartServer(ctx, &emptypb.Empty{})
+		return err
+	},
+	pb.MCRunner_StopServer_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.StopServer(ctx, &emptypb.Empty{})
+		return err
+	},
+	pb.MCRunner_KillServer_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.KillServer(ctx, &emptypb.Empty{})
+		return err
+	},
+	pb.MCRunner_RestartServer_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.RestartServer(ctx, &emptypb.Empty{})
+		return err
+	},
+	pb.MCRunner_GetState_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.GetState(ctx, &emptypb.Empty{})
+		return err
+	},
+	pb.MCRunner_SendCommand_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.SendCommand(ctx, &pb.CommandRequest{Command: "list"})
+		return err
+	},
+	pb.MCRunner_ResizeConsole_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.ResizeConsole(ctx, &pb.PtyResize{Rows: 24, Cols: 80})
+		return err
+	},
+	pb.MCRunner_StreamConsole_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.runner.StreamConsole(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	},
+	pb.MCRunner_StreamState_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.runner.StreamState(ctx, &emptypb.Empty{})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	},
+	pb.MCRunner_WatchConsole_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.runner.WatchConsole(ctx, &emptypb.Empty{})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	},
+	pb.MCRunner_WriteConsole_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.runner.WriteConsole(ctx, NewPtyBufferMessage([]byte("list\n")))
+		return err
+	},
+	pb.Files_Stat_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.files.Stat(ctx, &pb.FilePath{Path: "server.properties"})
+		return err
+	},
+	pb.Files_List_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.files.List(ctx, &pb.FilePath{Path: "."})
+		return err
+	},
+	pb.Files_Mkdir_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.files.Mkdir(ctx, &pb.FilePath{Path: "plugins"})
+		return err
+	},
+	pb.Files_Rename_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.files.Rename(ctx, &pb.RenameRequest{Path: "a.txt", NewPath: "b.txt"})
+		return err
+	},
+	pb.Files_Delete_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.files.Delete(ctx, &pb.DeleteRequest{Path: "a.txt"})
+		return err
+	},
+	pb.Files_Upload_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.files.Upload(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	},
+	pb.Files_Download_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.files.Download(ctx, &pb.DownloadRequest{Path: "server.properties"})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	},
+	pb.Files_Watch_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		stream, err := cl.files.Watch(ctx, &pb.FilePath{Path: "."})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	},
+	pb.Players_List_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.players.List(ctx, &pb.PlayerListRequest{List: pb.PlayerList_PLAYER_LIST_WHITELIST})
+		return err
+	},
+	pb.Players_Add_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.players.Add(ctx, &pb.AddPlayerRequest{List: pb.PlayerList_PLAYER_LIST_WHITELIST, Entry: &pb.PlayerEntry{Name: "Steve"}})
+		return err
+	},
+	pb.Players_Remove_FullMethodName: func(ctx context.Context, cl *testClients) error {
+		_, err := cl.players.Remove(ctx, &pb.RemovePlayerRequest{List: pb.PlayerList_PLAYER_LIST_WHITELIST, Player: "Steve"})
+		return err
+	},
+}
+
+func startAuthTestServer(t *testing.T, authenticator auth.Authenticator) (*testClients, *identityRecorder) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(AuthServerOptions(authenticator)...)
+	recorder := &identityRecorder{calls: make(map[string]string)}
+	pb.RegisterMCRunnerServer(srv, recorder)
+	pb.RegisterFilesServer(srv, &filesRecorder{identityRecorder: recorder})
+	pb.RegisterPlayersServer(srv, &playersRecorder{identityRecorder: recorder})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClients{
+		runner:  pb.NewMCRunnerClient(conn),
+		files:   pb.NewFilesClient(conn),
+		players: pb.NewPlayersClient(conn),
+	}, recorder
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestAuthInterceptorsCoverAllRPCs(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{pb.MCRunner_ServiceDesc, pb.Files_ServiceDesc, pb.Players_ServiceDesc} {
+		for _, method := range desc.Methods {
+			name := "/" + desc.ServiceName + "/" + method.MethodName
+			if _, ok := rpcCalls[name]; !ok {
+				t.Errorf("no test call for unary RPC %s", name)
+			}
+			if _, ok := methodScopes[name]; !ok {
+				t.Errorf("no scope mapped for unary RPC %s", name)
+			}
+		}
+		for _, stream := range desc.Streams {
+			name := "/" + desc.ServiceName + "/" + stream.StreamName
+			if _, ok := rpcCalls[name]; !ok {
+				t.Errorf("no test call for streaming RPC %s", name)
+			}
+			if _, ok := methodScopes[name]; !ok {
+				t.Errorf("no scope mapped for streaming RPC %s", name)
+			}
+		}
+	}
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	store, err := auth.LoadTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const secret = "legacy-secret"
+	client, recorder := startAuthTestServer(t, auth.MultiAuthenticator{store, auth.NewSecretAuthenticator(secret)})
+
+	for method, call := range rpcCalls {
+		scope := requiredScope(method)
+		granted, _, err := store.Create("granted", []auth.Scope{scope}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := auth.ScopeStateRead
+		if scope == auth.ScopeStateRead {
+			other = auth.ScopeFilesRead
+		}
+		denied, _, err := store.Create("denied", []auth.Scope{other}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(method, func(t *testing.T) {
+			cases := []struct {
+				name string
+				ctx  context.Context
+				code codes.Code
+			}{
+				{"missing", context.Background(), codes.Unauthenticated},
+				{"invalid", withToken("not-a-token"), codes.Unauthenticated},
+				{"forged", withToken(granted + "x"), codes.Unauthenticated},
+				{"wrong scope", withToken(denied), codes.PermissionDenied},
+				{"valid token", withToken(granted), codes.OK},
+				{"valid secret", withToken(secret), codes.OK},
+			}
+			for _, tc := range cases {
+				err := call(tc.ctx, client)
+				if got := status.Code(err); got != tc.code {
+					t.Errorf("%s: got code %v, want %v (err: %v)", tc.name, got, tc.code, err)
+				}
+			}
+			if name, ok := recorder.identityOf(method); !ok || name != "secret" {
+				t.Errorf("identity not propagated: got %q", name)
+			}
+		})
+	}
+}
+
+func TestAuthInterceptorsDisabled(t *testing.T) {
+	client, recorder := startAuthTestServer(t, nil)
+	for method, call := range rpcCalls {
+		if err := call(context.Background(), client); err != nil {
+			t.Errorf("%s: unexpected error %v", method, err)
+		}
+		if name, _ := recorder.identityOf(method); name != auth.AnonymousIdentity.Name {
+			t.Errorf("%s: got identity %q, want %q", method, name, auth.AnonymousIdentity.Name)
+		}
+	}
+}
+
+func TestAuthInterceptorsExpiredToken(t *testing.T) {
+	store, err := auth.LoadTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	token, _, err := store.Create("expired", []auth.Scope{auth.ScopeAdmin}, nil, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := startAuthTestServer(t, store)
+	for method, call := range rpcCalls {
+		err := call(withToken(token), client)
+		if got := status.Code(err); got != codes.Unauthenticated {
+			t.Errorf("%s: got code %v, want %v", method, got, codes.Unauthenticated)
+		}
+	}
+}
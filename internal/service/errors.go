@@ -2,9 +2,13 @@ package service
 
 import (
 	"errors"
+	"io/fs"
 
+	"github.com/khanghh/mcrunner/internal/file"
 	"github.com/khanghh/mcrunner/internal/mccmd"
 	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func mapMCCmdError(err error) *pb.ConsoleMessage {
@@ -27,3 +31,49 @@ func newPtyErrorMessage(code string, message string) *pb.ConsoleMessage {
 		},
 	}
 }
+
+// mapFileError converts a file service error to a gRPC status error. Status
+// errors, e.g. from an upload stream, are returned unchanged.
+func mapFileError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, file.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return status.Errorf(codes.NotFound, "File not found")
+	case errors.Is(err, file.ErrAlreadyExists), errors.Is(err, fs.ErrExist):
+		return status.Errorf(codes.AlreadyExists, "File already exists")
+	case errors.Is(err, file.ErrDirNotEmpty):
+		return status.Errorf(codes.FailedPrecondition, "Directory is not empty")
+	case errors.Is(err, file.ErrIsDirectory):
+		return status.Errorf(codes.FailedPrecondition, "Path is a directory")
+	case errors.Is(err, file.ErrNotDirectory):
+		return status.Errorf(codes.FailedPrecondition, "Path is not a directory")
+	case errors.Is(err, file.ErrPathTraversal), errors.Is(err, file.ErrMissingNewName):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, file.ErrSymlinkNotAllowed):
+		return status.Errorf(codes.PermissionDenied, "Symbolic link cannot be followed")
+	case errors.Is(err, file.ErrReservedPath):
+		return status.Errorf(codes.PermissionDenied, "Path is reserved")
+	case errors.Is(err, file.ErrAccessDenied):
+		return status.Errorf(codes.PermissionDenied, "Access denied by path rules")
+	case errors.Is(err, file.ErrPathNotAllowed):
+		return status.Errorf(codes.PermissionDenied, "Path is outside of the allowed paths")
+	case errors.Is(err, file.ErrReadOnlyWhileRunning):
+		return status.Errorf(codes.PermissionDenied, "Path is read-only while the server is running")
+	case errors.Is(err, file.ErrReadOnlyMount):
+		return status.Errorf(codes.PermissionDenied, "Path is in a read-only mount")
+	case errors.Is(err, file.ErrReadOnlyPath):
+		return status.Errorf(codes.PermissionDenied, "Path is read-only")
+	case errors.Is(err, file.ErrPreconditionFailed):
+		return status.Errorf(codes.FailedPrecondition, "File has changed")
+	case errors.Is(err, file.ErrQuotaExceeded):
+		return status.Errorf(codes.ResourceExhausted, "%v", err)
+	case errors.Is(err, file.ErrMountPoint):
+		return status.Errorf(codes.FailedPrecondition, "Path is or contains a mount point")
+	case errors.Is(err, fs.ErrPermission):
+		return status.Errorf(codes.PermissionDenied, "No permissions")
+	default:
+		return status.Errorf(codes.Internal, "File operation failed: %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fileChunkSize is the size of the content chunks sent by Download, well
+// below the default 4 MiB gRPC message limit.
+const fileChunkSize = 64 << 10
+
+// FilesService exposes the file manager over gRPC, backed by the same
+// LocalFileService as the REST API.
+type FilesService struct {
+	pb.UnimplementedFilesServer
+	files   *file.LocalFileService
+	watcher *file.Watcher
+}
+
+func fileTypeOf(fi os.FileInfo) pb.FileType {
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return pb.FileType_FILE_TYPE_SYMLINK
+	case fi.IsDir():
+		return pb.FileType_FILE_TYPE_DIRECTORY
+	default:
+		return pb.FileType_FILE_TYPE_FILE
+	}
+}
+
+// filesFor returns the file service as seen by the caller, which applies the
+// path rules for its identity.
+func (s *FilesService) filesFor(ctx context.Context) *file.LocalFileService {
+	identity, _ := auth.FromContext(ctx)
+	return s.files.As(identity)
+}
+
+func newFileInfo(files *file.LocalFileService, rel string, fi os.FileInfo) *pb.FileInfo {
+	info := &pb.FileInfo{
+		Name:         fi.Name(),
+		Path:         strings.TrimPrefix(path.Clean("/"+rel), "/"),
+		Type:         fileTypeOf(fi),
+		Size:         fi.Size(),
+		Mode:         uint32(fi.Mode().Perm()),
+		LastModified: timestamppb.New(fi.ModTime()),
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		info.Target, _ = files.Readlink(rel)
+	}
+	return info
+}
+
+// ifMatch calls fn, under the precondition that the etag of the file at rel
+// is still ifMatch when it is set.
+func ifMatch(files *file.LocalFileService, rel, ifMatch string, fn func() error) error {
+	if ifMatch == "" {
+		return fn()
+	}
+	return files.IfMatch(rel, []string{ifMatch}, fn)
+}
+
+func (s *FilesService) Stat(ctx context.Context, req *pb.FilePath) (*pb.FileInfo, error) {
+	files := s.filesFor(ctx)
+	fi, err := files.Stat(req.Path)
+	if err != nil {
+		return nil, mapFileError(err)
+	}
+	info := newFileInfo(files, req.Path, fi)
+	if fi.Mode().IsRegular() {
+		info.Etag, _ = files.ETag(req.Path)
+	}
+	return info, nil
+}
+
+func (s *FilesService) List(ctx context.Context, req *pb.FilePath) (*pb.FileList, error) {
+	files := s.filesFor(ctx)
+	items, err := files.List(req.Path)
+	if err != nil {
+		return nil, mapFileError(err)
+	}
+	entries := make([]*pb.FileInfo, 0, len(items))
+	for _, fi := range items {
+		rel := path.Join(req.Path, fi.Name())
+		entries = append(entries, newFileInfo(files, rel, fi))
+	}
+	return &pb.FileList{Entries: entries}, nil
+}
+
+func (s *FilesService) Mkdir(ctx context.Context, req *pb.FilePath) (*emptypb.Empty, error) {
+	files := s.filesFor(ctx)
+	if _, err := files.Stat(req.Path); err == nil {
+		return nil, mapFileError(file.ErrAlreadyExists)
+	}
+	if err := files.MkdirAll(req.Path); err != nil {
+		return nil, mapFileError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *FilesService) Rename(ctx context.Context, req *pb.RenameRequest) (*emptypb.Empty, error) {
+	if strings.TrimSpace(req.NewPath) == "" {
+		return nil, mapFileError(file.ErrMissingNewName)
+	}
+	files := s.filesFor(ctx)
+	err := ifMatch(files, req.Path, req.IfMatch, func() error {
+		return files.Rename(req.Path, req.NewPath, req.Overwrite)
+	})
+	if err != nil {
+		return nil, mapFileError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *FilesService) Delete(ctx context.Context, req *pb.DeleteRequest) (*emptypb.Empty, error) {
+	files := s.filesFor(ctx)
+	err := ifMatch(files, req.Path, req.IfMatch, func() error {
+		if req.Recursive {
+			return files.DeleteRecursive(req.Path)
+		}
+		return files.Delete(req.Path)
+	})
+	if err != nil {
+		return nil, mapFileError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// uploadReader reads the content chunks of an upload stream. It fails at the
+// end of the stream when the client checksum does not match the content, so
+// that SaveStream discards the partial file.
+type uploadReader struct {
+	stream   grpc.ClientStreamingServer[pb.UploadRequest, pb.UploadResponse]
+	hash     hash.Hash
+	pending  []byte
+	checksum string
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		req, err := r.stream.Recv()
+		if err == io.EOF {
+			if r.checksum != "" && !strings.EqualFold(r.checksum, r.sum()) {
+				return 0, status.Errorf(codes.DataLoss, "Checksum mismatch: expected %s, got %s", r.checksum, r.sum())
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch payload := req.Payload.(type) {
+		case *pb.UploadRequest_Chunk:
+			if r.checksum != "" {
+				return 0, status.Errorf(codes.InvalidArgument, "Unexpected chunk after checksum")
+			}
+			r.hash.Write(payload.Chunk)
+			r.pending = payload.Chunk
+		case *pb.UploadRequest_Checksum:
+			r.checksum = payload.Checksum.Sha256
+		default:
+			return 0, status.Errorf(codes.InvalidArgument, "Unexpected upload payload")
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *uploadReader) sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+func (s *FilesService) Upload(stream grpc.ClientStreamingServer[pb.UploadRequest, pb.UploadResponse]) error {
+	req, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return status.Errorf(codes.InvalidArgument, "Missing upload header")
+		}
+		return err
+	}
+	header := req.GetHeader()
+	if header == nil || strings.TrimSpace(header.Path) == "" {
+		return status.Errorf(codes.InvalidArgument, "Missing upload header")
+	}
+
+	reader := &uploadReader{stream: stream, hash: sha256.New()}
+	overwrite := header.Overwrite || header.IfMatch != ""
+	files := s.filesFor(stream.Context())
+	err = ifMatch(files, header.Path, header.IfMatch, func() error {
+		return files.SaveStream(header.Path, reader, overwrite)
+	})
+	if err != nil {
+		return mapFileError(err)
+	}
+	fi, err := files.Stat(header.Path)
+	if err != nil {
+		return mapFileError(err)
+	}
+	info := newFileInfo(files, header.Path, fi)
+	info.Etag, _ = files.ETag(header.Path)
+	return stream.SendAndClose(&pb.UploadResponse{
+		File:   info,
+		Sha256: reader.sum(),
+	})
+}
+
+func (s *FilesService) Download(req *pb.DownloadRequest, stream grpc.ServerStreamingServer[pb.DownloadResponse]) error {
+	files := s.filesFor(stream.Context())
+	f, fi, err := files.Open(req.Path)
+	if err != nil {
+		return mapFileError(err)
+	}
+	defer f.Close()
+
+	info := newFileInfo(files, req.Path, fi)
+	if info.Etag, err = files.FileETag(f, fi); err != nil {
+		return mapFileError(err)
+	}
+	if err := stream.Send(&pb.DownloadResponse{
+		Payload: &pb.DownloadResponse_File{File: info},
+	}); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			chunk := &pb.DownloadResponse{
+				Payload: &pb.DownloadResponse_Chunk{Chunk: buf[:n]},
+			}
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Failed to read file: %v", err)
+		}
+	}
+	return stream.Send(&pb.DownloadResponse{
+		Payload: &pb.DownloadResponse_Checksum{
+			Checksum: &pb.FileChecksum{Sha256: hex.EncodeToString(h.Sum(nil))},
+		},
+	})
+}
+
+var fileEventTypes = map[file.EventOp]pb.FileEventType{
+	file.EventCreate:   pb.FileEventType_FILE_EVENT_CREATE,
+	file.EventModify:   pb.FileEventType_FILE_EVENT_MODIFY,
+	file.EventDelete:   pb.FileEventType_FILE_EVENT_DELETE,
+	file.EventRename:   pb.FileEventType_FILE_EVENT_RENAME,
+	file.EventOverflow: pb.FileEventType_FILE_EVENT_OVERFLOW,
+}
+
+func (s *FilesService) Watch(req *pb.FilePath, stream grpc.ServerStreamingServer[pb.FileEvent]) error {
+	ctx := stream.Context()
+	identity, _ := auth.FromContext(ctx)
+	sub, err := s.watcher.Subscribe(req.Path, identity)
+	if err != nil {
+		if errors.Is(err, file.ErrWatcherClosed) {
+			return status.Errorf(codes.Unavailable, "File watcher closed")
+		}
+		return mapFileError(err)
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.Events():
+			if !ok {
+				return status.Errorf(codes.Unavailable, "File watcher closed")
+			}
+			err := stream.Send(&pb.FileEvent{
+				Type:  fileEventTypes[event.Op],
+				Path:  event.Path,
+				IsDir: event.IsDir,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func NewFilesService(files *file.LocalFileService, watcher *file.Watcher) *FilesService {
+	return &FilesService{files: files, watcher: watcher}
+}
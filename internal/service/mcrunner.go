@@ -8,9 +8,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/khanghh/mcrunner/internal/auth"
 	"github.com/khanghh/mcrunner/internal/mcagent"
 	"github.com/khanghh/mcrunner/internal/mccmd"
-	"github.com/khanghh/mcrunner/internal/sysmetrics"
+	"github.com/khanghh/mcrunner/internal/serverstate"
 	"github.com/khanghh/mcrunner/pkg/logger"
 	pb "github.com/khanghh/mcrunner/pkg/proto"
 	"google.golang.org/grpc"
@@ -23,6 +24,7 @@ type MCRunnerService struct {
 	pb.UnimplementedMCRunnerServer
 	mcserver    *mccmd.MCServerCmd
 	mcagent     *mcagent.MCAgentBridge
+	state       *serverstate.Builder
 	buffer      *ringBuffer
 	consoleSubs map[grpc.ServerStreamingServer[pb.ConsoleMessage]]struct{}
 	stateSubs   map[grpc.ServerStreamingServer[pb.ServerState]]struct{}
@@ -73,6 +75,20 @@ func (m *MCRunnerService) RestartServer(ctx context.Context, p1 *emptypb.Empty)
 	return &emptypb.Empty{}, nil
 }
 
+func (m *MCRunnerService) GetState(ctx context.Context, p1 *emptypb.Empty) (*pb.ServerState, error) {
+	return m.getServerState(), nil
+}
+
+func (m *MCRunnerService) ResizeConsole(ctx context.Context, size *pb.PtyResize) (*emptypb.Empty, error) {
+	if err := m.mcserver.ResizeWindow(int(size.Rows), int(size.Cols)); err != nil {
+		if errors.Is(err, mccmd.ErrNotRunning) {
+			return nil, status.Errorf(codes.Canceled, "Server is not running")
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to resize console: %v", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func (m *MCRunnerService) SendCommand(ctx context.Context, cmdReq *pb.CommandRequest) (*emptypb.Empty, error) {
 	if err := m.mcserver.SendCommand(cmdReq.Command); err != nil {
 		if errors.Is(err, mccmd.ErrNotRunning) {
@@ -96,6 +112,12 @@ func (m *MCRunnerService) StreamConsole(stream grpc.BidiStreamingServer[pb.Conso
 		m.mu.Unlock()
 	}()
 
+	// console input requires write access, output only needs read access
+	canWrite := true
+	if identity, ok := auth.FromContext(stream.Context()); ok {
+		canWrite = identity.HasScope(auth.ScopeConsoleWrite)
+	}
+
 	// read console input
 	for {
 		select {
@@ -112,6 +134,13 @@ func (m *MCRunnerService) StreamConsole(stream grpc.BidiStreamingServer[pb.Conso
 			return err
 		}
 
+		if !canWrite {
+			if err := stream.Send(newPtyErrorMessage("PERMISSION_DENIED", "missing scope "+string(auth.ScopeConsoleWrite))); err != nil {
+				return status.Errorf(codes.Unavailable, "Stream closed")
+			}
+			continue
+		}
+
 		switch payload := msg.Payload.(type) {
 		case *pb.ConsoleMessage_PtyBuffer:
 			if _, err := m.mcserver.Write(payload.PtyBuffer.Data); err != nil {
@@ -152,14 +181,47 @@ func (m *MCRunnerService) StreamState(p0 *emptypb.Empty, stream grpc.ServerStrea
 	return stream.Context().Err()
 }
 
-func (m *MCRunnerService) broadcastConsoleLoop() {
-	broadcastCh := make(chan *pb.ConsoleMessage, 1)
-	m.mcserver.OnStatusChanged(func(status mccmd.Status) {
-		if status == mccmd.StatusRunning {
-			m.mcagent.Reload()
+func (m *MCRunnerService) WatchConsole(p0 *emptypb.Empty, stream grpc.ServerStreamingServer[pb.ConsoleMessage]) error {
+	// add output subscriber
+	m.mu.Lock()
+	m.consoleSubs[stream] = struct{}{}
+	m.mu.Unlock()
+
+	// remove subscriber on exit
+	defer func() {
+		m.mu.Lock()
+		delete(m.consoleSubs, stream)
+		m.mu.Unlock()
+	}()
+
+	select {
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	case <-m.done:
+		return nil
+	}
+}
+
+func (m *MCRunnerService) WriteConsole(ctx context.Context, msg *pb.ConsoleMessage) (*emptypb.Empty, error) {
+	var err error
+	switch payload := msg.Payload.(type) {
+	case *pb.ConsoleMessage_PtyBuffer:
+		_, err = m.mcserver.Write(payload.PtyBuffer.Data)
+	case *pb.ConsoleMessage_PtyResize:
+		err = m.mcserver.ResizeWindow(int(payload.PtyResize.Rows), int(payload.PtyResize.Cols))
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown payload type")
+	}
+	if err != nil {
+		if errors.Is(err, mccmd.ErrNotRunning) {
+			return nil, status.Errorf(codes.Canceled, "Server is not running")
 		}
-		broadcastCh <- NewPtyStatusMessage(status)
-	})
+		return nil, status.Errorf(codes.Internal, "Failed to write console input: %v", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (m *MCRunnerService) broadcastConsoleLoop(broadcastCh chan *pb.ConsoleMessage) {
 	go func() {
 		stream := m.mcserver.OutputStream()
 		buf := make([]byte, 4096)
@@ -196,41 +258,8 @@ func (m *MCRunnerService) broadcastConsoleLoop() {
 	}
 }
 
-func (h *MCRunnerService) getServerState() *pb.ServerState {
-	status := h.mcserver.GetStatus()
-	var statusCode pb.Status
-	switch status {
-	case mccmd.StatusRunning:
-		statusCode = pb.Status_STATUS_RUNNING
-	case mccmd.StatusStopping:
-		statusCode = pb.Status_STATUS_STOPPING
-	case mccmd.StatusStopped:
-		statusCode = pb.Status_STATUS_STOPPED
-	default:
-		statusCode = pb.Status_STATUS_UNKNOWN
-	}
-	serverState := &pb.ServerState{
-		Status: statusCode,
-	}
-
-	usage := sysmetrics.GetResourceUsage()
-	serverState.MemoryUsage = usage.MemoryUsage
-	serverState.MemoryLimit = usage.MemoryLimit
-	serverState.CpuUsage = usage.CPUUsage
-	serverState.CpuLimit = usage.CPULimit
-	serverState.DiskUsage = usage.DiskUsage
-	serverState.DiskSize = usage.DiskSize
-
-	process := h.mcserver.GetProcess()
-	if process == nil {
-		return serverState
-	}
-	serverState.Pid = int32(process.Pid)
-
-	if startTime := h.mcserver.GetStartTime(); startTime != nil {
-		serverState.UptimeSec = uint64(time.Since(*startTime).Seconds())
-	}
-	return serverState
+func (m *MCRunnerService) getServerState() *pb.ServerState {
+	return NewServerStateMessage(m.state.Build())
 }
 
 func (m *MCRunnerService) broadcastStateLoop() {
@@ -239,8 +268,9 @@ func (m *MCRunnerService) broadcastStateLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			m.mu.Lock()
+			// build outside the lock, querying the agent plugin may take a while
 			state := m.getServerState()
+			m.mu.Lock()
 			for stream := range m.stateSubs {
 				if err := stream.Send(state); err != nil {
 					logger.Errorln("Failed to send server state message", "error", err)
@@ -256,12 +286,23 @@ func (m *MCRunnerService) broadcastStateLoop() {
 func NewMCRunnerService(mcserver *mccmd.MCServerCmd, mcagent *mcagent.MCAgentBridge) *MCRunnerService {
 	svc := &MCRunnerService{
 		mcserver:    mcserver,
+		mcagent:     mcagent,
+		state:       serverstate.NewBuilder(mcserver, mcagent),
 		buffer:      newRingBuffer(1 << 20), // 1 MiB buffer
 		consoleSubs: make(map[grpc.ServerStreamingServer[pb.ConsoleMessage]]struct{}),
 		stateSubs:   make(map[grpc.ServerStreamingServer[pb.ServerState]]struct{}),
 		done:        make(chan struct{}),
 	}
-	go svc.broadcastConsoleLoop()
+	// register the status listener before returning so a server started
+	// right after construction is never missed
+	broadcastCh := make(chan *pb.ConsoleMessage, 1)
+	mcserver.OnStatusChanged(func(status mccmd.Status) {
+		if status == mccmd.StatusRunning {
+			svc.mcagent.Reload()
+		}
+		broadcastCh <- NewPtyStatusMessage(status)
+	})
+	go svc.broadcastConsoleLoop(broadcastCh)
 	go svc.broadcastStateLoop()
 	return svc
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/serverstate"
 	"github.com/khanghh/mcrunner/pkg/proto"
 )
 
@@ -36,36 +37,50 @@ func NewPtyBufferMessage(output []byte) *proto.ConsoleMessage {
 	}
 }
 
-func NewPtyStatusMessage(status mccmd.Status) *proto.ConsoleMessage {
-	var pbStatus proto.Status
+func toProtoStatus(status mccmd.Status) proto.Status {
 	switch status {
 	case mccmd.StatusRunning:
-		pbStatus = proto.Status_STATUS_RUNNING
+		return proto.Status_STATUS_RUNNING
 	case mccmd.StatusStopping:
-		pbStatus = proto.Status_STATUS_STOPPING
+		return proto.Status_STATUS_STOPPING
 	case mccmd.StatusStopped:
-		pbStatus = proto.Status_STATUS_STOPPED
+		return proto.Status_STATUS_STOPPED
 	default:
-		pbStatus = proto.Status_STATUS_UNKNOWN
+		return proto.Status_STATUS_UNKNOWN
 	}
+}
+
+func NewPtyStatusMessage(status mccmd.Status) *proto.ConsoleMessage {
 	return &proto.ConsoleMessage{
 		Payload: &proto.ConsoleMessage_PtyStatus{
 			PtyStatus: &proto.PtyStatus{
-				Status: pbStatus,
+				Status: toProtoStatus(status),
 			},
 		},
 	}
 }
 
-func NewServerStateMessage(state *proto.ServerState) *proto.ServerState {
-	return &proto.ServerState{
-		Status:      state.Status,
-		Tps:         state.Tps,
-		Pid:         state.Pid,
-		MemoryUsage: state.MemoryUsage,
-		MemoryLimit: state.MemoryLimit,
-		CpuUsage:    state.CpuUsage,
-		CpuLimit:    state.CpuLimit,
+func NewServerStateMessage(state *serverstate.State) *proto.ServerState {
+	msg := &proto.ServerState{
+		Status:      toProtoStatus(state.Status),
+		Pid:         int32(state.PID),
+		IpAddress:   state.IPAddress,
+		Tps:         state.TPS(),
 		UptimeSec:   state.UptimeSec,
+		MemoryUsage: state.Usage.MemoryUsage,
+		MemoryLimit: state.Usage.MemoryLimit,
+		CpuUsage:    state.Usage.CPUUsage,
+		CpuLimit:    state.Usage.CPULimit,
+		DiskUsage:   state.Usage.DiskUsage,
+		DiskSize:    state.Usage.DiskSize,
+		DataUsage:   state.Usage.DataUsage,
+		DataQuota:   state.Usage.DataQuota,
+	}
+	if state.Server != nil {
+		msg.ServerName = state.Server.Name
+		msg.ServerVersion = state.Server.Version
+		msg.PlayersOnline = int32(state.Server.PlayersOnline)
+		msg.PlayersMax = int32(state.Server.PlayersMax)
 	}
+	return msg
 }
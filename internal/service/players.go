@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/mcplayers"
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PlayersService exposes the whitelist, operator and ban lists over gRPC,
+// backed by the same manager as the REST API.
+type PlayersService struct {
+	pb.UnimplementedPlayersServer
+	players *mcplayers.Manager
+}
+
+var playerLists = map[pb.PlayerList]mcplayers.List{
+	pb.PlayerList_PLAYER_LIST_WHITELIST:      mcplayers.Whitelist,
+	pb.PlayerList_PLAYER_LIST_OPS:            mcplayers.Ops,
+	pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS: mcplayers.BannedPlayers,
+	pb.PlayerList_PLAYER_LIST_BANNED_IPS:     mcplayers.BannedIPs,
+}
+
+func playerList(list pb.PlayerList) (mcplayers.List, error) {
+	if l, ok := playerLists[list]; ok {
+		return l, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "Unknown list %v", list)
+}
+
+func mapPlayersError(err error) error {
+	switch {
+	case errors.Is(err, mcplayers.ErrEntryNotFound):
+		return status.Errorf(codes.NotFound, "Entry not found")
+	case errors.Is(err, mcplayers.ErrNoPermissions):
+		return status.Errorf(codes.PermissionDenied, "No permissions for the list file")
+	case errors.Is(err, mcplayers.ErrInvalidEntry), errors.Is(err, mcplayers.ErrUnknownPlayer):
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	case errors.Is(err, mcplayers.ErrInvalidFile), errors.Is(err, mcplayers.ErrServerRunning):
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	case errors.Is(err, mccmd.ErrNotRunning):
+		return status.Errorf(codes.FailedPrecondition, "Server is not running")
+	}
+	return mapFileError(err)
+}
+
+func newPlayerEntry(e mcplayers.Entry) *pb.PlayerEntry {
+	return &pb.PlayerEntry{
+		Uuid:                e.UUID,
+		Name:                e.Name,
+		Ip:                  e.IP,
+		Level:               int32(e.Level),
+		BypassesPlayerLimit: e.BypassesPlayerLimit,
+		Created:             e.Created,
+		Source:              e.Source,
+		Expires:             e.Expires,
+		Reason:              e.Reason,
+	}
+}
+
+func newPlayerChange(change *mcplayers.Change) *pb.PlayerChange {
+	return &pb.PlayerChange{
+		Entry:   newPlayerEntry(change.Entry),
+		Console: change.Console,
+	}
+}
+
+func (s *PlayersService) List(ctx context.Context, req *pb.PlayerListRequest) (*pb.PlayerEntries, error) {
+	list, err := playerList(req.List)
+	if err != nil {
+		return nil, err
+	}
+	identity, _ := auth.FromContext(ctx)
+	items, err := s.players.Entries(list, identity)
+	if err != nil {
+		return nil, mapPlayersError(err)
+	}
+	entries := make([]*pb.PlayerEntry, 0, len(items))
+	for _, e := range items {
+		entries = append(entries, newPlayerEntry(e))
+	}
+	return &pb.PlayerEntries{Entries: entries}, nil
+}
+
+func (s *PlayersService) Add(ctx context.Context, req *pb.AddPlayerRequest) (*pb.PlayerChange, error) {
+	list, err := playerList(req.List)
+	if err != nil {
+		return nil, err
+	}
+	if req.Entry == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing entry")
+	}
+	entry := mcplayers.Entry{
+		UUID:                req.Entry.Uuid,
+		Name:                req.Entry.Name,
+		IP:                  req.Entry.Ip,
+		Level:               int(req.Entry.Level),
+		BypassesPlayerLimit: req.Entry.BypassesPlayerLimit,
+		Expires:             req.Entry.Expires,
+		Reason:              req.Entry.Reason,
+	}
+	identity, _ := auth.FromContext(ctx)
+	change, err := s.players.Add(list, entry, identity)
+	if err != nil {
+		return nil, mapPlayersError(err)
+	}
+	return newPlayerChange(change), nil
+}
+
+func (s *PlayersService) Remove(ctx context.Context, req *pb.RemovePlayerRequest) (*pb.PlayerChange, error) {
+	list, err := playerList(req.List)
+	if err != nil {
+		return nil, err
+	}
+	if req.Player == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing player")
+	}
+	identity, _ := auth.FromContext(ctx)
+	change, err := s.players.Remove(list, req.Player, identity)
+	if err != nil {
+		return nil, mapPlayersError(err)
+	}
+	return newPlayerChange(change), nil
+}
+
+func NewPlayersService(players *mcplayers.Manager) *PlayersService {
+	return &PlayersService{players: players}
+}
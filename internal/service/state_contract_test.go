@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/khanghh/mcrunner/internal/handlers"
+	"github.com/khanghh/mcrunner/internal/mcagent"
+	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/pkg/api"
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var fakeServerInfo = mcagent.ServerInfo{
+	Name:          "Paper",
+	Version:       "1.21.4",
+	TPS:           []float64{19.5, 19.8, 20},
+	PlayersOnline: 3,
+	PlayersMax:    20,
+}
+
+// newFakeAgent starts a fake agent plugin serving fakeServerInfo and returns
+// a bridge with its config loaded.
+func newFakeAgent(t *testing.T) *mcagent.MCAgentBridge {
+	t.Helper()
+	plugin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(fakeServerInfo)
+	}))
+	t.Cleanup(plugin.Close)
+
+	_, port, err := net.SplitHostPort(plugin.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configFile, []byte(fmt.Sprintf("httpPort: %s\n", port)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bridge := mcagent.NewMCAgentBridge(configFile)
+	if err := bridge.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	return bridge
+}
+
+func getRESTState(t *testing.T, handler *handlers.MCRunnerHandler) *api.ServerState {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/api/mc/state", handler.GetState)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/mc/state", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/mc/state: status %d: %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Data *api.ServerState `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Data == nil {
+		t.Fatalf("GET /api/mc/state: missing data: %s", body)
+	}
+	return out.Data
+}
+
+func getGRPCState(t *testing.T, svc *MCRunnerService) *pb.ServerState {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterMCRunnerServer(srv, svc)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	state, err := pb.NewMCRunnerClient(conn).GetState(ctx, &emptypb.Empty{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+var protoStatuses = map[api.ServerStatus]pb.Status{
+	api.StatusRunning:  pb.Status_STATUS_RUNNING,
+	api.StatusStopping: pb.Status_STATUS_STOPPING,
+	api.StatusStopped:  pb.Status_STATUS_STOPPED,
+}
+
+// TestStateContract checks that the HTTP and gRPC APIs report equivalent
+// server state. Resource usage is sampled continuously, so only the limits
+// are compared exactly and the uptime may differ by a second.
+func TestStateContract(t *testing.T) {
+	bridge := newFakeAgent(t)
+	mcserver := mccmd.NewMCServerCmd("sleep", []string{"30"}, t.TempDir(), io.Discard)
+	svc := NewMCRunnerService(mcserver, bridge)
+	handler := handlers.NewMCRunnerHandler(mcserver, bridge)
+
+	t.Run("stopped", func(t *testing.T) {
+		rest, grpcState := getRESTState(t, handler), getGRPCState(t, svc)
+		if rest.Status != api.StatusStopped || grpcState.Status != pb.Status_STATUS_STOPPED {
+			t.Fatalf("status: rest %q, grpc %v", rest.Status, grpcState.Status)
+		}
+		if rest.PID != 0 || grpcState.Pid != 0 {
+			t.Errorf("pid: rest %d, grpc %d, want 0", rest.PID, grpcState.Pid)
+		}
+		if rest.Server != nil || grpcState.ServerName != "" || grpcState.Tps != 0 {
+			t.Errorf("server info reported while stopped: rest %+v, grpc %q tps %v", rest.Server, grpcState.ServerName, grpcState.Tps)
+		}
+	})
+
+	if err := mcserver.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mcserver.Kill() })
+
+	t.Run("running", func(t *testing.T) {
+		rest, grpcState := getRESTState(t, handler), getGRPCState(t, svc)
+		if rest.Status != api.StatusRunning || protoStatuses[rest.Status] != grpcState.Status {
+			t.Errorf("status: rest %q, grpc %v", rest.Status, grpcState.Status)
+		}
+		if rest.PID == 0 || int32(rest.PID) != grpcState.Pid {
+			t.Errorf("pid: rest %d, grpc %d", rest.PID, grpcState.Pid)
+		}
+		if rest.IPAddress != grpcState.IpAddress {
+			t.Errorf("ip address: rest %q, grpc %q", rest.IPAddress, grpcState.IpAddress)
+		}
+		if diff := int64(rest.UptimeSec) - int64(grpcState.UptimeSec); diff < -1 || diff > 1 {
+			t.Errorf("uptime: rest %d, grpc %d", rest.UptimeSec, grpcState.UptimeSec)
+		}
+		if rest.MemoryLimit == nil || *rest.MemoryLimit != grpcState.MemoryLimit {
+			t.Errorf("memory limit: rest %v, grpc %d", rest.MemoryLimit, grpcState.MemoryLimit)
+		}
+		if rest.CPULimit == nil || *rest.CPULimit != grpcState.CpuLimit {
+			t.Errorf("cpu limit: rest %v, grpc %v", rest.CPULimit, grpcState.CpuLimit)
+		}
+		if rest.DiskSize == nil || *rest.DiskSize != grpcState.DiskSize {
+			t.Errorf("disk size: rest %v, grpc %d", rest.DiskSize, grpcState.DiskSize)
+		}
+		if rest.DataQuota == nil || *rest.DataQuota != grpcState.DataQuota {
+			t.Errorf("data quota: rest %v, grpc %d", rest.DataQuota, grpcState.DataQuota)
+		}
+		if rest.MemoryUsage == nil || rest.CPUUsage == nil || rest.DiskUsage == nil || rest.DataUsage == nil {
+			t.Errorf("resource usage missing from rest state: %+v", rest)
+		}
+
+		if rest.Server == nil {
+			t.Fatal("rest state is missing the server info")
+		}
+		if rest.Server.Name != fakeServerInfo.Name || grpcState.ServerName != rest.Server.Name {
+			t.Errorf("server name: rest %q, grpc %q", rest.Server.Name, grpcState.ServerName)
+		}
+		if rest.Server.Version != fakeServerInfo.Version || grpcState.ServerVersion != rest.Server.Version {
+			t.Errorf("server version: rest %q, grpc %q", rest.Server.Version, grpcState.ServerVersion)
+		}
+		if len(rest.Server.TPS) == 0 || rest.Server.TPS[0] != grpcState.Tps || grpcState.Tps != fakeServerInfo.TPS[0] {
+			t.Errorf("tps: rest %v, grpc %v", rest.Server.TPS, grpcState.Tps)
+		}
+		if rest.Server.PlayersOnline != fakeServerInfo.PlayersOnline || int32(rest.Server.PlayersOnline) != grpcState.PlayersOnline {
+			t.Errorf("players online: rest %d, grpc %d", rest.Server.PlayersOnline, grpcState.PlayersOnline)
+		}
+		if rest.Server.PlayersMax != fakeServerInfo.PlayersMax || int32(rest.Server.PlayersMax) != grpcState.PlayersMax {
+			t.Errorf("players max: rest %d, grpc %d", rest.Server.PlayersMax, grpcState.PlayersMax)
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package sftpd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+)
+
+// sftpVersion is the protocol version served, version 3 as implemented by
+// OpenSSH and understood by every common client
+const sftpVersion = 3
+
+// request and response packet types
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpReadlink = 19
+	fxpSymlink  = 20
+	fxpExtended = 200
+
+	fxpStatus = 101
+	fxpHandle = 102
+	fxpData   = 103
+	fxpName   = 104
+	fxpAttrs  = 105
+)
+
+// status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// attribute flags
+const (
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+)
+
+// open flags
+const (
+	pflagRead   = 0x00000001
+	pflagWrite  = 0x00000002
+	pflagAppend = 0x00000004
+	pflagCreat  = 0x00000008
+	pflagTrunc  = 0x00000010
+	pflagExcl   = 0x00000020
+)
+
+// posixRename is the OpenSSH extension renaming over an existing file
+const posixRename = "posix-rename@openssh.com"
+
+// maxPacketSize bounds incoming packets. Clients send at most 256 KiB of data
+// per write, OpenSSH even less.
+const maxPacketSize = 1 << 20
+
+var errBadMessage = errors.New("bad message")
+
+// readPacket reads the next packet, returning its type and payload.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[:4])
+	if length < 1 || length > maxPacketSize {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[4], payload, nil
+}
+
+// decoder reads the fields of a request payload. Reading past the end sets
+// err and returns zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = errBadMessage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if n > uint32(len(d.buf)) {
+		d.err = errBadMessage
+		return nil
+	}
+	return d.next(int(n))
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// fileAttrs are the attributes sent with open and setstat requests, flags
+// tells which are set. Access times and extended attributes are dropped.
+type fileAttrs struct {
+	flags       uint32
+	size        uint64
+	uid, gid    uint32
+	permissions uint32
+	mtime       uint32
+}
+
+func (d *decoder) attrs() fileAttrs {
+	a := fileAttrs{flags: d.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = d.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid, a.gid = d.uint32(), d.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.permissions = d.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		d.uint32()
+		a.mtime = d.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.bytes()
+			d.bytes()
+		}
+	}
+	return a
+}
+
+// keeps reports whether the permissions and owner in a are those of fi, or
+// of a new file when fi is nil.
+func (a fileAttrs) keeps(fi fs.FileInfo) bool {
+	mode := uint32(0o644)
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+	if fi != nil {
+		mode = fileMode(fi.Mode())
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			uid, gid = st.Uid, st.Gid
+		}
+	}
+	if a.flags&attrPermissions != 0 && a.permissions&0o7777 != mode&0o7777 {
+		return false
+	}
+	return a.flags&attrUIDGID == 0 || a.uid == uid && a.gid == gid
+}
+
+// encoder builds a response packet, the length is filled in by packet.
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(typ byte) *encoder {
+	return &encoder{buf: []byte{0, 0, 0, 0, typ}}
+}
+
+func newResponse(typ byte, id uint32) *encoder {
+	return newEncoder(typ).uint32(id)
+}
+
+func (e *encoder) uint32(v uint32) *encoder {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+	return e
+}
+
+func (e *encoder) uint64(v uint64) *encoder {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+	return e
+}
+
+func (e *encoder) string(s string) *encoder {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+func (e *encoder) bytes(b []byte) *encoder {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+// attrs writes the attributes of fi, or none when fi is nil.
+func (e *encoder) attrs(fi fs.FileInfo) *encoder {
+	if fi == nil {
+		return e.uint32(0)
+	}
+	var uid, gid uint32
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		uid, gid = st.Uid, st.Gid
+	}
+	mtime := uint32(fi.ModTime().Unix())
+	e.uint32(attrSize | attrUIDGID | attrPermissions | attrACModTime)
+	e.uint64(uint64(fi.Size()))
+	e.uint32(uid).uint32(gid)
+	e.uint32(fileMode(fi.Mode()))
+	return e.uint32(mtime).uint32(mtime)
+}
+
+func (e *encoder) packet() []byte {
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	return e.buf
+}
+
+// fileMode converts a mode to the POSIX st_mode bits SFTP uses.
+func fileMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		m |= syscall.S_IFDIR
+	case mode&fs.ModeSymlink != 0:
+		m |= syscall.S_IFLNK
+	case mode&fs.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= syscall.S_IFSOCK
+	case mode&fs.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&fs.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	default:
+		m |= syscall.S_IFREG
+	}
+	if mode&fs.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
+
+// longName formats an entry like `ls -l`, which clients such as WinSCP and
+// FileZilla show as is.
+func longName(fi fs.FileInfo) string {
+	// Go's mode strings mark symlinks with L and list special bits as type
+	// letters, ls uses one type letter
+	mode := []byte(fi.Mode().Perm().String())
+	switch m := fi.Mode(); {
+	case m.IsDir():
+		mode[0] = 'd'
+	case m&fs.ModeSymlink != 0:
+		mode[0] = 'l'
+	case m&fs.ModeNamedPipe != 0:
+		mode[0] = 'p'
+	case m&fs.ModeSocket != 0:
+		mode[0] = 's'
+	case m&fs.ModeCharDevice != 0:
+		mode[0] = 'c'
+	case m&fs.ModeDevice != 0:
+		mode[0] = 'b'
+	}
+	var uid, gid uint32
+	nlink := uint64(1)
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		uid, gid, nlink = st.Uid, st.Gid, uint64(st.Nlink)
+	}
+	mtime := fi.ModTime()
+	layout := "Jan _2 15:04"
+	if time.Since(mtime) > 180*24*time.Hour || mtime.After(time.Now()) {
+		layout = "Jan _2  2006"
+	}
+	return fmt.Sprintf("%s %4d %-8d %-8d %8d %s %s",
+		mode, nlink, uid, gid, fi.Size(), mtime.Format(layout), fi.Name())
+}
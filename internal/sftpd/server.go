@@ -0,0 +1,252 @@
+// Package sftpd serves the file manager tree over SFTP, for clients such as
+// FileZilla and WinSCP that cannot use the HTTP file API.
+package sftpd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/pkg/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+const handshakeTimeout = 30 * time.Second
+
+// permission extensions recording how a connection logged in, the identity
+// is looked up again once the handshake is done
+const (
+	extToken = "mcrunner-token"
+	extKey   = "mcrunner-key"
+)
+
+var errNoFilesScope = errors.New("files:read scope required")
+
+// Server accepts SSH connections and serves the sftp subsystem. Clients log
+// in with an API token as password, or with a public key listed in the
+// authorized keys; the username is only logged. Every operation goes through
+// the file service as the logged in identity, with its scopes, paths and the
+// path rules applied. Tokens are checked again before every request, and
+// changes are logged as the audit trail of the session.
+type Server struct {
+	files          *file.LocalFileService
+	authenticator  auth.Authenticator
+	authorizedKeys map[string]*auth.Identity // by key fingerprint
+	config         *ssh.ServerConfig
+}
+
+func (s *Server) passwordCallback(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	identity, err := s.authenticator.Authenticate(string(password))
+	if err != nil {
+		return nil, err
+	}
+	if !identity.HasScope(auth.ScopeFilesRead) {
+		return nil, errNoFilesScope
+	}
+	return &ssh.Permissions{Extensions: map[string]string{extToken: string(password)}}, nil
+}
+
+func (s *Server) publicKeyCallback(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+	identity, ok := s.authorizedKeys[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("unknown public key %s", fingerprint)
+	}
+	if !identity.HasScope(auth.ScopeFilesRead) {
+		return nil, errNoFilesScope
+	}
+	return &ssh.Permissions{Extensions: map[string]string{extKey: fingerprint}}, nil
+}
+
+func (s *Server) authLogCallback(conn ssh.ConnMetadata, method string, err error) {
+	// clients probe with none before offering their credentials
+	if err != nil && method != "none" {
+		logger.Warn("sftp", "Rejected login", "user", conn.User(), "remote", conn.RemoteAddr().String(), "method", method, "error", err)
+	}
+}
+
+// identity returns the identity a connection logged in as.
+func (s *Server) identity(perms *ssh.Permissions) (*auth.Identity, error) {
+	if fingerprint, ok := perms.Extensions[extKey]; ok {
+		return s.authorizedKeys[fingerprint], nil
+	}
+	return s.authenticator.Authenticate(perms.Extensions[extToken])
+}
+
+// Serve accepts connections on l until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(nc net.Conn) {
+	defer nc.Close()
+	nc.SetDeadline(time.Now().Add(handshakeTimeout))
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		logger.Debug("sftp", "Handshake failed", "remote", nc.RemoteAddr().String(), "error", err)
+		return
+	}
+	defer conn.Close()
+	nc.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	remote := conn.RemoteAddr().String()
+	identity, err := s.identity(conn.Permissions)
+	if err != nil {
+		logger.Warn("sftp", "Rejected login", "user", conn.User(), "remote", remote, "error", err)
+		return
+	}
+	logger.Info("sftp", "Logged in", "identity", identity.Name, "user", conn.User(), "remote", remote)
+	defer logger.Info("sftp", "Logged out", "identity", identity.Name, "remote", remote)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleChannel(channel, requests, conn.Permissions, identity, remote)
+	}
+}
+
+// handleChannel starts the sftp subsystem when it is requested. Shells,
+// commands and everything else are refused.
+func (s *Server) handleChannel(channel ssh.Channel, requests <-chan *ssh.Request, perms *ssh.Permissions, identity *auth.Identity, remote string) {
+	defer channel.Close()
+	started := false
+	for req := range requests {
+		var subsystem struct{ Name string }
+		ok := !started && req.Type == "subsystem" && ssh.Unmarshal(req.Payload, &subsystem) == nil && subsystem.Name == "sftp"
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if !ok {
+			continue
+		}
+		started = true
+		go func() {
+			login := func() (*auth.Identity, error) { return s.identity(perms) }
+			err := newSession(s.files, login, identity, remote).serve(channel)
+			if err != nil {
+				logger.Debug("sftp", "Session ended", "identity", identity.Name, "remote", remote, "error", err)
+			}
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			channel.Close()
+		}()
+	}
+}
+
+// NewServer creates an SFTP server for files. Passwords are checked with
+// authenticator, which may be nil to allow public keys only.
+func NewServer(files *file.LocalFileService, authenticator auth.Authenticator, authorizedKeys map[string]*auth.Identity, hostKey ssh.Signer) *Server {
+	s := &Server{
+		files:          files,
+		authenticator:  authenticator,
+		authorizedKeys: authorizedKeys,
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: s.publicKeyCallback,
+		AuthLogCallback:   s.authLogCallback,
+		ServerVersion:     "SSH-2.0-mcrunner",
+	}
+	if authenticator != nil {
+		s.config.PasswordCallback = s.passwordCallback
+	}
+	s.config.AddHostKey(hostKey)
+	return s
+}
+
+// LoadHostKey reads the server's private host key, generating an ed25519 key
+// when the file does not exist yet.
+func LoadHostKey(filename string) (ssh.Signer, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, genErr := ed25519.GenerateKey(rand.Reader)
+		if genErr != nil {
+			return nil, genErr
+		}
+		block, genErr := ssh.MarshalPrivateKey(key, "mcrunner")
+		if genErr != nil {
+			return nil, genErr
+		}
+		data = pem.EncodeToMemory(block)
+		if err = os.MkdirAll(filepath.Dir(filename), 0o700); err == nil {
+			err = os.WriteFile(filename, data, 0o600)
+		}
+		if err == nil {
+			logger.Println("Generated SFTP host key", "file", filename)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SFTP host key: %w", err)
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// LoadAuthorizedKeys reads public keys in the OpenSSH authorized_keys format.
+// The comment names the identity, and the options scopes="..." and
+// paths="..." take comma separated scopes and allowed paths like tokens do;
+// keys without scopes may read and write files.
+func LoadAuthorizedKeys(filename string) (map[string]*auth.Identity, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load authorized keys: %w", err)
+	}
+	keys := make(map[string]*auth.Identity)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, comment, options, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		identity := &auth.Identity{
+			ID:     "ssh:" + fingerprint,
+			Name:   comment,
+			Scopes: []auth.Scope{auth.ScopeFilesRead, auth.ScopeFilesWrite},
+		}
+		if identity.Name == "" {
+			identity.Name = fingerprint
+		}
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(name) {
+			case "scopes":
+				if identity.Scopes, err = auth.ParseScopes([]string{value}); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+				}
+			case "paths":
+				identity.Paths = strings.Split(value, ",")
+			default:
+				return nil, fmt.Errorf("%s:%d: unsupported option %q", filename, lineNo, name)
+			}
+		}
+		keys[fingerprint] = identity
+	}
+	return keys, scanner.Err()
+}
@@ -0,0 +1,697 @@
+package sftpd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+const (
+	maxHandles    = 256
+	maxReadSize   = 256 << 10
+	readdirBatch  = 100
+	maxPendingLen = 16 << 20
+)
+
+var (
+	errPermission    = errors.New("permission denied")
+	errNoSuchHandle  = errors.New("invalid handle")
+	errTooManyOpen   = errors.New("too many open handles")
+	errNotSequential = errors.New("writes must be sequential")
+	errIncomplete    = errors.New("upload is missing data")
+	errAborted       = errors.New("upload aborted")
+	errUnsupported   = errors.New("operation not supported")
+)
+
+// handle is an open file or directory. Exactly one of f, dir or upload is set.
+type handle struct {
+	path   string
+	f      *os.File
+	dir    []fs.FileInfo
+	upload *upload
+}
+
+// upload streams the writes to a file opened for writing into SaveStream,
+// so the file is replaced atomically once the handle is closed. Clients
+// pipeline their writes and may send them out of order, writes ahead of the
+// stream are held back up to maxPendingLen bytes.
+type upload struct {
+	pw      *io.PipeWriter
+	done    chan error
+	offset  int64
+	pending map[int64][]byte
+	held    int
+
+	// resume is the size of the existing content a client resuming an
+	// upload may skip, 0 when it is truncated
+	resume    int64
+	appending bool
+	files     *file.LocalFileService
+	rel       string
+	// mtime is set on the file once it is saved, unless zero
+	mtime time.Time
+}
+
+// session serves the SFTP requests of one channel in order.
+type session struct {
+	root     *file.LocalFileService
+	login    func() (*auth.Identity, error)
+	files    *file.LocalFileService // root as identity
+	identity *auth.Identity
+	remote   string
+	handles  map[string]*handle
+	nextID   uint64
+}
+
+// newSession creates a session on files, login looks up the identity of the
+// connection again before every request.
+func newSession(files *file.LocalFileService, login func() (*auth.Identity, error), identity *auth.Identity, remote string) *session {
+	return &session{
+		root:     files,
+		login:    login,
+		files:    files.As(identity),
+		identity: identity,
+		remote:   remote,
+		handles:  make(map[string]*handle),
+	}
+}
+
+// serve handles requests until the client closes the channel or its login
+// is no longer valid. Uploads left open are discarded.
+func (s *session) serve(rw io.ReadWriter) error {
+	defer s.closeAll()
+	for {
+		typ, payload, err := readPacket(rw)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.relogin(); err != nil {
+			d := &decoder{buf: payload}
+			rw.Write(status(d.uint32(), err))
+			return err
+		}
+		if _, err := rw.Write(s.handle(typ, payload)); err != nil {
+			return err
+		}
+	}
+}
+
+// relogin looks up the identity again, so that revoked and expired tokens
+// and changed scopes or paths take effect in open sessions.
+func (s *session) relogin() error {
+	identity, err := s.login()
+	if err == nil && !identity.HasScope(auth.ScopeFilesRead) {
+		err = errNoFilesScope
+	}
+	if err != nil {
+		logger.Warn("sftp", "Ended session, login no longer valid", "identity", s.identity.Name, "remote", s.remote, "error", err)
+		return fmt.Errorf("%w: %v", errPermission, err)
+	}
+	s.identity = identity
+	s.files = s.root.As(identity)
+	return nil
+}
+
+func (s *session) handle(typ byte, payload []byte) []byte {
+	if typ == fxpInit {
+		return newEncoder(fxpVersion).uint32(sftpVersion).string(posixRename).string("1").packet()
+	}
+	d := &decoder{buf: payload}
+	id := d.uint32()
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	switch typ {
+	case fxpOpen:
+		return s.open(id, d)
+	case fxpClose:
+		return s.close(id, d)
+	case fxpRead:
+		return s.read(id, d)
+	case fxpWrite:
+		return s.write(id, d)
+	case fxpStat, fxpLstat:
+		return s.stat(id, d, typ == fxpLstat)
+	case fxpFstat:
+		return s.fstat(id, d)
+	case fxpSetstat, fxpFsetstat:
+		return s.setstat(id, d, typ == fxpFsetstat)
+	case fxpOpendir:
+		return s.opendir(id, d)
+	case fxpReaddir:
+		return s.readdir(id, d)
+	case fxpRemove:
+		return s.remove(id, d, false)
+	case fxpRmdir:
+		return s.remove(id, d, true)
+	case fxpMkdir:
+		return s.mkdir(id, d)
+	case fxpRealpath:
+		return s.realpath(id, d)
+	case fxpRename:
+		return s.rename(id, d, false)
+	case fxpReadlink:
+		return s.readlink(id, d)
+	case fxpExtended:
+		if d.string() == posixRename {
+			return s.rename(id, d, true)
+		}
+	}
+	return status(id, errUnsupported)
+}
+
+// status returns the status response for err.
+func status(id uint32, err error) []byte {
+	code := uint32(fxFailure)
+	switch {
+	case err == nil:
+		code = fxOK
+	case errors.Is(err, io.EOF):
+		code = fxEOF
+	case errors.Is(err, errBadMessage):
+		code = fxBadMessage
+	case errors.Is(err, errUnsupported):
+		code = fxOpUnsupported
+	case errors.Is(err, file.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		code = fxNoSuchFile
+	case errors.Is(err, errPermission), errors.Is(err, fs.ErrPermission),
+		errors.Is(err, file.ErrAccessDenied), errors.Is(err, file.ErrReadOnlyPath),
+		errors.Is(err, file.ErrReservedPath), errors.Is(err, file.ErrSymlinkNotAllowed),
+		errors.Is(err, file.ErrPathTraversal), errors.Is(err, file.ErrMountPoint):
+		code = fxPermissionDenied
+	}
+	msg := "ok"
+	if err != nil {
+		msg = err.Error()
+	}
+	return newResponse(fxpStatus, id).uint32(code).string(msg).string("").packet()
+}
+
+// relPath converts a client path to a path relative to the root, clients see
+// the root as / and start in it.
+func relPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// canWrite rejects changes by identities without the files:write scope. The
+// allowed paths and path rules are checked by the file service.
+func (s *session) canWrite() error {
+	if !s.identity.HasScope(auth.ScopeFilesWrite) {
+		return errPermission
+	}
+	return nil
+}
+
+// audit logs a change made by the session.
+func (s *session) audit(msg string, args ...interface{}) {
+	logger.Info("sftp", msg, append([]interface{}{"identity", s.identity.Name, "remote", s.remote}, args...)...)
+}
+
+func (s *session) addHandle(h *handle) ([]byte, error) {
+	if len(s.handles) >= maxHandles {
+		return nil, errTooManyOpen
+	}
+	s.nextID++
+	id := strconv.FormatUint(s.nextID, 10)
+	s.handles[id] = h
+	return []byte(id), nil
+}
+
+func (s *session) getHandle(d *decoder) (string, *handle, error) {
+	id := d.string()
+	if d.err != nil {
+		return "", nil, d.err
+	}
+	h, ok := s.handles[id]
+	if !ok {
+		return "", nil, errNoSuchHandle
+	}
+	return id, h, nil
+}
+
+func (s *session) open(id uint32, d *decoder) []byte {
+	rel := relPath(d.string())
+	pflags := d.uint32()
+	// new files get the default permissions
+	d.attrs()
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	h := &handle{path: rel}
+	if pflags&pflagWrite != 0 {
+		u, err := s.startUpload(rel, pflags)
+		if err != nil {
+			return status(id, err)
+		}
+		h.upload = u
+	} else {
+		f, _, err := s.files.Open(rel)
+		if err != nil {
+			return status(id, err)
+		}
+		logger.Debug("sftp", "Opened file", "identity", s.identity.Name, "path", "/"+rel)
+		h.f = f
+	}
+	handleID, err := s.addHandle(h)
+	if err != nil {
+		h.discard()
+		return status(id, err)
+	}
+	return newResponse(fxpHandle, id).bytes(handleID).packet()
+}
+
+// startUpload opens rel for writing. Without the truncate flag the existing
+// content is kept up to the offset the first write starts at, which is how
+// clients resume uploads; appends keep all of it.
+func (s *session) startUpload(rel string, pflags uint32) (*upload, error) {
+	if err := s.canWrite(); err != nil {
+		return nil, err
+	}
+	if err := s.files.CheckWrite(rel); err != nil && !errors.Is(err, file.ErrNotFound) {
+		return nil, err
+	}
+	var size int64
+	if fi, err := s.files.Stat(rel); err == nil {
+		if pflags&pflagExcl != 0 {
+			return nil, file.ErrAlreadyExists
+		}
+		size = fi.Size()
+	}
+	pr, pw := io.Pipe()
+	u := &upload{
+		pw:      pw,
+		done:    make(chan error, 1),
+		pending: make(map[int64][]byte),
+		files:   s.files,
+		rel:     rel,
+	}
+	if pflags&pflagTrunc == 0 {
+		u.resume = size
+	}
+	u.appending = pflags&pflagAppend != 0
+	go func() {
+		err := u.files.SaveStream(rel, pr, pflags&pflagExcl == 0)
+		// unblock writes when SaveStream gave up early
+		pr.CloseWithError(cmp.Or(err, io.ErrClosedPipe))
+		u.done <- err
+	}()
+	if u.appending {
+		if err := u.skip(size); err != nil {
+			u.abort(err)
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// skip copies the first n bytes of the existing file into the stream.
+func (u *upload) skip(n int64) error {
+	if n == 0 {
+		return nil
+	}
+	f, _, err := u.files.Open(u.rel)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	copied, err := io.Copy(u.pw, io.LimitReader(f, n))
+	u.offset += copied
+	if err == nil && copied < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// write streams data at offset, holding it back while earlier data is
+// missing. Appends write at the end regardless of the offset.
+func (u *upload) write(offset int64, data []byte) error {
+	if u.appending {
+		offset = u.offset
+	}
+	if u.offset == 0 && offset > 0 && offset <= u.resume {
+		if err := u.skip(offset); err != nil {
+			return err
+		}
+	}
+	switch {
+	case offset < u.offset:
+		return errNotSequential
+	case offset > u.offset:
+		if u.held+len(data) > maxPendingLen {
+			return errNotSequential
+		}
+		u.pending[offset] = data
+		u.held += len(data)
+		return nil
+	}
+	for data != nil {
+		if _, err := u.pw.Write(data); err != nil {
+			return err
+		}
+		u.offset += int64(len(data))
+		var ok bool
+		if data, ok = u.pending[u.offset]; ok {
+			delete(u.pending, u.offset)
+			u.held -= len(data)
+		}
+	}
+	return nil
+}
+
+// setAttrs takes the modification time for the file being uploaded. Its
+// size is given by the writes.
+func (u *upload) setAttrs(a fileAttrs) error {
+	var fi fs.FileInfo
+	if existing, err := u.files.Stat(u.rel); err == nil {
+		fi = existing
+	}
+	if a.flags&attrSize != 0 && int64(a.size) != u.offset || !a.keeps(fi) {
+		return errUnsupported
+	}
+	if a.flags&attrACModTime != 0 {
+		u.mtime = time.Unix(int64(a.mtime), 0)
+	}
+	return nil
+}
+
+// finish ends the stream and waits for the file to be saved.
+func (u *upload) finish() error {
+	if len(u.pending) > 0 {
+		u.abort(errIncomplete)
+		return errIncomplete
+	}
+	u.pw.Close()
+	if err := <-u.done; err != nil {
+		return err
+	}
+	if !u.mtime.IsZero() {
+		return u.files.Chtimes(u.rel, u.mtime)
+	}
+	return nil
+}
+
+// abort discards the upload, leaving the existing file untouched.
+func (u *upload) abort(err error) {
+	u.pw.CloseWithError(err)
+	<-u.done
+}
+
+// discard releases a handle without saving anything.
+func (h *handle) discard() {
+	switch {
+	case h.f != nil:
+		h.f.Close()
+	case h.upload != nil:
+		h.upload.abort(errAborted)
+	}
+}
+
+func (s *session) closeAll() {
+	for id, h := range s.handles {
+		if h.upload != nil {
+			logger.Warn("sftp", "Discarded unfinished upload", "identity", s.identity.Name, "path", "/"+h.path)
+		}
+		h.discard()
+		delete(s.handles, id)
+	}
+}
+
+func (s *session) close(id uint32, d *decoder) []byte {
+	handleID, h, err := s.getHandle(d)
+	if err != nil {
+		return status(id, err)
+	}
+	delete(s.handles, handleID)
+	switch {
+	case h.f != nil:
+		err = h.f.Close()
+	case h.upload != nil:
+		if err = h.upload.finish(); err == nil {
+			s.audit("Uploaded file", "path", "/"+h.path, "size", h.upload.offset)
+		} else {
+			logger.Warn("sftp", "Failed to upload file", "identity", s.identity.Name, "path", "/"+h.path, "error", err)
+		}
+	}
+	return status(id, err)
+}
+
+func (s *session) read(id uint32, d *decoder) []byte {
+	_, h, err := s.getHandle(d)
+	offset := d.uint64()
+	length := d.uint32()
+	if err == nil {
+		err = d.err
+	}
+	if err == nil && h.f == nil {
+		err = errNoSuchHandle
+	}
+	if err != nil {
+		return status(id, err)
+	}
+	buf := make([]byte, min(length, maxReadSize))
+	n, err := h.f.ReadAt(buf, int64(offset))
+	if n == 0 {
+		return status(id, cmp.Or(err, io.EOF))
+	}
+	return newResponse(fxpData, id).bytes(buf[:n]).packet()
+}
+
+func (s *session) write(id uint32, d *decoder) []byte {
+	_, h, err := s.getHandle(d)
+	offset := d.uint64()
+	data := d.bytes()
+	if err == nil {
+		err = d.err
+	}
+	if err == nil && h.upload == nil {
+		err = errNoSuchHandle
+	}
+	if err != nil {
+		return status(id, err)
+	}
+	return status(id, h.upload.write(int64(offset), data))
+}
+
+func (s *session) stat(id uint32, d *decoder, lstat bool) []byte {
+	rel := relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	stat := s.files.Stat
+	if lstat {
+		stat = s.files.Lstat
+	}
+	fi, err := stat(rel)
+	if err != nil {
+		return status(id, err)
+	}
+	return newResponse(fxpAttrs, id).attrs(fi).packet()
+}
+
+func (s *session) fstat(id uint32, d *decoder) []byte {
+	_, h, err := s.getHandle(d)
+	if err != nil {
+		return status(id, err)
+	}
+	switch {
+	case h.f != nil:
+		fi, err := h.f.Stat()
+		if err != nil {
+			return status(id, err)
+		}
+		return newResponse(fxpAttrs, id).attrs(fi).packet()
+	case h.upload != nil:
+		// the file is not saved before the handle is closed
+		return newResponse(fxpAttrs, id).uint32(attrSize).uint64(uint64(h.upload.offset)).packet()
+	}
+	fi, err := s.files.Stat(h.path)
+	if err != nil {
+		return status(id, err)
+	}
+	return newResponse(fxpAttrs, id).attrs(fi).packet()
+}
+
+// setstat applies the size and modification time of a setstat request.
+// Permissions and owners are managed by mcrunner, requests changing them are
+// unsupported. Uploads get their modification time once they are saved.
+func (s *session) setstat(id uint32, d *decoder, byHandle bool) []byte {
+	var rel string
+	var h *handle
+	var err error
+	if byHandle {
+		_, h, err = s.getHandle(d)
+		if err == nil {
+			rel = h.path
+		}
+	} else {
+		rel = relPath(d.string())
+	}
+	a := d.attrs()
+	if err == nil {
+		err = d.err
+	}
+	if err != nil {
+		return status(id, err)
+	}
+	if a.flags&(attrSize|attrACModTime) != 0 {
+		if err := s.canWrite(); err != nil {
+			return status(id, err)
+		}
+	}
+	if h != nil && h.upload != nil {
+		return status(id, h.upload.setAttrs(a))
+	}
+	fi, err := s.files.Stat(rel)
+	if err != nil {
+		return status(id, err)
+	}
+	if !a.keeps(fi) {
+		return status(id, errUnsupported)
+	}
+	if a.flags&attrSize != 0 && int64(a.size) != fi.Size() {
+		if err := s.files.Truncate(rel, int64(a.size)); err != nil {
+			return status(id, err)
+		}
+		s.audit("Truncated file", "path", "/"+rel, "size", a.size)
+	}
+	if a.flags&attrACModTime != 0 {
+		if err := s.files.Chtimes(rel, time.Unix(int64(a.mtime), 0)); err != nil {
+			return status(id, err)
+		}
+	}
+	return status(id, nil)
+}
+
+func (s *session) opendir(id uint32, d *decoder) []byte {
+	rel := relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	items, err := s.files.List(rel)
+	if err != nil {
+		return status(id, err)
+	}
+	handleID, err := s.addHandle(&handle{path: rel, dir: items})
+	if err != nil {
+		return status(id, err)
+	}
+	logger.Debug("sftp", "Listed directory", "identity", s.identity.Name, "path", "/"+rel)
+	return newResponse(fxpHandle, id).bytes(handleID).packet()
+}
+
+func (s *session) readdir(id uint32, d *decoder) []byte {
+	_, h, err := s.getHandle(d)
+	if err == nil && h.dir == nil {
+		err = errNoSuchHandle
+	}
+	if err != nil {
+		return status(id, err)
+	}
+	if len(h.dir) == 0 {
+		return status(id, io.EOF)
+	}
+	batch := h.dir[:min(len(h.dir), readdirBatch)]
+	h.dir = h.dir[len(batch):]
+	resp := newResponse(fxpName, id).uint32(uint32(len(batch)))
+	for _, fi := range batch {
+		resp.string(fi.Name()).string(longName(fi)).attrs(fi)
+	}
+	return resp.packet()
+}
+
+func (s *session) remove(id uint32, d *decoder, dir bool) []byte {
+	rel := relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	if err := s.canWrite(); err != nil {
+		return status(id, err)
+	}
+	fi, err := s.files.Lstat(rel)
+	if err != nil {
+		return status(id, err)
+	}
+	if fi.IsDir() != dir {
+		if dir {
+			return status(id, file.ErrNotDirectory)
+		}
+		return status(id, file.ErrIsDirectory)
+	}
+	if err := s.files.Delete(rel); err != nil {
+		return status(id, err)
+	}
+	s.audit("Deleted", "path", "/"+rel)
+	return status(id, nil)
+}
+
+func (s *session) mkdir(id uint32, d *decoder) []byte {
+	rel := relPath(d.string())
+	// new directories get the default permissions
+	d.attrs()
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	if err := s.canWrite(); err != nil {
+		return status(id, err)
+	}
+	if _, err := s.files.Lstat(rel); err == nil {
+		return status(id, file.ErrAlreadyExists)
+	}
+	if err := s.files.MkdirAll(rel); err != nil {
+		return status(id, err)
+	}
+	s.audit("Created directory", "path", "/"+rel)
+	return status(id, nil)
+}
+
+func (s *session) realpath(id uint32, d *decoder) []byte {
+	name := "/" + relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	return newResponse(fxpName, id).uint32(1).string(name).string(name).attrs(nil).packet()
+}
+
+// rename moves a file or directory. Plain renames fail when the target
+// exists as SFTP requires, posix renames replace it.
+func (s *session) rename(id uint32, d *decoder, overwrite bool) []byte {
+	oldRel := relPath(d.string())
+	newRel := relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	if err := s.canWrite(); err != nil {
+		return status(id, err)
+	}
+	if err := s.files.Rename(oldRel, newRel, overwrite); err != nil {
+		return status(id, err)
+	}
+	s.audit("Renamed", "path", "/"+oldRel, "newPath", "/"+newRel)
+	return status(id, nil)
+}
+
+func (s *session) readlink(id uint32, d *decoder) []byte {
+	rel := relPath(d.string())
+	if d.err != nil {
+		return status(id, d.err)
+	}
+	target, err := s.files.Readlink(rel)
+	if err != nil {
+		return status(id, err)
+	}
+	return newResponse(fxpName, id).uint32(1).string(target).string(target).attrs(nil).packet()
+}
@@ -0,0 +1,350 @@
+package sftpd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/khanghh/mcrunner/internal/auth"
+	"github.com/khanghh/mcrunner/internal/file"
+)
+
+var (
+	readWriter = &auth.Identity{ID: "rw", Name: "rw", Scopes: []auth.Scope{auth.ScopeFilesRead, auth.ScopeFilesWrite}}
+	reader     = &auth.Identity{ID: "ro", Name: "ro", Scopes: []auth.Scope{auth.ScopeFilesRead}}
+)
+
+// testClient speaks SFTP to a session over an in-memory pipe.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	nextID uint32
+	done   chan error // result of serve
+}
+
+// newTestClient serves a session on a temporary root holding
+// world/level.dat and plugins/conf.yml. The session logs in with login.
+func newTestClient(t *testing.T, login func() (*auth.Identity, error)) (*testClient, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range map[string]string{
+		"world/level.dat":  "level",
+		"plugins/conf.yml": "conf",
+	} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := file.NewLocalFileService(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := login()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, conn := net.Pipe()
+	c := &testClient{t: t, conn: conn, done: make(chan error, 1)}
+	go func() {
+		c.done <- newSession(files, login, identity, "pipe").serve(server)
+		server.Close()
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return c, root
+}
+
+func loginAs(identity *auth.Identity) func() (*auth.Identity, error) {
+	return func() (*auth.Identity, error) { return identity, nil }
+}
+
+// send writes a raw packet of typ with payload.
+func (c *testClient) send(typ byte, payload []byte) {
+	c.t.Helper()
+	pkt := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	pkt = append(append(pkt, typ), payload...)
+	if _, err := c.conn.Write(pkt); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// call sends a request of typ with the fields written by build after the
+// request id, returning the response type and its fields after the id.
+func (c *testClient) call(typ byte, build func(e *encoder)) (byte, *decoder) {
+	c.t.Helper()
+	c.nextID++
+	e := &encoder{}
+	e.uint32(c.nextID)
+	if build != nil {
+		build(e)
+	}
+	c.send(typ, e.buf)
+	return c.response(c.nextID)
+}
+
+func (c *testClient) response(id uint32) (byte, *decoder) {
+	c.t.Helper()
+	typ, payload, err := readPacket(c.conn)
+	if err != nil {
+		c.t.Fatalf("read response: %v", err)
+	}
+	d := &decoder{buf: payload}
+	if got := d.uint32(); got != id {
+		c.t.Fatalf("response id = %d, want %d", got, id)
+	}
+	return typ, d
+}
+
+// status sends a request expecting a status response, returning its code.
+func (c *testClient) status(typ byte, build func(e *encoder)) uint32 {
+	c.t.Helper()
+	resp, d := c.call(typ, build)
+	if resp != fxpStatus {
+		c.t.Fatalf("response type = %d, want status", resp)
+	}
+	return d.uint32()
+}
+
+// handle sends a request expecting a handle response.
+func (c *testClient) handle(typ byte, build func(e *encoder)) string {
+	c.t.Helper()
+	resp, d := c.call(typ, build)
+	if resp != fxpHandle {
+		c.t.Fatalf("response type = %d, code %d, want handle", resp, d.uint32())
+	}
+	return d.string()
+}
+
+func (c *testClient) open(name string, pflags uint32) string {
+	c.t.Helper()
+	return c.handle(fxpOpen, func(e *encoder) { e.string(name).uint32(pflags).uint32(0) })
+}
+
+func (c *testClient) close(handle string) uint32 {
+	c.t.Helper()
+	return c.status(fxpClose, func(e *encoder) { e.string(handle) })
+}
+
+func expectCode(t *testing.T, what string, got, want uint32) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("%s status = %d, want %d", what, got, want)
+	}
+}
+
+func expectFile(t *testing.T, root, name, want string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Fatalf("%s = %q, want %q", name, data, want)
+	}
+}
+
+func TestSessionInit(t *testing.T) {
+	c, _ := newTestClient(t, loginAs(readWriter))
+	c.send(fxpInit, binary.BigEndian.AppendUint32(nil, sftpVersion))
+	typ, payload, err := readPacket(c.conn)
+	if err != nil || typ != fxpVersion {
+		t.Fatalf("init response = %d, %v, want version", typ, err)
+	}
+	d := &decoder{buf: payload}
+	if version := d.uint32(); version != sftpVersion {
+		t.Fatalf("version = %d, want %d", version, sftpVersion)
+	}
+	if ext := d.string(); ext != posixRename || d.err != nil {
+		t.Fatalf("extension = %q, %v, want %s", ext, d.err, posixRename)
+	}
+}
+
+func TestSessionReadWrite(t *testing.T) {
+	c, root := newTestClient(t, loginAs(readWriter))
+
+	// writes out of order are held back until the gap is filled
+	h := c.open("/plugins/new.txt", pflagWrite|pflagCreat|pflagTrunc)
+	expectCode(t, "write", c.status(fxpWrite, func(e *encoder) { e.string(h).uint64(5).string(" world") }), fxOK)
+	expectCode(t, "write", c.status(fxpWrite, func(e *encoder) { e.string(h).uint64(0).string("hello") }), fxOK)
+	if _, err := os.Stat(filepath.Join(root, "plugins/new.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file saved before close: %v", err)
+	}
+	expectCode(t, "close", c.close(h), fxOK)
+	expectFile(t, root, "plugins/new.txt", "hello world")
+
+	h = c.open("/plugins/new.txt", pflagRead)
+	typ, d := c.call(fxpRead, func(e *encoder) { e.string(h).uint64(6).uint32(100) })
+	if data := d.string(); typ != fxpData || data != "world" {
+		t.Fatalf("read = %d %q, want data %q", typ, data, "world")
+	}
+	expectCode(t, "read at end", c.status(fxpRead, func(e *encoder) { e.string(h).uint64(11).uint32(100) }), fxEOF)
+	// reads need a file opened for reading
+	expectCode(t, "write to read handle", c.status(fxpWrite, func(e *encoder) { e.string(h).uint64(0).string("x") }), fxFailure)
+	expectCode(t, "close", c.close(h), fxOK)
+	expectCode(t, "close again", c.close(h), fxFailure)
+
+	// an unfinished upload leaves the file untouched
+	h = c.open("/plugins/new.txt", pflagWrite|pflagTrunc)
+	expectCode(t, "write", c.status(fxpWrite, func(e *encoder) { e.string(h).uint64(4).string("gap") }), fxOK)
+	expectCode(t, "close incomplete", c.close(h), fxFailure)
+	expectFile(t, root, "plugins/new.txt", "hello world")
+
+	expectCode(t, "open missing", c.status(fxpOpen, func(e *encoder) { e.string("/missing").uint32(pflagRead).uint32(0) }), fxNoSuchFile)
+}
+
+func TestSessionReaddirRename(t *testing.T) {
+	c, root := newTestClient(t, loginAs(readWriter))
+	if err := os.WriteFile(filepath.Join(root, "plugins/other.yml"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := c.handle(fxpOpendir, func(e *encoder) { e.string("/plugins") })
+	typ, d := c.call(fxpReaddir, func(e *encoder) { e.string(h) })
+	if typ != fxpName {
+		t.Fatalf("readdir response = %d, want name", typ)
+	}
+	var names []string
+	for n := d.uint32(); n > 0; n-- {
+		names = append(names, d.string())
+		d.string() // long name
+		d.attrs()
+	}
+	slices.Sort(names)
+	if want := []string{"conf.yml", "other.yml"}; !slices.Equal(names, want) || d.err != nil {
+		t.Fatalf("readdir = %v, %v, want %v", names, d.err, want)
+	}
+	expectCode(t, "readdir at end", c.status(fxpReaddir, func(e *encoder) { e.string(h) }), fxEOF)
+	expectCode(t, "close", c.close(h), fxOK)
+
+	rename := func(from, to string) func(e *encoder) {
+		return func(e *encoder) { e.string(from).string(to) }
+	}
+	expectCode(t, "rename", c.status(fxpRename, rename("/plugins/conf.yml", "/plugins/moved.yml")), fxOK)
+	expectFile(t, root, "plugins/moved.yml", "conf")
+	// plain renames never replace, like OpenSSH
+	expectCode(t, "rename over", c.status(fxpRename, rename("/plugins/moved.yml", "/plugins/other.yml")), fxFailure)
+	posix := func(from, to string) func(e *encoder) {
+		return func(e *encoder) { e.string(posixRename).string(from).string(to) }
+	}
+	expectCode(t, "posix-rename over", c.status(fxpExtended, posix("/plugins/moved.yml", "/plugins/other.yml")), fxOK)
+	expectFile(t, root, "plugins/other.yml", "conf")
+	expectCode(t, "rename missing", c.status(fxpRename, rename("/plugins/moved.yml", "/plugins/x.yml")), fxNoSuchFile)
+}
+
+func TestSessionSetstat(t *testing.T) {
+	c, root := newTestClient(t, loginAs(readWriter))
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setstat := func(name string, flags uint32, fields func(e *encoder)) func(e *encoder) {
+		return func(e *encoder) {
+			e.string(name).uint32(flags)
+			fields(e)
+		}
+	}
+
+	code := c.status(fxpSetstat, setstat("/plugins/conf.yml", attrSize|attrACModTime, func(e *encoder) {
+		e.uint64(2).uint32(0).uint32(uint32(mtime.Unix()))
+	}))
+	expectCode(t, "setstat size and mtime", code, fxOK)
+	expectFile(t, root, "plugins/conf.yml", "co")
+	if fi, err := os.Stat(filepath.Join(root, "plugins/conf.yml")); err != nil || !fi.ModTime().Equal(mtime) {
+		t.Fatalf("mtime = %v, %v, want %v", fi.ModTime(), err, mtime)
+	}
+
+	// unchanged permissions are accepted, changes are not supported
+	code = c.status(fxpSetstat, setstat("/plugins/conf.yml", attrPermissions, func(e *encoder) { e.uint32(0o100644) }))
+	expectCode(t, "setstat same permissions", code, fxOK)
+	code = c.status(fxpSetstat, setstat("/plugins/conf.yml", attrPermissions, func(e *encoder) { e.uint32(0o100755) }))
+	expectCode(t, "setstat permissions", code, fxOpUnsupported)
+
+	// uploads get their mtime once saved
+	h := c.open("/plugins/up.txt", pflagWrite|pflagCreat|pflagTrunc)
+	expectCode(t, "write", c.status(fxpWrite, func(e *encoder) { e.string(h).uint64(0).string("up") }), fxOK)
+	code = c.status(fxpFsetstat, func(e *encoder) { e.string(h).uint32(attrACModTime).uint32(0).uint32(uint32(mtime.Unix())) })
+	expectCode(t, "fsetstat mtime", code, fxOK)
+	code = c.status(fxpFsetstat, func(e *encoder) { e.string(h).uint32(attrSize).uint64(10) })
+	expectCode(t, "fsetstat upload size", code, fxOpUnsupported)
+	expectCode(t, "close", c.close(h), fxOK)
+	if fi, err := os.Stat(filepath.Join(root, "plugins/up.txt")); err != nil || !fi.ModTime().Equal(mtime) {
+		t.Fatalf("upload mtime = %v, %v, want %v", fi.ModTime(), err, mtime)
+	}
+}
+
+func TestSessionPermissions(t *testing.T) {
+	restricted := &auth.Identity{ID: "p", Name: "p", Scopes: readWriter.Scopes, Paths: []string{"plugins"}}
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		typ      byte
+		build    func(e *encoder)
+		want     uint32
+	}{
+		{"read-only write", reader, fxpOpen, func(e *encoder) { e.string("/plugins/x").uint32(pflagWrite | pflagCreat).uint32(0) }, fxPermissionDenied},
+		{"read-only remove", reader, fxpRemove, func(e *encoder) { e.string("/plugins/conf.yml") }, fxPermissionDenied},
+		{"read-only mkdir", reader, fxpMkdir, func(e *encoder) { e.string("/new").uint32(0) }, fxPermissionDenied},
+		{"read-only setstat", reader, fxpSetstat, func(e *encoder) { e.string("/plugins/conf.yml").uint32(attrSize).uint64(0) }, fxPermissionDenied},
+		{"read-only rename", reader, fxpRename, func(e *encoder) { e.string("/plugins/conf.yml").string("/plugins/x") }, fxPermissionDenied},
+		{"outside paths read", restricted, fxpOpen, func(e *encoder) { e.string("/world/level.dat").uint32(pflagRead).uint32(0) }, fxPermissionDenied},
+		{"outside paths write", restricted, fxpOpen, func(e *encoder) { e.string("/world/new").uint32(pflagWrite | pflagCreat).uint32(0) }, fxPermissionDenied},
+		{"outside paths rename", restricted, fxpRename, func(e *encoder) { e.string("/plugins/conf.yml").string("/conf.yml") }, fxPermissionDenied},
+		{"outside paths opendir", restricted, fxpOpendir, func(e *encoder) { e.string("/world") }, fxPermissionDenied},
+		{"parent of paths mkdir", restricted, fxpMkdir, func(e *encoder) { e.string("/new").uint32(0) }, fxPermissionDenied},
+		{"traversal", restricted, fxpOpen, func(e *encoder) { e.string("/plugins/../world/level.dat").uint32(pflagRead).uint32(0) }, fxPermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, loginAs(tt.identity))
+			expectCode(t, tt.name, c.status(tt.typ, tt.build), tt.want)
+		})
+	}
+}
+
+func TestSessionLoginRechecked(t *testing.T) {
+	var loginErr error
+	c, _ := newTestClient(t, func() (*auth.Identity, error) { return readWriter, loginErr })
+	if typ, _ := c.call(fxpStat, func(e *encoder) { e.string("/plugins/conf.yml") }); typ != fxpAttrs {
+		t.Fatalf("stat response = %d, want attrs", typ)
+	}
+
+	// a revoked token ends the session at its next request
+	loginErr = auth.ErrInvalidToken
+	expectCode(t, "stat after revoke", c.status(fxpStat, func(e *encoder) { e.string("/plugins/conf.yml") }), fxPermissionDenied)
+	if err := <-c.done; !errors.Is(err, errPermission) {
+		t.Fatalf("serve err = %v, want permission denied", err)
+	}
+}
+
+func TestSessionBadPackets(t *testing.T) {
+	c, _ := newTestClient(t, loginAs(readWriter))
+
+	// fields missing from the payload
+	expectCode(t, "truncated open", c.status(fxpOpen, func(e *encoder) { e.string("/plugins/conf.yml") }), fxBadMessage)
+	code := c.status(fxpStat, func(e *encoder) { e.uint32(100).string("short") })
+	expectCode(t, "string past the end", code, fxBadMessage)
+	expectCode(t, "unknown handle", c.status(fxpRead, func(e *encoder) { e.string("nope").uint64(0).uint32(1) }), fxFailure)
+	expectCode(t, "unknown type", c.status(fxpSymlink, func(e *encoder) { e.string("a").string("b") }), fxOpUnsupported)
+	expectCode(t, "unknown extension", c.status(fxpExtended, func(e *encoder) { e.string("statvfs@openssh.com") }), fxOpUnsupported)
+
+	// a packet without a request id
+	c.send(fxpStat, []byte{0, 0})
+	if typ, d := c.response(0); typ != fxpStatus || d.uint32() != fxBadMessage {
+		t.Fatalf("response without id = %d, want bad message", typ)
+	}
+
+	// an oversized length ends the session
+	c.conn.Write(append(binary.BigEndian.AppendUint32(nil, maxPacketSize+1), fxpWrite))
+	if err := <-c.done; err == nil {
+		t.Fatal("serve err = nil, want invalid packet length")
+	}
+	if _, err := c.conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("read after oversized packet = %v, want EOF", err)
+	}
+}
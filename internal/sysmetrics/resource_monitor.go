@@ -23,6 +23,10 @@ type ResourceMonitor struct {
 	cpuLimit      float64
 	diskUsage     uint64
 	diskSize      uint64
+	diskPath      string // file system the disk stats are reported for
+	dataUsage     uint64
+	dataQuota     uint64
+	dataUsageFunc func() (used uint64, quota uint64)
 	stopCh        chan struct{}
 	started       bool
 }
@@ -126,13 +130,37 @@ func (rm *ResourceMonitor) updateAllMetrics() {
 		rm.mu.Unlock()
 	}
 
-	// Update disk usage (but not disk size which is cached)
-	if diskUsed, diskSize, err := rm.GetDiskStats("/"); err == nil {
+	// Update disk usage of the file system holding the data dir
+	rm.mu.RLock()
+	diskPath, dataUsageFunc := rm.diskPath, rm.dataUsageFunc
+	rm.mu.RUnlock()
+	if diskPath == "" {
+		diskPath = "/"
+	}
+	if diskUsed, diskSize, err := rm.GetDiskStats(diskPath); err == nil {
 		rm.mu.Lock()
 		rm.diskUsage = diskUsed
 		rm.diskSize = diskSize
 		rm.mu.Unlock()
 	}
+
+	// Update usage of the data dir itself
+	if dataUsageFunc != nil {
+		used, quota := dataUsageFunc()
+		rm.mu.Lock()
+		rm.dataUsage = used
+		rm.dataQuota = quota
+		rm.mu.Unlock()
+	}
+}
+
+// SetDataDir reports the disk stats of the file system holding dir, and the
+// usage of dir itself as returned by usage, which must not block.
+func (rm *ResourceMonitor) SetDataDir(dir string, usage func() (used uint64, quota uint64)) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.diskPath = dir
+	rm.dataUsageFunc = usage
 }
 
 // GetCPUPercent returns the current CPU usage percentage from the monitor
@@ -177,6 +205,20 @@ func (rm *ResourceMonitor) GetDiskSize() uint64 {
 	return rm.diskSize
 }
 
+// GetDataUsage returns the bytes used by the data dir
+func (rm *ResourceMonitor) GetDataUsage() uint64 {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.dataUsage
+}
+
+// GetDataQuota returns the quota of the data dir in bytes (0 = unlimited)
+func (rm *ResourceMonitor) GetDataQuota() uint64 {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.dataQuota
+}
+
 // GetDiskStats returns used and total bytes for the filesystem at path.
 // It also caches the total size on first successful read.
 func (rm *ResourceMonitor) GetDiskStats(path string) (used uint64, total uint64, err error) {
@@ -205,6 +247,8 @@ func (rm *ResourceMonitor) GetResourceUsage() *ResourceUsage {
 		CPULimit:    rm.GetCPULimit(),
 		DiskUsage:   rm.GetDiskUsage(),
 		DiskSize:    rm.GetDiskSize(),
+		DataUsage:   rm.GetDataUsage(),
+		DataQuota:   rm.GetDataQuota(),
 	}
 }
 
@@ -17,6 +17,8 @@ type ResourceUsage struct {
 	CPULimit    float64 // max CPUs allowed
 	DiskUsage   uint64  // current disk usage in bytes
 	DiskSize    uint64  // disk size in bytes
+	DataUsage   uint64  // bytes used by the files in the data dir
+	DataQuota   uint64  // max allowed size of the data dir in bytes (0 = unlimited)
 }
 
 // GetMemoryUsageBytes returns current memory usage in bytes
@@ -140,3 +142,9 @@ func GetOutboundIP() (net.IP, error) {
 func GetResourceUsage() *ResourceUsage {
 	return getMonitor().GetResourceUsage()
 }
+
+// SetDataDir makes the reported disk stats those of the file system holding
+// dir, and reports the usage of dir itself as returned by usage.
+func SetDataDir(dir string, usage func() (used uint64, quota uint64)) {
+	getMonitor().SetDataDir(dir, usage)
+}
@@ -0,0 +1,189 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/khanghh/mcrunner/pkg/logger"
+)
+
+// CertReloader serves a TLS certificate and client CA pool loaded from files
+// and reloads them when the files change, without restarting the listeners.
+type CertReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewCertReloader loads the certificate, key and optional client CA bundle.
+func NewCertReloader(certFile, keyFile, clientCAFile string) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both TLS certificate and key files are required")
+	}
+	r := &CertReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. On error the previously loaded certificate
+// stays in use.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.clientCAFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.mu.Unlock()
+	return nil
+}
+
+// MutualTLS reports whether a client CA is configured.
+func (r *CertReloader) MutualTLS() bool {
+	return r.clientCAFile != ""
+}
+
+func (r *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// verifyClientCert verifies the client chain against the current client CA
+// pool. Verification is done here instead of through tls.Config.ClientCAs so
+// the pool can be swapped on reload.
+func (r *CertReloader) verifyClientCert(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return nil
+	}
+	r.mu.RLock()
+	roots := r.clientCAs
+	r.mu.RUnlock()
+	if roots == nil {
+		return errors.New("client certificates are not accepted")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// ServerConfig returns a TLS config backed by the reloader. When a client CA
+// is configured, client certificates are verified against it and required if
+// requireClientCert is set; peer certificates of accepted connections are
+// therefore always verified.
+func (r *CertReloader) ServerConfig(requireClientCert bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	if r.MutualTLS() {
+		cfg.ClientAuth = tls.RequestClientCert
+		if requireClientCert {
+			cfg.ClientAuth = tls.RequireAnyClientCert
+		}
+		cfg.VerifyPeerCertificate = r.verifyClientCert
+	}
+	return cfg
+}
+
+// Watch reloads the files whenever they change on disk until done is closed.
+// The parent directories are watched so that atomic replacements and
+// symlink swaps (e.g. Kubernetes secrets) are picked up.
+func (r *CertReloader) Watch(done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	files := map[string]bool{}
+	for _, name := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if name == "" {
+			continue
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		files[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		// debounce bursts of events caused by a single certificate rotation
+		var reloadTimer <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if files[event.Name] || filepath.Base(event.Name) == "..data" {
+					reloadTimer = time.After(500 * time.Millisecond)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("tls", "Certificate watcher error", "error", err)
+			case <-reloadTimer:
+				reloadTimer = nil
+				if err := r.Reload(); err != nil {
+					logger.Error("tls", "Failed to reload certificates", "error", err)
+				} else {
+					logger.Info("tls", "Reloaded certificates")
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,55 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// connectionStater is implemented by connections whose TLS handshake was
+// already completed by the listener.
+type connectionStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// terminatedCredentials are gRPC server credentials for listeners that
+// terminate TLS themselves, such as the single-port multiplexer. They report
+// the existing TLS state to gRPC so peer certificates remain available to the
+// auth interceptors.
+type terminatedCredentials struct{}
+
+// TerminatedTLSCredentials returns gRPC server credentials for connections
+// that were already TLS-terminated by the listener.
+func TerminatedTLSCredentials() credentials.TransportCredentials {
+	return terminatedCredentials{}
+}
+
+func (terminatedCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tlsConn, ok := conn.(connectionStater)
+	if !ok {
+		return nil, nil, errors.New("tlsutil: connection is not TLS-terminated")
+	}
+	return conn, credentials.TLSInfo{
+		State:          tlsConn.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (terminatedCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("tlsutil: terminated TLS credentials are server-only")
+}
+
+func (terminatedCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls"}
+}
+
+func (c terminatedCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (terminatedCredentials) OverrideServerName(string) error {
+	return nil
+}
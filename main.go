@@ -1,7 +1,7 @@
 package main
 
 import (
-	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -15,20 +15,25 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/khanghh/mcrunner/internal/auth"
 	"github.com/khanghh/mcrunner/internal/file"
+	"github.com/khanghh/mcrunner/internal/grpcweb"
 	"github.com/khanghh/mcrunner/internal/handlers"
 	"github.com/khanghh/mcrunner/internal/mcagent"
 	"github.com/khanghh/mcrunner/internal/mccmd"
+	"github.com/khanghh/mcrunner/internal/mcplayers"
+	"github.com/khanghh/mcrunner/internal/netmux"
 	"github.com/khanghh/mcrunner/internal/params"
 	"github.com/khanghh/mcrunner/internal/service"
+	"github.com/khanghh/mcrunner/internal/sftpd"
+	"github.com/khanghh/mcrunner/internal/sysmetrics"
+	"github.com/khanghh/mcrunner/internal/tlsutil"
 	"github.com/khanghh/mcrunner/pkg/logger"
 	pb "github.com/khanghh/mcrunner/pkg/proto"
 	"github.com/urfave/cli/v2"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 var (
@@ -68,27 +73,219 @@ var (
 	}
 	secretKeyFlag = &cli.StringFlag{
 		Name:  "secret",
-		Usage: "Secret key to access the HTTP and gRPC APIs",
+		Usage: "Legacy secret key granting full access to the HTTP and gRPC APIs",
+	}
+	tokensFileFlag = &cli.StringFlag{
+		Name:  "tokens",
+		Usage: "Path to the API tokens state file",
+	}
+	tlsCertFlag = &cli.StringFlag{
+		Name:  "tls-cert",
+		Usage: "TLS certificate file for the HTTP and gRPC servers",
+	}
+	tlsKeyFlag = &cli.StringFlag{
+		Name:  "tls-key",
+		Usage: "TLS private key file for the HTTP and gRPC servers",
+	}
+	tlsClientCAFlag = &cli.StringFlag{
+		Name:  "tls-client-ca",
+		Usage: "CA bundle used to verify client certificates (enables mutual TLS)",
+	}
+	tlsRequireClientCertFlag = &cli.BoolFlag{
+		Name:  "tls-require-client-cert",
+		Usage: "Reject TLS clients that do not present a valid certificate",
+	}
+	tlsClientIdentityFlag = &cli.StringSliceFlag{
+		Name:  "tls-client-identity",
+		Usage: "Grant scopes to a client certificate name (CN or SAN), e.g. panel=admin",
+	}
+	jwtKeysFlag = &cli.StringFlag{
+		Name:  "jwt-keys",
+		Usage: "JWKS or PEM file with the public keys used to verify JWT access tokens",
+	}
+	jwtIssuerFlag = &cli.StringFlag{
+		Name:  "jwt-issuer",
+		Usage: "Required JWT issuer (iss claim)",
+	}
+	jwtAudienceFlag = &cli.StringFlag{
+		Name:  "jwt-audience",
+		Usage: "Required JWT audience (aud claim)",
+	}
+	jwtScopeClaimFlag = &cli.StringFlag{
+		Name:  "jwt-scope-claim",
+		Usage: "JWT claim holding the granted scopes or roles",
+		Value: "scope",
+	}
+	jwtClaimScopesFlag = &cli.StringSliceFlag{
+		Name:  "jwt-claim-scopes",
+		Usage: "Grant scopes to a custom JWT scope claim value, e.g. operator=lifecycle,console:write",
+	}
+	jwtLeewayFlag = &cli.DurationFlag{
+		Name:  "jwt-leeway",
+		Usage: "Allowed clock skew when validating JWT expiry",
+		Value: 30 * time.Second,
+	}
+	followSymlinksFlag = &cli.BoolFlag{
+		Name:  "follow-symlinks",
+		Usage: "Follow symbolic links that stay inside rootdir (links leading outside are never followed)",
+		Value: true,
+	}
+	uploadExpiryFlag = &cli.DurationFlag{
+		Name:  "upload-expiry",
+		Usage: "Discard resumable uploads without activity for this long",
+		Value: 24 * time.Hour,
+	}
+	trashFlag = &cli.BoolFlag{
+		Name:  "trash",
+		Usage: "Move deleted and replaced files to a trash under rootdir/.mcrunner instead of deleting them",
+		Value: true,
+	}
+	trashMaxAgeFlag = &cli.DurationFlag{
+		Name:  "trash-max-age",
+		Usage: "Purge trash items deleted longer ago than this, 0 for no limit",
+		Value: 7 * 24 * time.Hour,
+	}
+	trashMaxSizeFlag = &cli.Int64Flag{
+		Name:  "trash-max-size",
+		Usage: "Maximum total size of the trash in bytes, the oldest items are purged first, 0 for no limit",
+		Value: 1 << 30,
+	}
+	fileVersionsFlag = &cli.IntFlag{
+		Name:  "file-versions",
+		Usage: "Number of previous versions kept for each overwritten text file, 0 disables the history",
+		Value: 10,
+	}
+	versionMaxAgeFlag = &cli.DurationFlag{
+		Name:  "version-max-age",
+		Usage: "Purge file versions older than this, 0 for no limit",
+		Value: 30 * 24 * time.Hour,
+	}
+	versionMaxSizeFlag = &cli.Int64Flag{
+		Name:  "version-max-size",
+		Usage: "Maximum total size of the file versions in bytes, the oldest are purged first, 0 for no limit",
+		Value: 256 << 20,
+	}
+	pathRulesFlag = &cli.StringFlag{
+		Name:  "path-rules",
+		Usage: "JSON file with rules hiding, denying or write protecting paths in the file manager",
+	}
+	mountsFlag = &cli.StringFlag{
+		Name:  "mounts",
+		Usage: "JSON file with directories outside of the root dir to mount into the file manager",
+	}
+	quotaFlag = &cli.Int64Flag{
+		Name:  "quota",
+		Usage: "Maximum total size of the files in the root dir in bytes, enforced on uploads, writes and extractions, 0 for no limit",
+	}
+	usageCacheFlag = &cli.DurationFlag{
+		Name:  "usage-cache",
+		Usage: "How long the directory sizes of disk usage scans are cached",
+		Value: 5 * time.Minute,
+	}
+	sftpListenFlag = &cli.StringFlag{
+		Name:  "sftp",
+		Usage: "SFTP server listen address (host:port), logging in with API tokens as passwords or authorized keys; changes made over SFTP are audited in the log (default: disabled)",
+	}
+	sftpHostKeyFlag = &cli.StringFlag{
+		Name:  "sftp-host-key",
+		Usage: "SFTP server private host key, generated when missing (default: rootdir/.mcrunner/ssh_host_ed25519_key)",
+	}
+	sftpAuthorizedKeysFlag = &cli.StringFlag{
+		Name:  "sftp-authorized-keys",
+		Usage: "authorized_keys file with the public keys allowed to log in to the SFTP server, scopes=\"...\" and paths=\"...\" options restrict them",
+	}
+	tokenNameFlag = &cli.StringFlag{
+		Name:     "name",
+		Usage:    "Token name",
+		Required: true,
+	}
+	tokenScopeFlag = &cli.StringSliceFlag{
+		Name:     "scope",
+		Usage:    "Scope granted to the token (state:read, console:read, console:write, lifecycle, files:read, files:write, admin)",
+		Required: true,
+	}
+	tokenPathFlag = &cli.StringSliceFlag{
+		Name:  "path",
+		Usage: "Restrict file access to this path relative to rootdir",
+	}
+	tokenExpiresFlag = &cli.DurationFlag{
+		Name:  "expires",
+		Usage: "Token lifetime, e.g. 720h (default: never expires)",
 	}
 )
 
 func init() {
 	app = cli.NewApp()
 	app.EnableBashCompletion = true
+	// scope mappings such as panel=files:read,files:write contain commas
+	app.DisableSliceFlagSeparator = true
 	app.Name = "Minecraft server runner"
 	app.Usage = ""
 	app.Flags = []cli.Flag{
+		pluginConfigFileFlag,
 		commandFlag,
 		rootDirFlag,
 		inputFifoFlag,
 		grpcListenFlag,
 		httpListenFlag,
+		secretKeyFlag,
+		tokensFileFlag,
+		tlsCertFlag,
+		tlsKeyFlag,
+		tlsClientCAFlag,
+		tlsRequireClientCertFlag,
+		tlsClientIdentityFlag,
+		jwtKeysFlag,
+		jwtIssuerFlag,
+		jwtAudienceFlag,
+		jwtScopeClaimFlag,
+		jwtClaimScopesFlag,
+		jwtLeewayFlag,
+		uploadExpiryFlag,
+		followSymlinksFlag,
+		trashFlag,
+		trashMaxAgeFlag,
+		trashMaxSizeFlag,
+		fileVersionsFlag,
+		versionMaxAgeFlag,
+		versionMaxSizeFlag,
+		pathRulesFlag,
+		mountsFlag,
+		quotaFlag,
+		usageCacheFlag,
+		sftpListenFlag,
+		sftpHostKeyFlag,
+		sftpAuthorizedKeysFlag,
 	}
 	app.Commands = []*cli.Command{
 		{
 			Name:   "version",
 			Action: printVersion,
 		},
+		{
+			Name:  "token",
+			Usage: "Manage API tokens",
+			Flags: []cli.Flag{tokensFileFlag},
+			Subcommands: []*cli.Command{
+				{
+					Name:   "create",
+					Usage:  "Create a new API token",
+					Flags:  []cli.Flag{tokenNameFlag, tokenScopeFlag, tokenPathFlag, tokenExpiresFlag},
+					Action: createToken,
+				},
+				{
+					Name:   "list",
+					Usage:  "List API tokens",
+					Action: listTokens,
+				},
+				{
+					Name:      "revoke",
+					Usage:     "Revoke an API token",
+					ArgsUsage: "<id>",
+					Action:    revokeToken,
+				},
+			},
+		},
 	}
 	app.Action = run
 }
@@ -101,6 +298,72 @@ func printVersion(cli *cli.Context) error {
 	return nil
 }
 
+func mustLoadTokenStore(cli *cli.Context) *auth.TokenStore {
+	tokensFile := cli.String(tokensFileFlag.Name)
+	if tokensFile == "" {
+		logger.Fatalln("--tokens must be set")
+	}
+	store, err := auth.LoadTokenStore(tokensFile)
+	if err != nil {
+		logger.Fatalln("Failed to load tokens file:", err)
+	}
+	return store
+}
+
+func createToken(cli *cli.Context) error {
+	store := mustLoadTokenStore(cli)
+	scopes, err := auth.ParseScopes(cli.StringSlice(tokenScopeFlag.Name))
+	if err != nil {
+		return err
+	}
+	var expiresAt *time.Time
+	if ttl := cli.Duration(tokenExpiresFlag.Name); ttl > 0 {
+		t := time.Now().Add(ttl).UTC()
+		expiresAt = &t
+	}
+	secret, token, err := store.Create(cli.String(tokenNameFlag.Name), scopes, cli.StringSlice(tokenPathFlag.Name), expiresAt)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created token %s (%s)\n", token.ID, token.Name)
+	fmt.Println("Store the token now, it will not be shown again:")
+	fmt.Println(secret)
+	return nil
+}
+
+func listTokens(cli *cli.Context) error {
+	store := mustLoadTokenStore(cli)
+	now := time.Now()
+	for _, t := range store.List() {
+		expires := "never"
+		if t.ExpiresAt != nil {
+			expires = t.ExpiresAt.Format(time.RFC3339)
+			if t.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+		scopes := make([]string, 0, len(t.Scopes))
+		for _, s := range t.Scopes {
+			scopes = append(scopes, string(s))
+		}
+		fmt.Printf("%s\t%s\t%s\tpaths=%s\texpires=%s\n", t.ID, t.Name, strings.Join(scopes, ","), strings.Join(t.Paths, ","), expires)
+	}
+	return nil
+}
+
+func revokeToken(cli *cli.Context) error {
+	id := cli.Args().First()
+	if id == "" {
+		return fmt.Errorf("missing token id")
+	}
+	store := mustLoadTokenStore(cli)
+	if err := store.Revoke(id); err != nil {
+		return err
+	}
+	fmt.Printf("Revoked token %s\n", id)
+	return nil
+}
+
 func ensureFifoExist(fifoPath string) error {
 	if _, statErr := os.Stat(fifoPath); errors.Is(statErr, os.ErrNotExist) {
 		if mkErr := syscall.Mkfifo(fifoPath, 0666); mkErr != nil && !os.IsExist(mkErr) {
@@ -181,14 +444,25 @@ func parseServerCmd(commandStr string) (string, []string) {
 	return commandStr, []string{}
 }
 
-func initListeners(grpcAddr, httpAddr string) (net.Listener, net.Listener, error) {
+// initListeners opens the gRPC and HTTP listeners. When both servers share an
+// address, a single listener is multiplexed between them by protocol: HTTP/2
+// goes to gRPC, HTTP/1.x and WebSocket upgrades go to the HTTP server. With
+// TLS enabled, the HTTP listener (or the shared listener) terminates TLS
+// itself, while a dedicated gRPC listener is secured by the gRPC credentials.
+func initListeners(grpcAddr, httpAddr string, tlsConfig *tls.Config) (net.Listener, net.Listener, error) {
 	grpcListener, err := net.Listen("tcp", grpcAddr)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to listen on gRPC address %s: %v", grpcAddr, err)
 	}
 
 	if grpcAddr == httpAddr {
-		return grpcListener, grpcListener, nil
+		listener := grpcListener
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, netmux.TLSConfig(tlsConfig))
+		}
+		mux := netmux.New(listener)
+		go mux.Serve()
+		return mux.HTTP2(), mux.HTTP1(), nil
 	}
 
 	httpListener, err := net.Listen("tcp", httpAddr)
@@ -196,25 +470,96 @@ func initListeners(grpcAddr, httpAddr string) (net.Listener, net.Listener, error
 		grpcListener.Close()
 		return nil, nil, fmt.Errorf("failed to listen on HTTP address %s: %v", httpAddr, err)
 	}
+	if tlsConfig != nil {
+		httpTLSConfig := tlsConfig.Clone()
+		httpTLSConfig.NextProtos = []string{"http/1.1"}
+		httpListener = tls.NewListener(httpListener, httpTLSConfig)
+	}
 	return grpcListener, httpListener, nil
 }
 
-func grpcAuthInterceptor(secretKey string) grpc.ServerOption {
-	return grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if secretKey == "" {
-			return handler(ctx, req)
+// initSFTPServer creates the SFTP server when a listen address is configured.
+func initSFTPServer(cli *cli.Context, files *file.LocalFileService, authenticator auth.Authenticator) (*sftpd.Server, error) {
+	if cli.String(sftpListenFlag.Name) == "" {
+		return nil, nil
+	}
+	var authorizedKeys map[string]*auth.Identity
+	if keysFile := cli.String(sftpAuthorizedKeysFlag.Name); keysFile != "" {
+		keys, err := sftpd.LoadAuthorizedKeys(keysFile)
+		if err != nil {
+			return nil, err
 		}
+		authorizedKeys = keys
+	}
+	if authenticator == nil && len(authorizedKeys) == 0 {
+		return nil, fmt.Errorf("--sftp requires API tokens or --sftp-authorized-keys to log in with")
+	}
+	hostKeyFile := cli.String(sftpHostKeyFlag.Name)
+	if hostKeyFile == "" {
+		hostKeyFile = filepath.Join(files.RootDir, ".mcrunner", "ssh_host_ed25519_key")
+	}
+	hostKey, err := sftpd.LoadHostKey(hostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return sftpd.NewServer(files, authenticator, authorizedKeys, hostKey), nil
+}
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
+// initJWTVerifier creates the JWT verifier when a key file is configured.
+func initJWTVerifier(cli *cli.Context) (*auth.JWTVerifier, error) {
+	keysFile := cli.String(jwtKeysFlag.Name)
+	if keysFile == "" {
+		return nil, nil
+	}
+	claimScopes, err := auth.ParseScopeMappings(cli.StringSlice(jwtClaimScopesFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := auth.NewJWTVerifier(auth.JWTConfig{
+		KeysFile:    keysFile,
+		Issuer:      cli.String(jwtIssuerFlag.Name),
+		Audience:    cli.String(jwtAudienceFlag.Name),
+		ScopeClaim:  cli.String(jwtScopeClaimFlag.Name),
+		ClaimScopes: claimScopes,
+		Leeway:      cli.Duration(jwtLeewayFlag.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %v", err)
+	}
+	return verifier, nil
+}
+
+// initAuthenticator builds the API authenticator from the legacy secret, the
+// token store, the JWT verifier and client certificate mappings. It returns a
+// nil authenticator when none of them is configured.
+func initAuthenticator(secretKey, tokensFile string, jwtVerifier *auth.JWTVerifier, clientIdentities []string) (auth.Authenticator, *auth.TokenStore, error) {
+	var authenticators auth.MultiAuthenticator
+	var tokenStore *auth.TokenStore
+	if tokensFile != "" {
+		store, err := auth.LoadTokenStore(tokensFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load tokens file: %v", err)
 		}
-		authHeaders := md.Get("authorization")
-		if len(authHeaders) == 0 || authHeaders[0] != fmt.Sprintf("Bearer %s", secretKey) {
-			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		tokenStore = store
+		authenticators = append(authenticators, store)
+	}
+	if jwtVerifier != nil {
+		authenticators = append(authenticators, jwtVerifier)
+	}
+	if secretKey != "" {
+		authenticators = append(authenticators, auth.NewSecretAuthenticator(secretKey))
+	}
+	if len(clientIdentities) > 0 {
+		mapper, err := auth.ParseCertificateMappings(clientIdentities)
+		if err != nil {
+			return nil, nil, err
 		}
-		return handler(ctx, req)
-	})
+		authenticators = append(authenticators, mapper)
+	}
+	if len(authenticators) == 0 {
+		return nil, nil, nil
+	}
+	return authenticators, tokenStore, nil
 }
 
 // run is the main entry point for the CLI application.
@@ -226,20 +571,122 @@ func run(cli *cli.Context) error {
 	gprcListenAddr := cli.String(grpcListenFlag.Name)
 	httpListenAddr := cli.String(httpListenFlag.Name)
 	secretKey := cli.String(secretKeyFlag.Name)
+	tokensFile := cli.String(tokensFileFlag.Name)
 	serverCmd := cli.String(commandFlag.Name)
 
-	if secretKey == "" {
-		logger.Warnln("Secret key is not set, the HTTP and gRPC APIs will be accessible without authentication.")
-	}
 	if serverCmd == "" {
 		return fmt.Errorf("server command must not be empty")
 	}
+	clientIdentities := cli.StringSlice(tlsClientIdentityFlag.Name)
+	jwtVerifier, err := initJWTVerifier(cli)
+	if err != nil {
+		return err
+	}
+	authenticator, tokenStore, err := initAuthenticator(secretKey, tokensFile, jwtVerifier, clientIdentities)
+	if err != nil {
+		return err
+	}
+	if authenticator == nil {
+		logger.Warnln("No secret key, tokens file or JWT keys are set, the HTTP and gRPC APIs will be accessible without authentication.")
+	}
+
+	var certReloader *tlsutil.CertReloader
+	if certFile, keyFile := cli.String(tlsCertFlag.Name), cli.String(tlsKeyFlag.Name); certFile != "" || keyFile != "" {
+		certReloader, err = tlsutil.NewCertReloader(certFile, keyFile, cli.String(tlsClientCAFlag.Name))
+		if err != nil {
+			return err
+		}
+		if err := certReloader.Watch(make(chan struct{})); err != nil {
+			logger.Warnln("Failed to watch TLS certificate files, use SIGHUP to reload them", "error", err)
+		}
+	} else if len(clientIdentities) > 0 || cli.String(tlsClientCAFlag.Name) != "" {
+		return fmt.Errorf("client certificate options require --tls-cert and --tls-key")
+	}
 
 	absRootDir := mustResolveRootDir(rootDir)
-	localFilesSvc := file.NewLocalFileService(absRootDir)
+	localFilesSvc, err := file.NewLocalFileService(absRootDir, cli.Bool(followSymlinksFlag.Name))
+	if err != nil {
+		return err
+	}
+	if cli.Bool(trashFlag.Name) {
+		localFilesSvc.Trash = &file.Retention{
+			MaxAge:  cli.Duration(trashMaxAgeFlag.Name),
+			MaxSize: cli.Int64(trashMaxSizeFlag.Name),
+		}
+	}
+	if versions := cli.Int(fileVersionsFlag.Name); versions > 0 {
+		localFilesSvc.Versions = &file.Retention{
+			MaxAge:   cli.Duration(versionMaxAgeFlag.Name),
+			MaxSize:  cli.Int64(versionMaxSizeFlag.Name),
+			MaxCount: versions,
+		}
+	}
 
 	cmdPath, cmdArgs := parseServerCmd(serverCmd)
 	mcserverCmd := mccmd.NewMCServerCmd(cmdPath, cmdArgs, rootDir, os.Stdout)
+	policy := &file.Policy{}
+	if rulesFile := cli.String(pathRulesFlag.Name); rulesFile != "" {
+		if policy, err = file.LoadPolicy(rulesFile); err != nil {
+			return err
+		}
+	}
+	// mounts evaluate the while running rules through the root policy
+	policy.Running = func() bool {
+		return mcserverCmd.GetStatus() == mccmd.StatusRunning
+	}
+	localFilesSvc.Policy = policy
+	if resolver, ok := authenticator.(auth.IdentityResolver); ok {
+		localFilesSvc.Identities = resolver
+	}
+	// staged file changes are applied whenever the server is stopped and about
+	// to start again; a failed apply is rolled back and the server starts with
+	// the files it had, unless the rollback failed too
+	mcserverCmd.OnBeforeStart(func() error {
+		applied, err := localFilesSvc.ApplyStaged()
+		if errors.Is(err, file.ErrRollbackFailed) {
+			return err
+		}
+		if err != nil {
+			logger.Errorln("Failed to apply staged changes, they were rolled back", "error", err)
+		} else if applied > 0 {
+			logger.Println("Applied staged changes", "count", applied)
+		}
+		return nil
+	})
+	if mountsFile := cli.String(mountsFlag.Name); mountsFile != "" {
+		mounts, err := file.LoadMounts(mountsFile)
+		if err != nil {
+			return err
+		}
+		for _, m := range mounts {
+			if err := localFilesSvc.AddMount(m); err != nil {
+				return err
+			}
+			logger.Println("Mounted directory", "path", m.Path, "dir", m.Dir, "readOnly", m.ReadOnly)
+		}
+	}
+
+	localFilesSvc.Quota = cli.Int64(quotaFlag.Name)
+	localFilesSvc.UsageTTL = cli.Duration(usageCacheFlag.Name)
+	sysmetrics.SetDataDir(absRootDir, func() (uint64, uint64) {
+		used, _ := localFilesSvc.TreeUsage()
+		return uint64(max(used, 0)), uint64(localFilesSvc.Quota)
+	})
+	go localFilesSvc.UsageLoop(make(chan struct{}))
+	go localFilesSvc.RetentionLoop(make(chan struct{}))
+	uploads := file.NewUploadManager(localFilesSvc, cli.Duration(uploadExpiryFlag.Name))
+	go uploads.ExpireLoop(make(chan struct{}))
+	jobs := file.NewJobManager(localFilesSvc, time.Hour)
+	go jobs.ExpireLoop(make(chan struct{}))
+	watcher, err := file.NewWatcher(localFilesSvc, 250*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	go watcher.Run(make(chan struct{}))
+	sftpServer, err := initSFTPServer(cli, localFilesSvc, authenticator)
+	if err != nil {
+		return err
+	}
 	if fifoPath := cli.String(inputFifoFlag.Name); fifoPath != "" {
 		go fifoInputLoop(mcserverCmd, fifoPath)
 	}
@@ -247,21 +694,23 @@ func run(cli *cli.Context) error {
 	mcagent := mcagent.NewMCAgentBridge(agentConfigFile)
 
 	// handlers
-	mcrunnerHandler := handlers.NewMCRunnerHandler(mcserverCmd)
-	fsHandler := handlers.NewFSHandler(localFilesSvc)
+	mcrunnerHandler := handlers.NewMCRunnerHandler(mcserverCmd, mcagent)
+	fsHandler := handlers.NewFSHandler(localFilesSvc, jobs, watcher)
+	uploadsHandler := handlers.NewUploadsHandler(uploads)
+	jobsHandler := handlers.NewJobsHandler(jobs)
+	trashHandler := handlers.NewTrashHandler(localFilesSvc)
+	versionsHandler := handlers.NewVersionsHandler(localFilesSvc)
+	stagingHandler := handlers.NewStagingHandler(localFilesSvc)
+	propertiesHandler := handlers.NewPropertiesHandler(localFilesSvc, mcserverCmd)
+	playersManager := mcplayers.NewManager(localFilesSvc, mcserverCmd)
+	playersHandler := handlers.NewPlayersHandler(playersManager)
 	mcagentHandler := handlers.NewMCAgentPluginHandler(mcagent)
 
 	// middlewares
-	authMiddleware := func(c *fiber.Ctx) error {
-		if secretKey == "" {
-			return c.Next()
-		}
-		authHeader := c.Get("Authorization")
-		if authHeader != fmt.Sprintf("Bearer %s", secretKey) {
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
-		return c.Next()
-	}
+	authMiddleware := handlers.AuthMiddleware(authenticator)
+	requireFilesRead := handlers.RequireScope(auth.ScopeFilesRead)
+	requireFilesWrite := handlers.RequireScope(auth.ScopeFilesWrite)
+	requireLifecycle := handlers.RequireScope(auth.ScopeLifecycle)
 
 	// setup HTTP server and routes
 	router := fiber.New(fiber.Config{
@@ -272,22 +721,58 @@ func run(cli *cli.Context) error {
 	})
 	router.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
+		AllowMethods: "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS",
 		AllowHeaders: "*",
+		// let gRPC-Web and Connect clients read the gRPC status headers, upload
+		// clients the resume offset, editors the ETag to send in If-Match and
+		// file browsers the paging headers of listings
+		ExposeHeaders: "Grpc-Status,Grpc-Message,Grpc-Status-Details-Bin,Location,Upload-Offset,Upload-Length,ETag,X-Next-Cursor,X-Total-Count,X-Truncated",
 	}))
 
 	apiRouter := router.Group("/api", authMiddleware)
-	apiRouter.Get("/fs/*", fsHandler.Get)
-	apiRouter.Post("/fs/*", fsHandler.Post)
-	apiRouter.Put("/fs/*", fsHandler.Put)
-	apiRouter.Patch("/fs/*", fsHandler.Patch)
-	apiRouter.Delete("/fs/*", fsHandler.Delete)
-	apiRouter.Get("/mc/state", mcrunnerHandler.GetState)
-	apiRouter.Post("/mc/command", mcrunnerHandler.PostCommand)
-	apiRouter.Post("/mc/start", mcrunnerHandler.PostStartServer)
-	apiRouter.Post("/mc/stop", mcrunnerHandler.PostStopServer)
-	apiRouter.Post("/mc/restart", mcrunnerHandler.PostRestartServer)
-	apiRouter.Post("/mc/kill", mcrunnerHandler.PostKillServer)
+	apiRouter.Get("/fs/*", requireFilesRead, fsHandler.Get)
+	apiRouter.Post("/fs/*", requireFilesWrite, fsHandler.Post)
+	apiRouter.Put("/fs/*", requireFilesWrite, fsHandler.Put)
+	apiRouter.Patch("/fs/*", requireFilesWrite, fsHandler.Patch)
+	apiRouter.Delete("/fs/*", requireFilesWrite, fsHandler.Delete)
+	apiRouter.Post("/uploads", requireFilesWrite, uploadsHandler.PostUpload)
+	apiRouter.Head("/uploads/:id", requireFilesWrite, uploadsHandler.HeadUpload)
+	apiRouter.Get("/uploads/:id", requireFilesWrite, uploadsHandler.GetUpload)
+	apiRouter.Patch("/uploads/:id", requireFilesWrite, uploadsHandler.PatchUpload)
+	apiRouter.Delete("/uploads/:id", requireFilesWrite, uploadsHandler.DeleteUpload)
+	apiRouter.Post("/batch", requireFilesWrite, jobsHandler.PostBatch)
+	apiRouter.Get("/jobs", requireFilesWrite, jobsHandler.GetJobs)
+	apiRouter.Get("/jobs/:id", requireFilesWrite, jobsHandler.GetJob)
+	apiRouter.Delete("/jobs/:id", requireFilesWrite, jobsHandler.DeleteJob)
+	apiRouter.Get("/trash", requireFilesRead, trashHandler.GetTrash)
+	apiRouter.Delete("/trash", requireFilesWrite, trashHandler.DeleteTrash)
+	apiRouter.Post("/trash/:id/restore", requireFilesWrite, trashHandler.PostRestore)
+	apiRouter.Delete("/trash/:id", requireFilesWrite, trashHandler.DeleteItem)
+	apiRouter.Get("/versions/*", requireFilesRead, versionsHandler.GetVersions)
+	apiRouter.Post("/versions/*", requireFilesWrite, versionsHandler.PostRestore)
+	apiRouter.Get("/staged", requireFilesRead, stagingHandler.GetChanges)
+	apiRouter.Delete("/staged", requireFilesWrite, stagingHandler.DeleteChanges)
+	apiRouter.Get("/staged/:id", requireFilesRead, stagingHandler.GetChange)
+	apiRouter.Get("/staged/:id/diff", requireFilesRead, stagingHandler.GetDiff)
+	apiRouter.Delete("/staged/:id", requireFilesWrite, stagingHandler.DeleteChange)
+	apiRouter.Get("/mc/state", handlers.RequireScope(auth.ScopeStateRead), mcrunnerHandler.GetState)
+	apiRouter.Post("/mc/command", handlers.RequireScope(auth.ScopeConsoleWrite), mcrunnerHandler.PostCommand)
+	apiRouter.Get("/mc/properties", requireFilesRead, propertiesHandler.GetProperties)
+	apiRouter.Patch("/mc/properties", requireFilesWrite, propertiesHandler.PatchProperties)
+	apiRouter.Get("/mc/lists/:list", handlers.RequireScope(auth.ScopeStateRead), playersHandler.GetList)
+	apiRouter.Post("/mc/lists/:list", handlers.RequireScope(auth.ScopeConsoleWrite), playersHandler.PostEntry)
+	apiRouter.Delete("/mc/lists/:list/:player", handlers.RequireScope(auth.ScopeConsoleWrite), playersHandler.DeleteEntry)
+	apiRouter.Post("/mc/start", requireLifecycle, mcrunnerHandler.PostStartServer)
+	apiRouter.Post("/mc/stop", requireLifecycle, mcrunnerHandler.PostStopServer)
+	apiRouter.Post("/mc/restart", requireLifecycle, mcrunnerHandler.PostRestartServer)
+	apiRouter.Post("/mc/kill", requireLifecycle, mcrunnerHandler.PostKillServer)
+	if tokenStore != nil {
+		tokensHandler := handlers.NewTokensHandler(tokenStore)
+		tokensRouter := apiRouter.Group("/tokens", handlers.RequireScope(auth.ScopeAdmin))
+		tokensRouter.Get("/", tokensHandler.GetTokens)
+		tokensRouter.Post("/", tokensHandler.PostToken)
+		tokensRouter.Delete("/:id", tokensHandler.DeleteToken)
+	}
 	router.Post("/auth/login", mcagentHandler.PostAuthLogin)
 	router.Post("/auth/logout", mcagentHandler.PostAuthLogout)
 	router.Get("/livez", func(c *fiber.Ctx) error {
@@ -295,7 +780,9 @@ func run(cli *cli.Context) error {
 	})
 
 	mcrunnerSvc := service.NewMCRunnerService(mcserverCmd, mcagent)
-	grpcServer := grpc.NewServer(
+	filesSvc := service.NewFilesService(localFilesSvc, watcher)
+	playersSvc := service.NewPlayersService(playersManager)
+	grpcOpts := []grpc.ServerOption{
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			MaxConnectionIdle: 0,
 			Time:              1 * time.Minute,  // ping every 60s
@@ -305,9 +792,33 @@ func run(cli *cli.Context) error {
 			MinTime:             30 * time.Second, // clients must wait at least this between pings
 			PermitWithoutStream: true,             // allow pings even with no active RPC
 		}),
-		grpcAuthInterceptor(secretKey),
-	)
+	}
+	var tlsConfig *tls.Config
+	if certReloader != nil {
+		tlsConfig = certReloader.ServerConfig(cli.Bool(tlsRequireClientCertFlag.Name))
+		if gprcListenAddr == httpListenAddr {
+			grpcOpts = append(grpcOpts, grpc.Creds(tlsutil.TerminatedTLSCredentials()))
+		} else {
+			grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+	}
+	grpcOpts = append(grpcOpts, service.AuthServerOptions(authenticator)...)
+	grpcServer := grpc.NewServer(grpcOpts...)
 	pb.RegisterMCRunnerServer(grpcServer, mcrunnerSvc)
+	pb.RegisterFilesServer(grpcServer, filesSvc)
+	pb.RegisterPlayersServer(grpcServer, playersSvc)
+
+	// serve the same services to browsers over gRPC-Web and Connect
+	grpcWebHandler := grpcweb.NewHandler(
+		grpcweb.WithUnaryInterceptor(service.UnaryAuthInterceptor(authenticator)),
+		grpcweb.WithStreamInterceptor(service.StreamAuthInterceptor(authenticator)),
+	)
+	pb.RegisterMCRunnerServer(grpcWebHandler, mcrunnerSvc)
+	pb.RegisterFilesServer(grpcWebHandler, filesSvc)
+	pb.RegisterPlayersServer(grpcWebHandler, playersSvc)
+	router.Post("/MCRunner/:method", grpcWebHandler.Handle)
+	router.Post("/Files/:method", grpcWebHandler.Handle)
+	router.Post("/Players/:method", grpcWebHandler.Handle)
 
 	// Handle signals: first triggers graceful shutdown, second forces exit
 	sigCh := make(chan os.Signal, 1)
@@ -324,6 +835,30 @@ func run(cli *cli.Context) error {
 		os.Exit(143)
 	}()
 
+	// SIGHUP reloads the TLS certificates and JWT keys
+	if certReloader != nil || jwtVerifier != nil {
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		go func() {
+			for range hupCh {
+				if certReloader != nil {
+					if err := certReloader.Reload(); err != nil {
+						logger.Errorln("Failed to reload TLS certificates", "error", err)
+					} else {
+						logger.Println("Reloaded TLS certificates")
+					}
+				}
+				if jwtVerifier != nil {
+					if err := jwtVerifier.Reload(); err != nil {
+						logger.Errorln("Failed to reload JWT keys", "error", err)
+					} else {
+						logger.Println("Reloaded JWT keys")
+					}
+				}
+			}
+		}()
+	}
+
 	// start the mcserver command
 	if err := mcserverCmd.Start(); err != nil {
 		return fmt.Errorf("failed to start Minecraft server command: %v", err)
@@ -332,12 +867,25 @@ func run(cli *cli.Context) error {
 		io.Copy(mcserverCmd, os.Stdin)
 	}()
 
-	grpcListener, httpListener, err := initListeners(gprcListenAddr, httpListenAddr)
+	grpcListener, httpListener, err := initListeners(gprcListenAddr, httpListenAddr, tlsConfig)
 	if err != nil {
 		return err
 	}
 
 	errCh := make(chan error)
+	if sftpServer != nil {
+		sftpListenAddr := cli.String(sftpListenFlag.Name)
+		sftpListener, err := net.Listen("tcp", sftpListenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on SFTP address %s: %v", sftpListenAddr, err)
+		}
+		go func() {
+			fmt.Printf("Listening SFTP at %s\n", sftpListenAddr)
+			if err := sftpServer.Serve(sftpListener); err != nil {
+				errCh <- fmt.Errorf("SFTP server error: %v", err)
+			}
+		}()
+	}
 	go func() {
 		fmt.Printf("Listening gRPC at %s\n", gprcListenAddr)
 		if err := grpcServer.Serve(grpcListener); err != nil {
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+type clientOptions struct {
+	tlsConfig *tls.Config
+	token     string
+}
+
+// ClientOption configures the HTTP and gRPC API clients.
+type ClientOption func(*clientOptions)
+
+// WithTLSConfig enables TLS using cfg. Set cfg.Certificates to present a
+// client certificate for mutual TLS.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithToken authenticates every request with the given API token.
+func WithToken(token string) ClientOption {
+	return func(o *clientOptions) {
+		o.token = token
+	}
+}
+
+func newClientOptions(opts []ClientOption) *clientOptions {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// LoadClientTLSConfig builds a client TLS config. caFile verifies the server
+// certificate (system roots are used when empty), and certFile/keyFile are
+// the optional client certificate for mutual TLS.
+func LoadClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both client certificate and key files are required")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// newHTTPClient returns the HTTP client used by the REST API clients.
+func newHTTPClient(o *clientOptions) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if o.tlsConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = o.tlsConfig
+		transport = t
+	}
+	if o.token != "" {
+		transport = &bearerTransport{token: o.token, base: transport}
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
+
+// bearerTransport adds the Authorization header to outgoing requests.
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// tokenCredentials implements credentials.PerRPCCredentials for gRPC calls.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+)
+
+// uploadChunkSize is the size of the content chunks sent by UploadFile.
+const uploadChunkSize = 64 << 10
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+func (c *MCRunnerGRPC) StatFile(ctx context.Context, path string) (*pb.FileInfo, error) {
+	return c.files.Stat(ctx, &pb.FilePath{Path: path})
+}
+
+func (c *MCRunnerGRPC) ListFiles(ctx context.Context, path string) ([]*pb.FileInfo, error) {
+	list, err := c.files.List(ctx, &pb.FilePath{Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return list.Entries, nil
+}
+
+func (c *MCRunnerGRPC) MakeDir(ctx context.Context, path string) error {
+	_, err := c.files.Mkdir(ctx, &pb.FilePath{Path: path})
+	return err
+}
+
+func (c *MCRunnerGRPC) RenameFile(ctx context.Context, path string, newPath string, overwrite bool) error {
+	_, err := c.files.Rename(ctx, &pb.RenameRequest{
+		Path:      path,
+		NewPath:   newPath,
+		Overwrite: overwrite,
+	})
+	return err
+}
+
+func (c *MCRunnerGRPC) DeleteFile(ctx context.Context, path string, recursive bool) error {
+	_, err := c.files.Delete(ctx, &pb.DeleteRequest{
+		Path:      path,
+		Recursive: recursive,
+	})
+	return err
+}
+
+// UploadFile streams r to path on the server. The server only replaces the
+// file when the content matches the checksum sent after the last chunk.
+func (c *MCRunnerGRPC) UploadFile(ctx context.Context, path string, r io.Reader, overwrite bool) (*pb.FileInfo, error) {
+	stream, err := c.files.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := &pb.UploadRequest{
+		Payload: &pb.UploadRequest_Header{
+			Header: &pb.UploadHeader{Path: path, Overwrite: overwrite},
+		},
+	}
+	if err := stream.Send(header); err != nil {
+		_, err = stream.CloseAndRecv()
+		return nil, err
+	}
+
+	h := sha256.New()
+	buf := make([]byte, uploadChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			chunk := &pb.UploadRequest{Payload: &pb.UploadRequest_Chunk{Chunk: buf[:n]}}
+			if err := stream.Send(chunk); err != nil {
+				// the server aborted the call, the actual error is returned by CloseAndRecv
+				_, err = stream.CloseAndRecv()
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	checksum := &pb.UploadRequest{
+		Payload: &pb.UploadRequest_Checksum{Checksum: &pb.FileChecksum{Sha256: sum}},
+	}
+	if err := stream.Send(checksum); err != nil {
+		_, err = stream.CloseAndRecv()
+		return nil, err
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Sha256 != sum {
+		return nil, fmt.Errorf("%w: sent %s, server stored %s", ErrChecksumMismatch, sum, resp.Sha256)
+	}
+	return resp.File, nil
+}
+
+// DownloadFile streams the file at path into w and verifies its checksum.
+func (c *MCRunnerGRPC) DownloadFile(ctx context.Context, path string, w io.Writer) (*pb.FileInfo, error) {
+	stream, err := c.files.Download(ctx, &pb.DownloadRequest{Path: path})
+	if err != nil {
+		return nil, err
+	}
+
+	var info *pb.FileInfo
+	h := sha256.New()
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("download of %s ended without checksum", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch payload := msg.Payload.(type) {
+		case *pb.DownloadResponse_File:
+			info = payload.File
+		case *pb.DownloadResponse_Chunk:
+			h.Write(payload.Chunk)
+			if _, err := w.Write(payload.Chunk); err != nil {
+				return nil, err
+			}
+		case *pb.DownloadResponse_Checksum:
+			if sum := hex.EncodeToString(h.Sum(nil)); sum != payload.Checksum.Sha256 {
+				return nil, fmt.Errorf("%w: expected %s, received %s", ErrChecksumMismatch, payload.Checksum.Sha256, sum)
+			}
+			return info, nil
+		}
+	}
+}
+
+// WatchFiles calls fn for every change below the directory at path until ctx
+// is done or fn returns an error.
+func (c *MCRunnerGRPC) WatchFiles(ctx context.Context, path string, fn func(*pb.FileEvent) error) error {
+	stream, err := c.files.Watch(ctx, &pb.FilePath{Path: path})
+	if err != nil {
+		return err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"net/http"
-	"time"
 )
 
 type FileSystemAPI struct {
@@ -10,11 +9,9 @@ type FileSystemAPI struct {
 	httpClient *http.Client
 }
 
-func NewFileSystemAPI(baseURL string) *FileSystemAPI {
+func NewFileSystemAPI(baseURL string, opts ...ClientOption) *FileSystemAPI {
 	return &FileSystemAPI{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		baseURL:    baseURL,
+		httpClient: newHTTPClient(newClientOptions(opts)),
 	}
 }
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 )
 
 type ServerStatus string
@@ -49,6 +48,8 @@ type ServerState struct {
 	CPULimit    *float64     `json:"cpuLimit,omitempty"`    // max CPUs allowed
 	DiskUsage   *uint64      `json:"diskUsage,omitempty"`   // current disk usage in bytes
 	DiskSize    *uint64      `json:"diskSize,omitempty"`    // disk size in bytes
+	DataUsage   *uint64      `json:"dataUsage,omitempty"`   // bytes used by the files in the server directory
+	DataQuota   *uint64      `json:"dataQuota,omitempty"`   // quota of the server directory in bytes (0 = unlimited)
 	UptimeSec   uint64       `json:"uptimeSec,omitempty"`   // server uptime in seconds
 	Server      *ServerInfo  `json:"server,omitempty"`      // Minecraft server info
 }
@@ -66,12 +67,10 @@ type CommandRequest struct {
 }
 
 // NewMCRunnerAPI creates a new MCRunner API client
-func NewMCRunnerAPI(baseURL string) *MCRunnerAPI {
+func NewMCRunnerAPI(baseURL string, opts ...ClientOption) *MCRunnerAPI {
 	return &MCRunnerAPI{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		baseURL:    baseURL,
+		httpClient: newHTTPClient(newClientOptions(opts)),
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	pb "github.com/khanghh/mcrunner/pkg/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/resolver"
@@ -22,8 +23,10 @@ func init() {
 type ConsoleMessageHandler func(msg *pb.ConsoleMessage)
 
 type MCRunnerGRPC struct {
-	conn *grpc.ClientConn
-	cl   pb.MCRunnerClient
+	conn    *grpc.ClientConn
+	cl      pb.MCRunnerClient
+	files   pb.FilesClient
+	players pb.PlayersClient
 }
 
 func (c *MCRunnerGRPC) StartServer(ctx context.Context) error {
@@ -177,9 +180,16 @@ func (c *MCRunnerGRPC) Close() error {
 	return c.conn.Close()
 }
 
-func NewMCRunnerGRPC(addr string) (*MCRunnerGRPC, error) {
-	conn, err := grpc.NewClient(addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+// NewMCRunnerGRPC connects to the gRPC API at addr. Without WithTLSConfig the
+// connection is plaintext.
+func NewMCRunnerGRPC(addr string, opts ...ClientOption) (*MCRunnerGRPC, error) {
+	o := newClientOptions(opts)
+	transportCreds := insecure.NewCredentials()
+	if o.tlsConfig != nil {
+		transportCreds = credentials.NewTLS(o.tlsConfig)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCreds),
 		grpc.WithConnectParams(grpc.ConnectParams{
 			Backoff: backoff.Config{
 				BaseDelay:  time.Second,
@@ -192,12 +202,21 @@ func NewMCRunnerGRPC(addr string) (*MCRunnerGRPC, error) {
 			Time:    30 * time.Second, // ping interval
 			Timeout: 10 * time.Second, // ping ack timeout
 		}),
-	)
+	}
+	if o.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(&tokenCredentials{
+			token:  o.token,
+			secure: o.tlsConfig != nil,
+		}))
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return &MCRunnerGRPC{
-		conn: conn,
-		cl:   pb.NewMCRunnerClient(conn),
+		conn:    conn,
+		cl:      pb.NewMCRunnerClient(conn),
+		files:   pb.NewFilesClient(conn),
+		players: pb.NewPlayersClient(conn),
 	}, nil
 }
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"context"
+
+	pb "github.com/khanghh/mcrunner/pkg/proto"
+)
+
+func (c *MCRunnerGRPC) ListPlayers(ctx context.Context, list pb.PlayerList) ([]*pb.PlayerEntry, error) {
+	entries, err := c.players.List(ctx, &pb.PlayerListRequest{List: list})
+	if err != nil {
+		return nil, err
+	}
+	return entries.Entries, nil
+}
+
+// AddPlayer adds entry to list. The change reports whether it was sent to the
+// running server as a console command.
+func (c *MCRunnerGRPC) AddPlayer(ctx context.Context, list pb.PlayerList, entry *pb.PlayerEntry) (*pb.PlayerChange, error) {
+	return c.players.Add(ctx, &pb.AddPlayerRequest{List: list, Entry: entry})
+}
+
+// RemovePlayer removes the entry of player, a name, UUID or IP, from list.
+func (c *MCRunnerGRPC) RemovePlayer(ctx context.Context, list pb.PlayerList, player string) (*pb.PlayerChange, error) {
+	return c.players.Remove(ctx, &pb.RemovePlayerRequest{List: list, Player: player})
+}
@@ -1,3 +1,3 @@
 package proto
 
-//go:generate protoc --proto_path=../../proto --go-grpc_out=. --go_out=. --go_opt=paths=source_relative --go-grpc_opt=paths=source_relative mcrunner.proto
+//go:generate protoc --proto_path=../../proto --go-grpc_out=. --go_out=. --go_opt=paths=source_relative --go-grpc_opt=paths=source_relative mcrunner.proto files.proto players.proto
@@ -278,6 +278,13 @@ type ServerState struct {
 	CpuLimit      float64                `protobuf:"fixed64,8,opt,name=cpu_limit,json=cpuLimit,proto3" json:"cpu_limit,omitempty"`
 	DiskUsage     uint64                 `protobuf:"varint,9,opt,name=disk_usage,json=diskUsage,proto3" json:"disk_usage,omitempty"`
 	DiskSize      uint64                 `protobuf:"varint,10,opt,name=disk_size,json=diskSize,proto3" json:"disk_size,omitempty"`
+	IpAddress     string                 `protobuf:"bytes,11,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
+	ServerName    string                 `protobuf:"bytes,12,opt,name=server_name,json=serverName,proto3" json:"server_name,omitempty"`
+	ServerVersion string                 `protobuf:"bytes,13,opt,name=server_version,json=serverVersion,proto3" json:"server_version,omitempty"`
+	PlayersOnline int32                  `protobuf:"varint,14,opt,name=players_online,json=playersOnline,proto3" json:"players_online,omitempty"`
+	PlayersMax    int32                  `protobuf:"varint,15,opt,name=players_max,json=playersMax,proto3" json:"players_max,omitempty"`
+	DataUsage     uint64                 `protobuf:"varint,16,opt,name=data_usage,json=dataUsage,proto3" json:"data_usage,omitempty"`
+	DataQuota     uint64                 `protobuf:"varint,17,opt,name=data_quota,json=dataQuota,proto3" json:"data_quota,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -382,6 +389,55 @@ func (x *ServerState) GetDiskSize() uint64 {
 	return 0
 }
 
+func (x *ServerState) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *ServerState) GetServerName() string {
+	if x != nil {
+		return x.ServerName
+	}
+	return ""
+}
+
+func (x *ServerState) GetServerVersion() string {
+	if x != nil {
+		return x.ServerVersion
+	}
+	return ""
+}
+
+func (x *ServerState) GetPlayersOnline() int32 {
+	if x != nil {
+		return x.PlayersOnline
+	}
+	return 0
+}
+
+func (x *ServerState) GetPlayersMax() int32 {
+	if x != nil {
+		return x.PlayersMax
+	}
+	return 0
+}
+
+func (x *ServerState) GetDataUsage() uint64 {
+	if x != nil {
+		return x.DataUsage
+	}
+	return 0
+}
+
+func (x *ServerState) GetDataQuota() uint64 {
+	if x != nil {
+		return x.DataQuota
+	}
+	return 0
+}
+
 // ConsoleMessage multiplexes PTY data and resize events in a single bidi stream
 type ConsoleMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -555,7 +611,7 @@ const file_mcrunner_proto_rawDesc = "" +
 	"\x06status\x18\x02 \x01(\x0e2\a.StatusR\x06status\"8\n" +
 	"\bPtyError\x12\x12\n" +
 	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage\"\xad\x02\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x9a\x04\n" +
 	"\vServerState\x12\x1f\n" +
 	"\x06status\x18\x01 \x01(\x0e2\a.StatusR\x06status\x12\x10\n" +
 	"\x03pid\x18\x02 \x01(\x05R\x03pid\x12\x10\n" +
@@ -569,7 +625,19 @@ const file_mcrunner_proto_rawDesc = "" +
 	"\n" +
 	"disk_usage\x18\t \x01(\x04R\tdiskUsage\x12\x1b\n" +
 	"\tdisk_size\x18\n" +
-	" \x01(\x04R\bdiskSize\"\xcc\x01\n" +
+	" \x01(\x04R\bdiskSize\x12\x1d\n" +
+	"\n" +
+	"ip_address\x18\v \x01(\tR\tipAddress\x12\x1f\n" +
+	"\vserver_name\x18\f \x01(\tR\n" +
+	"serverName\x12%\n" +
+	"\x0eserver_version\x18\r \x01(\tR\rserverVersion\x12%\n" +
+	"\x0eplayers_online\x18\x0e \x01(\x05R\rplayersOnline\x12\x1f\n" +
+	"\vplayers_max\x18\x0f \x01(\x05R\n" +
+	"playersMax\x12\x1d\n" +
+	"\n" +
+	"data_usage\x18\x10 \x01(\x04R\tdataUsage\x12\x1d\n" +
+	"\n" +
+	"data_quota\x18\x11 \x01(\x04R\tdataQuota\"\xcc\x01\n" +
 	"\x0eConsoleMessage\x12(\n" +
 	"\tpty_error\x18\x01 \x01(\v2\t.PtyErrorH\x00R\bptyError\x12+\n" +
 	"\n" +
@@ -588,7 +656,7 @@ const file_mcrunner_proto_rawDesc = "" +
 	"\x0eSTATUS_UNKNOWN\x10\x00\x12\x12\n" +
 	"\x0eSTATUS_RUNNING\x10\x01\x12\x13\n" +
 	"\x0fSTATUS_STOPPING\x10\x02\x12\x12\n" +
-	"\x0eSTATUS_STOPPED\x10\x032\x93\x04\n" +
+	"\x0eSTATUS_STOPPED\x10\x032\x87\x05\n" +
 	"\bMCRunner\x12=\n" +
 	"\vStartServer\x12\x16.google.protobuf.Empty\x1a\x16.google.protobuf.Empty\x12<\n" +
 	"\n" +
@@ -601,7 +669,9 @@ const file_mcrunner_proto_rawDesc = "" +
 	"\rResizeConsole\x12\n" +
 	".PtyResize\x1a\x16.google.protobuf.Empty\x125\n" +
 	"\rStreamConsole\x12\x0f.ConsoleMessage\x1a\x0f.ConsoleMessage(\x010\x01\x125\n" +
-	"\vStreamState\x12\x16.google.protobuf.Empty\x1a\f.ServerState0\x01B-Z+github.com/khanghh/mcrunner/pkg/proto;protob\x06proto3"
+	"\vStreamState\x12\x16.google.protobuf.Empty\x1a\f.ServerState0\x01\x129\n" +
+	"\fWatchConsole\x12\x16.google.protobuf.Empty\x1a\x0f.ConsoleMessage0\x01\x127\n" +
+	"\fWriteConsole\x12\x0f.ConsoleMessage\x1a\x16.google.protobuf.EmptyB-Z+github.com/khanghh/mcrunner/pkg/proto;protob\x06proto3"
 
 var (
 	file_mcrunner_proto_rawDescOnce sync.Once
@@ -644,17 +714,21 @@ var file_mcrunner_proto_depIdxs = []int32{
 	2,  // 12: MCRunner.ResizeConsole:input_type -> PtyResize
 	6,  // 13: MCRunner.StreamConsole:input_type -> ConsoleMessage
 	8,  // 14: MCRunner.StreamState:input_type -> google.protobuf.Empty
-	8,  // 15: MCRunner.StartServer:output_type -> google.protobuf.Empty
-	8,  // 16: MCRunner.StopServer:output_type -> google.protobuf.Empty
-	8,  // 17: MCRunner.KillServer:output_type -> google.protobuf.Empty
-	8,  // 18: MCRunner.RestartServer:output_type -> google.protobuf.Empty
-	5,  // 19: MCRunner.GetState:output_type -> ServerState
-	8,  // 20: MCRunner.SendCommand:output_type -> google.protobuf.Empty
-	8,  // 21: MCRunner.ResizeConsole:output_type -> google.protobuf.Empty
-	6,  // 22: MCRunner.StreamConsole:output_type -> ConsoleMessage
-	5,  // 23: MCRunner.StreamState:output_type -> ServerState
-	15, // [15:24] is the sub-list for method output_type
-	6,  // [6:15] is the sub-list for method input_type
+	8,  // 15: MCRunner.WatchConsole:input_type -> google.protobuf.Empty
+	6,  // 16: MCRunner.WriteConsole:input_type -> ConsoleMessage
+	8,  // 17: MCRunner.StartServer:output_type -> google.protobuf.Empty
+	8,  // 18: MCRunner.StopServer:output_type -> google.protobuf.Empty
+	8,  // 19: MCRunner.KillServer:output_type -> google.protobuf.Empty
+	8,  // 20: MCRunner.RestartServer:output_type -> google.protobuf.Empty
+	5,  // 21: MCRunner.GetState:output_type -> ServerState
+	8,  // 22: MCRunner.SendCommand:output_type -> google.protobuf.Empty
+	8,  // 23: MCRunner.ResizeConsole:output_type -> google.protobuf.Empty
+	6,  // 24: MCRunner.StreamConsole:output_type -> ConsoleMessage
+	5,  // 25: MCRunner.StreamState:output_type -> ServerState
+	6,  // 26: MCRunner.WatchConsole:output_type -> ConsoleMessage
+	8,  // 27: MCRunner.WriteConsole:output_type -> google.protobuf.Empty
+	17, // [17:28] is the sub-list for method output_type
+	6,  // [6:17] is the sub-list for method input_type
 	6,  // [6:6] is the sub-list for extension type_name
 	6,  // [6:6] is the sub-list for extension extendee
 	0,  // [0:6] is the sub-list for field type_name
@@ -29,6 +29,8 @@ const (
 	MCRunner_ResizeConsole_FullMethodName = "/MCRunner/ResizeConsole"
 	MCRunner_StreamConsole_FullMethodName = "/MCRunner/StreamConsole"
 	MCRunner_StreamState_FullMethodName   = "/MCRunner/StreamState"
+	MCRunner_WatchConsole_FullMethodName  = "/MCRunner/WatchConsole"
+	MCRunner_WriteConsole_FullMethodName  = "/MCRunner/WriteConsole"
 )
 
 // MCRunnerClient is the client API for MCRunner service.
@@ -50,6 +52,10 @@ type MCRunnerClient interface {
 	// Streams live console output and state
 	StreamConsole(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConsoleMessage, ConsoleMessage], error)
 	StreamState(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServerState], error)
+	// Half-duplex console for clients without bidi streaming (gRPC-Web, Connect):
+	// output is streamed by WatchConsole and input is sent with WriteConsole
+	WatchConsole(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsoleMessage], error)
+	WriteConsole(ctx context.Context, in *ConsoleMessage, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type mCRunnerClient struct {
@@ -162,6 +168,35 @@ func (c *mCRunnerClient) StreamState(ctx context.Context, in *emptypb.Empty, opt
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MCRunner_StreamStateClient = grpc.ServerStreamingClient[ServerState]
 
+func (c *mCRunnerClient) WatchConsole(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConsoleMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MCRunner_ServiceDesc.Streams[2], MCRunner_WatchConsole_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[emptypb.Empty, ConsoleMessage]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MCRunner_WatchConsoleClient = grpc.ServerStreamingClient[ConsoleMessage]
+
+func (c *mCRunnerClient) WriteConsole(ctx context.Context, in *ConsoleMessage, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, MCRunner_WriteConsole_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MCRunnerServer is the server API for MCRunner service.
 // All implementations must embed UnimplementedMCRunnerServer
 // for forward compatibility.
@@ -181,6 +216,10 @@ type MCRunnerServer interface {
 	// Streams live console output and state
 	StreamConsole(grpc.BidiStreamingServer[ConsoleMessage, ConsoleMessage]) error
 	StreamState(*emptypb.Empty, grpc.ServerStreamingServer[ServerState]) error
+	// Half-duplex console for clients without bidi streaming (gRPC-Web, Connect):
+	// output is streamed by WatchConsole and input is sent with WriteConsole
+	WatchConsole(*emptypb.Empty, grpc.ServerStreamingServer[ConsoleMessage]) error
+	WriteConsole(context.Context, *ConsoleMessage) (*emptypb.Empty, error)
 	mustEmbedUnimplementedMCRunnerServer()
 }
 
@@ -218,6 +257,12 @@ func (UnimplementedMCRunnerServer) StreamConsole(grpc.BidiStreamingServer[Consol
 func (UnimplementedMCRunnerServer) StreamState(*emptypb.Empty, grpc.ServerStreamingServer[ServerState]) error {
 	return status.Errorf(codes.Unimplemented, "method StreamState not implemented")
 }
+func (UnimplementedMCRunnerServer) WatchConsole(*emptypb.Empty, grpc.ServerStreamingServer[ConsoleMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchConsole not implemented")
+}
+func (UnimplementedMCRunnerServer) WriteConsole(context.Context, *ConsoleMessage) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteConsole not implemented")
+}
 func (UnimplementedMCRunnerServer) mustEmbedUnimplementedMCRunnerServer() {}
 func (UnimplementedMCRunnerServer) testEmbeddedByValue()                  {}
 
@@ -383,6 +428,35 @@ func _MCRunner_StreamState_Handler(srv interface{}, stream grpc.ServerStream) er
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MCRunner_StreamStateServer = grpc.ServerStreamingServer[ServerState]
 
+func _MCRunner_WatchConsole_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MCRunnerServer).WatchConsole(m, &grpc.GenericServerStream[emptypb.Empty, ConsoleMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MCRunner_WatchConsoleServer = grpc.ServerStreamingServer[ConsoleMessage]
+
+func _MCRunner_WriteConsole_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConsoleMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MCRunnerServer).WriteConsole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MCRunner_WriteConsole_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MCRunnerServer).WriteConsole(ctx, req.(*ConsoleMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MCRunner_ServiceDesc is the grpc.ServiceDesc for MCRunner service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -418,6 +492,10 @@ var MCRunner_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ResizeConsole",
 			Handler:    _MCRunner_ResizeConsole_Handler,
 		},
+		{
+			MethodName: "WriteConsole",
+			Handler:    _MCRunner_WriteConsole_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -431,6 +509,11 @@ var MCRunner_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _MCRunner_StreamState_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchConsole",
+			Handler:       _MCRunner_WatchConsole_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "mcrunner.proto",
 }
@@ -0,0 +1,540 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.32.1
+// source: players.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PlayerList int32
+
+const (
+	PlayerList_PLAYER_LIST_UNKNOWN        PlayerList = 0
+	PlayerList_PLAYER_LIST_WHITELIST      PlayerList = 1
+	PlayerList_PLAYER_LIST_OPS            PlayerList = 2
+	PlayerList_PLAYER_LIST_BANNED_PLAYERS PlayerList = 3
+	PlayerList_PLAYER_LIST_BANNED_IPS     PlayerList = 4
+)
+
+// Enum value maps for PlayerList.
+var (
+	PlayerList_name = map[int32]string{
+		0: "PLAYER_LIST_UNKNOWN",
+		1: "PLAYER_LIST_WHITELIST",
+		2: "PLAYER_LIST_OPS",
+		3: "PLAYER_LIST_BANNED_PLAYERS",
+		4: "PLAYER_LIST_BANNED_IPS",
+	}
+	PlayerList_value = map[string]int32{
+		"PLAYER_LIST_UNKNOWN":        0,
+		"PLAYER_LIST_WHITELIST":      1,
+		"PLAYER_LIST_OPS":            2,
+		"PLAYER_LIST_BANNED_PLAYERS": 3,
+		"PLAYER_LIST_BANNED_IPS":     4,
+	}
+)
+
+func (x PlayerList) Enum() *PlayerList {
+	p := new(PlayerList)
+	*p = x
+	return p
+}
+
+func (x PlayerList) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PlayerList) Descriptor() protoreflect.EnumDescriptor {
+	return file_players_proto_enumTypes[0].Descriptor()
+}
+
+func (PlayerList) Type() protoreflect.EnumType {
+	return &file_players_proto_enumTypes[0]
+}
+
+func (x PlayerList) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PlayerList.Descriptor instead.
+func (PlayerList) EnumDescriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{0}
+}
+
+// PlayerEntry is an entry of a list. Players are identified by uuid and name,
+// banned addresses by ip; level and bypasses_player_limit belong to
+// operators, the remaining fields to bans.
+type PlayerEntry struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Uuid                string                 `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Name                string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Ip                  string                 `protobuf:"bytes,3,opt,name=ip,proto3" json:"ip,omitempty"`
+	Level               int32                  `protobuf:"varint,4,opt,name=level,proto3" json:"level,omitempty"`
+	BypassesPlayerLimit bool                   `protobuf:"varint,5,opt,name=bypasses_player_limit,json=bypassesPlayerLimit,proto3" json:"bypasses_player_limit,omitempty"`
+	Created             string                 `protobuf:"bytes,6,opt,name=created,proto3" json:"created,omitempty"` // "2006-01-02 15:04:05 -0700" like the server writes it
+	Source              string                 `protobuf:"bytes,7,opt,name=source,proto3" json:"source,omitempty"`
+	Expires             string                 `protobuf:"bytes,8,opt,name=expires,proto3" json:"expires,omitempty"` // "forever", RFC 3339 or the format of created
+	Reason              string                 `protobuf:"bytes,9,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *PlayerEntry) Reset() {
+	*x = PlayerEntry{}
+	mi := &file_players_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerEntry) ProtoMessage() {}
+
+func (x *PlayerEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerEntry.ProtoReflect.Descriptor instead.
+func (*PlayerEntry) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PlayerEntry) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *PlayerEntry) GetBypassesPlayerLimit() bool {
+	if x != nil {
+		return x.BypassesPlayerLimit
+	}
+	return false
+}
+
+func (x *PlayerEntry) GetCreated() string {
+	if x != nil {
+		return x.Created
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetExpires() string {
+	if x != nil {
+		return x.Expires
+	}
+	return ""
+}
+
+func (x *PlayerEntry) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type PlayerListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	List          PlayerList             `protobuf:"varint,1,opt,name=list,proto3,enum=PlayerList" json:"list,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerListRequest) Reset() {
+	*x = PlayerListRequest{}
+	mi := &file_players_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerListRequest) ProtoMessage() {}
+
+func (x *PlayerListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerListRequest.ProtoReflect.Descriptor instead.
+func (*PlayerListRequest) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PlayerListRequest) GetList() PlayerList {
+	if x != nil {
+		return x.List
+	}
+	return PlayerList_PLAYER_LIST_UNKNOWN
+}
+
+type PlayerEntries struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*PlayerEntry         `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerEntries) Reset() {
+	*x = PlayerEntries{}
+	mi := &file_players_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerEntries) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerEntries) ProtoMessage() {}
+
+func (x *PlayerEntries) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerEntries.ProtoReflect.Descriptor instead.
+func (*PlayerEntries) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PlayerEntries) GetEntries() []*PlayerEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type AddPlayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	List          PlayerList             `protobuf:"varint,1,opt,name=list,proto3,enum=PlayerList" json:"list,omitempty"`
+	Entry         *PlayerEntry           `protobuf:"bytes,2,opt,name=entry,proto3" json:"entry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddPlayerRequest) Reset() {
+	*x = AddPlayerRequest{}
+	mi := &file_players_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddPlayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddPlayerRequest) ProtoMessage() {}
+
+func (x *AddPlayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddPlayerRequest.ProtoReflect.Descriptor instead.
+func (*AddPlayerRequest) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AddPlayerRequest) GetList() PlayerList {
+	if x != nil {
+		return x.List
+	}
+	return PlayerList_PLAYER_LIST_UNKNOWN
+}
+
+func (x *AddPlayerRequest) GetEntry() *PlayerEntry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+type RemovePlayerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	List          PlayerList             `protobuf:"varint,1,opt,name=list,proto3,enum=PlayerList" json:"list,omitempty"`
+	Player        string                 `protobuf:"bytes,2,opt,name=player,proto3" json:"player,omitempty"` // name, uuid or ip
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemovePlayerRequest) Reset() {
+	*x = RemovePlayerRequest{}
+	mi := &file_players_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemovePlayerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemovePlayerRequest) ProtoMessage() {}
+
+func (x *RemovePlayerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemovePlayerRequest.ProtoReflect.Descriptor instead.
+func (*RemovePlayerRequest) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RemovePlayerRequest) GetList() PlayerList {
+	if x != nil {
+		return x.List
+	}
+	return PlayerList_PLAYER_LIST_UNKNOWN
+}
+
+func (x *RemovePlayerRequest) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+type PlayerChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entry         *PlayerEntry           `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	Console       bool                   `protobuf:"varint,2,opt,name=console,proto3" json:"console,omitempty"` // sent to the running server as a command
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlayerChange) Reset() {
+	*x = PlayerChange{}
+	mi := &file_players_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlayerChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlayerChange) ProtoMessage() {}
+
+func (x *PlayerChange) ProtoReflect() protoreflect.Message {
+	mi := &file_players_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlayerChange.ProtoReflect.Descriptor instead.
+func (*PlayerChange) Descriptor() ([]byte, []int) {
+	return file_players_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PlayerChange) GetEntry() *PlayerEntry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+func (x *PlayerChange) GetConsole() bool {
+	if x != nil {
+		return x.Console
+	}
+	return false
+}
+
+var File_players_proto protoreflect.FileDescriptor
+
+const file_players_proto_rawDesc = "" +
+	"\n" +
+	"\rplayers.proto\"\xf3\x01\n" +
+	"\vPlayerEntry\x12\x12\n" +
+	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ip\x18\x03 \x01(\tR\x02ip\x12\x14\n" +
+	"\x05level\x18\x04 \x01(\x05R\x05level\x122\n" +
+	"\x15bypasses_player_limit\x18\x05 \x01(\bR\x13bypassesPlayerLimit\x12\x18\n" +
+	"\acreated\x18\x06 \x01(\tR\acreated\x12\x16\n" +
+	"\x06source\x18\a \x01(\tR\x06source\x12\x18\n" +
+	"\aexpires\x18\b \x01(\tR\aexpires\x12\x16\n" +
+	"\x06reason\x18\t \x01(\tR\x06reason\"4\n" +
+	"\x11PlayerListRequest\x12\x1f\n" +
+	"\x04list\x18\x01 \x01(\x0e2\v.PlayerListR\x04list\"7\n" +
+	"\rPlayerEntries\x12&\n" +
+	"\aentries\x18\x01 \x03(\v2\f.PlayerEntryR\aentries\"W\n" +
+	"\x10AddPlayerRequest\x12\x1f\n" +
+	"\x04list\x18\x01 \x01(\x0e2\v.PlayerListR\x04list\x12\"\n" +
+	"\x05entry\x18\x02 \x01(\v2\f.PlayerEntryR\x05entry\"N\n" +
+	"\x13RemovePlayerRequest\x12\x1f\n" +
+	"\x04list\x18\x01 \x01(\x0e2\v.PlayerListR\x04list\x12\x16\n" +
+	"\x06player\x18\x02 \x01(\tR\x06player\"L\n" +
+	"\fPlayerChange\x12\"\n" +
+	"\x05entry\x18\x01 \x01(\v2\f.PlayerEntryR\x05entry\x12\x18\n" +
+	"\aconsole\x18\x02 \x01(\bR\aconsole*\x91\x01\n" +
+	"\n" +
+	"PlayerList\x12\x17\n" +
+	"\x13PLAYER_LIST_UNKNOWN\x10\x00\x12\x19\n" +
+	"\x15PLAYER_LIST_WHITELIST\x10\x01\x12\x13\n" +
+	"\x0fPLAYER_LIST_OPS\x10\x02\x12\x1e\n" +
+	"\x1aPLAYER_LIST_BANNED_PLAYERS\x10\x03\x12\x1a\n" +
+	"\x16PLAYER_LIST_BANNED_IPS\x10\x042\x8d\x01\n" +
+	"\aPlayers\x12*\n" +
+	"\x04List\x12\x12.PlayerListRequest\x1a\x0e.PlayerEntries\x12'\n" +
+	"\x03Add\x12\x11.AddPlayerRequest\x1a\r.PlayerChange\x12-\n" +
+	"\x06Remove\x12\x14.RemovePlayerRequest\x1a\r.PlayerChangeB-Z+github.com/khanghh/mcrunner/pkg/proto;protob\x06proto3"
+
+var (
+	file_players_proto_rawDescOnce sync.Once
+	file_players_proto_rawDescData []byte
+)
+
+func file_players_proto_rawDescGZIP() []byte {
+	file_players_proto_rawDescOnce.Do(func() {
+		file_players_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_players_proto_rawDesc), len(file_players_proto_rawDesc)))
+	})
+	return file_players_proto_rawDescData
+}
+
+var file_players_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_players_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_players_proto_goTypes = []any{
+	(PlayerList)(0),             // 0: PlayerList
+	(*PlayerEntry)(nil),         // 1: PlayerEntry
+	(*PlayerListRequest)(nil),   // 2: PlayerListRequest
+	(*PlayerEntries)(nil),       // 3: PlayerEntries
+	(*AddPlayerRequest)(nil),    // 4: AddPlayerRequest
+	(*RemovePlayerRequest)(nil), // 5: RemovePlayerRequest
+	(*PlayerChange)(nil),        // 6: PlayerChange
+}
+var file_players_proto_depIdxs = []int32{
+	0, // 0: PlayerListRequest.list:type_name -> PlayerList
+	1, // 1: PlayerEntries.entries:type_name -> PlayerEntry
+	0, // 2: AddPlayerRequest.list:type_name -> PlayerList
+	1, // 3: AddPlayerRequest.entry:type_name -> PlayerEntry
+	0, // 4: RemovePlayerRequest.list:type_name -> PlayerList
+	1, // 5: PlayerChange.entry:type_name -> PlayerEntry
+	2, // 6: Players.List:input_type -> PlayerListRequest
+	4, // 7: Players.Add:input_type -> AddPlayerRequest
+	5, // 8: Players.Remove:input_type -> RemovePlayerRequest
+	3, // 9: Players.List:output_type -> PlayerEntries
+	6, // 10: Players.Add:output_type -> PlayerChange
+	6, // 11: Players.Remove:output_type -> PlayerChange
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_players_proto_init() }
+func file_players_proto_init() {
+	if File_players_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_players_proto_rawDesc), len(file_players_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_players_proto_goTypes,
+		DependencyIndexes: file_players_proto_depIdxs,
+		EnumInfos:         file_players_proto_enumTypes,
+		MessageInfos:      file_players_proto_msgTypes,
+	}.Build()
+	File_players_proto = out.File
+	file_players_proto_goTypes = nil
+	file_players_proto_depIdxs = nil
+}
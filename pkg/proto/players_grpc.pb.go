@@ -0,0 +1,205 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.32.1
+// source: players.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Players_List_FullMethodName   = "/Players/List"
+	Players_Add_FullMethodName    = "/Players/Add"
+	Players_Remove_FullMethodName = "/Players/Remove"
+)
+
+// PlayersClient is the client API for Players service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ===== gRPC services =====
+// Changes go through the console while the server runs and edit the list
+// files while it is stopped.
+type PlayersClient interface {
+	List(ctx context.Context, in *PlayerListRequest, opts ...grpc.CallOption) (*PlayerEntries, error)
+	Add(ctx context.Context, in *AddPlayerRequest, opts ...grpc.CallOption) (*PlayerChange, error)
+	Remove(ctx context.Context, in *RemovePlayerRequest, opts ...grpc.CallOption) (*PlayerChange, error)
+}
+
+type playersClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPlayersClient(cc grpc.ClientConnInterface) PlayersClient {
+	return &playersClient{cc}
+}
+
+func (c *playersClient) List(ctx context.Context, in *PlayerListRequest, opts ...grpc.CallOption) (*PlayerEntries, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlayerEntries)
+	err := c.cc.Invoke(ctx, Players_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playersClient) Add(ctx context.Context, in *AddPlayerRequest, opts ...grpc.CallOption) (*PlayerChange, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlayerChange)
+	err := c.cc.Invoke(ctx, Players_Add_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *playersClient) Remove(ctx context.Context, in *RemovePlayerRequest, opts ...grpc.CallOption) (*PlayerChange, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PlayerChange)
+	err := c.cc.Invoke(ctx, Players_Remove_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PlayersServer is the server API for Players service.
+// All implementations must embed UnimplementedPlayersServer
+// for forward compatibility.
+//
+// ===== gRPC services =====
+// Changes go through the console while the server runs and edit the list
+// files while it is stopped.
+type PlayersServer interface {
+	List(context.Context, *PlayerListRequest) (*PlayerEntries, error)
+	Add(context.Context, *AddPlayerRequest) (*PlayerChange, error)
+	Remove(context.Context, *RemovePlayerRequest) (*PlayerChange, error)
+	mustEmbedUnimplementedPlayersServer()
+}
+
+// UnimplementedPlayersServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPlayersServer struct{}
+
+func (UnimplementedPlayersServer) List(context.Context, *PlayerListRequest) (*PlayerEntries, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedPlayersServer) Add(context.Context, *AddPlayerRequest) (*PlayerChange, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Add not implemented")
+}
+func (UnimplementedPlayersServer) Remove(context.Context, *RemovePlayerRequest) (*PlayerChange, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedPlayersServer) mustEmbedUnimplementedPlayersServer() {}
+func (UnimplementedPlayersServer) testEmbeddedByValue()                 {}
+
+// UnsafePlayersServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PlayersServer will
+// result in compilation errors.
+type UnsafePlayersServer interface {
+	mustEmbedUnimplementedPlayersServer()
+}
+
+func RegisterPlayersServer(s grpc.ServiceRegistrar, srv PlayersServer) {
+	// If the following call pancis, it indicates UnimplementedPlayersServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Players_ServiceDesc, srv)
+}
+
+func _Players_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlayerListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayersServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Players_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayersServer).List(ctx, req.(*PlayerListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Players_Add_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddPlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayersServer).Add(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Players_Add_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayersServer).Add(ctx, req.(*AddPlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Players_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemovePlayerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlayersServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Players_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlayersServer).Remove(ctx, req.(*RemovePlayerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Players_ServiceDesc is the grpc.ServiceDesc for Players service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Players_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Players",
+	HandlerType: (*PlayersServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _Players_List_Handler,
+		},
+		{
+			MethodName: "Add",
+			Handler:    _Players_Add_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _Players_Remove_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "players.proto",
+}